@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"project/auth"
+	"project/models"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// go test -run TestAPI -update rewrites the golden files from the responses
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// volatileKeys hold values that change on every run, such as tokens and
+// booking locators
+var volatileKeys = map[string]bool{
+	"access_token":  true,
+	"refresh_token": true,
+	"session_id":    true,
+	"locator":       true,
+	"reference":     true,
+}
+
+var timestampPattern = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}`)
+
+// golden checks the status of a response and compares its body with
+// testdata/name.json, once the volatile values are replaced by placeholders
+func (api *testAPI) golden(name string, recorder *httptest.ResponseRecorder, status int) {
+	api.t.Helper()
+	if recorder.Code != status {
+		api.t.Errorf("%s: status %d, want %d: %s", name, recorder.Code, status, recorder.Body)
+	}
+	var body interface{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		api.t.Fatalf("%s: %s: %s", name, err, recorder.Body)
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(normalize("", body)); err != nil {
+		api.t.Fatal(err)
+	}
+	got := buf.Bytes()
+
+	path := filepath.Join("testdata", name+".json")
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			api.t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		api.t.Fatalf("%s, run go test -update to create it", err)
+	}
+	if !bytes.Equal(got, want) {
+		api.t.Errorf("%s: the response changed, run go test -update if that is intended\ngot:\n%s\nwant:\n%s", name, got, want)
+	}
+}
+
+// normalize replaces the volatile values of a decoded JSON value
+func normalize(key string, value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for k, v := range value {
+			value[k] = normalize(k, v)
+		}
+		return value
+	case []interface{}:
+		for i, v := range value {
+			value[i] = normalize(key, v)
+		}
+		return value
+	case string:
+		if volatileKeys[key] && value != "" {
+			return "<" + key + ">"
+		}
+		if timestampPattern.MatchString(value) {
+			return "<time>"
+		}
+	}
+	return value
+}
+
+func TestAPI(t *testing.T) {
+	api := newTestAPI(t)
+	admin := api.login(api.createUser("admin", models.RoleAdmin))
+
+	// signup
+	api.golden("register_invalid_json", api.request(http.MethodPost, "/register", "", rawJSON(`{"username": "ayse",`)), http.StatusBadRequest)
+	api.golden("register_invalid_email", api.request(http.MethodPost, "/register", "", map[string]string{"username": "ayse", "email": "ayse", "password": testPassword}), http.StatusUnprocessableEntity)
+	signup := map[string]string{"username": "ayse", "email": "ayse@example.com", "password": testPassword}
+	api.golden("register", api.request(http.MethodPost, "/register", "", signup), http.StatusOK)
+	api.golden("register_taken", api.request(http.MethodPost, "/register", "", signup), http.StatusConflict)
+	login := map[string]string{"email": "ayse@example.com", "password": testPassword}
+	api.golden("login_inactive", api.request(http.MethodPost, "/login", "", login), http.StatusUnauthorized)
+
+	// activation
+	var user models.User
+	if err := api.db.Where("email = ?", "ayse@example.com").First(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	api.golden("activate_invalid", api.request(http.MethodPost, "/activate", "", map[string]string{"code": "wrong"}), http.StatusBadRequest)
+	api.golden("activate", api.request(http.MethodPost, "/activate", "", map[string]string{"code": user.ActivationCode}), http.StatusOK)
+
+	// login and refresh
+	api.golden("login_wrong_password", api.request(http.MethodPost, "/login", "", map[string]string{"email": "ayse@example.com", "password": "Wrong123!"}), http.StatusUnauthorized)
+	recorder := api.request(http.MethodPost, "/login", "", login)
+	api.golden("login", recorder, http.StatusOK)
+	var session tokens
+	json.Unmarshal(recorder.Body.Bytes(), &session)
+	recorder = api.request(http.MethodPost, "/token/refresh", "", map[string]string{"refresh_token": session.RefreshToken})
+	api.golden("refresh", recorder, http.StatusOK)
+	json.Unmarshal(recorder.Body.Bytes(), &session)
+	api.golden("refresh_invalid", api.request(http.MethodPost, "/token/refresh", "", map[string]string{"refresh_token": "not a refresh token"}), http.StatusUnauthorized)
+
+	userPath := "/users/" + strconv.Itoa(user.ID)
+	api.golden("expired_token", api.request(http.MethodGet, userPath, expiredAccessToken(t, user), nil), http.StatusUnauthorized)
+	api.golden("missing_token", api.request(http.MethodGet, userPath, "", nil), http.StatusUnauthorized)
+	api.golden("admin_only", api.request(http.MethodGet, "/users", session.AccessToken, nil), http.StatusForbidden)
+	api.golden("delete_unknown_user", api.request(http.MethodDelete, "/users/999", admin.AccessToken, nil), http.StatusNotFound)
+	api.golden("delete_unknown_plane", api.request(http.MethodDelete, "/planes/999", admin.AccessToken, nil), http.StatusNotFound)
+
+	// search
+	ticket := api.createTicket(1, 150000)
+	var from, to models.Airport
+	api.db.First(&from, ticket.FromAirportID)
+	api.db.First(&to, ticket.ToAirportID)
+	api.golden("search_tickets", api.request(http.MethodGet, "/tickets?sort=id", "", nil), http.StatusOK)
+	api.golden("search_filter", api.request(http.MethodGet, "/filtertickets?from="+from.IATA+"&to="+to.IATA, "", nil), http.StatusOK)
+	api.golden("search_routes", api.request(http.MethodGet, "/routes?from="+from.IATA+"&to="+to.IATA+"&date="+ticket.DepartureAt.Format("2006-01-02"), "", nil), http.StatusOK)
+	api.golden("search_routes_invalid_stops", api.request(http.MethodGet, "/routes?from="+from.IATA+"&to="+to.IATA+"&date="+ticket.DepartureAt.Format("2006-01-02")+"&max_stops=9", "", nil), http.StatusBadRequest)
+	api.golden("search_airports", api.request(http.MethodGet, "/airports/search?q="+from.IATA, "", nil), http.StatusOK)
+	api.golden("unknown_ticket", api.request(http.MethodGet, "/tickets/999", "", nil), http.StatusNotFound)
+
+	// booking
+	bookingRequest := func(ticketID int, passengers ...interface{}) map[string]interface{} {
+		return map[string]interface{}{"ticket_ids": []int{ticketID}, "passengers": passengers}
+	}
+	child := map[string]string{"first_name": "Can", "last_name": "Yilmaz", "date_of_birth": "2018-09-01", "document_number": "U87654321", "type": "CHD"}
+	api.golden("book_invalid_json", api.request(http.MethodPost, "/bookings", session.AccessToken, rawJSON(`{"ticket_ids": [`)), http.StatusBadRequest)
+	api.golden("book_without_adult", api.request(http.MethodPost, "/bookings", session.AccessToken, bookingRequest(ticket.ID, child)), http.StatusUnprocessableEntity)
+	api.golden("book_unknown_ticket", api.request(http.MethodPost, "/bookings", session.AccessToken, bookingRequest(999, adult)), http.StatusNotFound)
+	recorder = api.request(http.MethodPost, "/bookings", session.AccessToken, bookingRequest(ticket.ID, adult))
+	api.golden("book", recorder, http.StatusOK)
+	var created booking
+	json.Unmarshal(recorder.Body.Bytes(), &created)
+	api.golden("book_sold_out", api.request(http.MethodPost, "/bookings", admin.AccessToken, bookingRequest(ticket.ID, adult)), http.StatusConflict)
+
+	bookingPath := "/bookings/" + created.Locator
+	declined := map[string]interface{}{"card": map[string]interface{}{"number": "4000000000000002", "exp_month": 12, "exp_year": 2040, "cvc": "123"}}
+	api.golden("pay_declined", api.request(http.MethodPost, bookingPath+"/pay", session.AccessToken, declined), http.StatusPaymentRequired)
+	api.golden("pay", api.request(http.MethodPost, bookingPath+"/pay", session.AccessToken, card), http.StatusOK)
+	api.golden("pay_again", api.request(http.MethodPost, bookingPath+"/pay", session.AccessToken, card), http.StatusConflict)
+	api.golden("list_bookings", api.request(http.MethodGet, "/bookings", session.AccessToken, nil), http.StatusOK)
+	api.golden("find_booking_wrong_name", api.request(http.MethodGet, bookingPath+"?last_name=Demir", "", nil), http.StatusNotFound)
+
+	// cancellation
+	api.golden("cancel_unknown_booking", api.request(http.MethodPost, "/bookings/ZZZZZZ/cancel", session.AccessToken, nil), http.StatusNotFound)
+	api.golden("cancel", api.request(http.MethodPost, bookingPath+"/cancel", session.AccessToken, map[string]string{"reason": "plans changed"}), http.StatusOK)
+	api.golden("cancel_again", api.request(http.MethodPost, bookingPath+"/cancel", session.AccessToken, nil), http.StatusConflict)
+	api.golden("refunds", api.request(http.MethodGet, "/refunds", admin.AccessToken, nil), http.StatusOK)
+}
+
+// expiredAccessToken signs an access token for user that expired a minute ago
+func expiredAccessToken(t *testing.T, user models.User) string {
+	t.Helper()
+	keys, err := auth.NewHMACKeys([]byte(testJWTSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuedAt := time.Now().Add(-time.Hour)
+	token, err := keys.Sign(auth.Claims{
+		Subject:   strconv.Itoa(user.ID),
+		Role:      user.Role,
+		SessionID: "expired",
+		IssuedAt:  issuedAt.Unix(),
+		ExpiresAt: issuedAt.Add(59 * time.Minute).Unix(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
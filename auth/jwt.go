@@ -0,0 +1,142 @@
+// Package auth signs and verifies the short-lived access tokens of the API.
+//
+// Access tokens are JWTs signed with HMAC-SHA256 (HS256) or Ed25519 (EdDSA),
+// so they can be checked without a database round trip. Sessions live on as
+// refresh tokens, which are stored hashed in the database.
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// signing algorithms
+const (
+	HS256 = "HS256"
+	EdDSA = "EdDSA"
+)
+
+var ErrTokenMalformed = errors.New("token is malformed")
+var ErrTokenSignature = errors.New("token signature is invalid")
+var ErrTokenExpired = errors.New("token has expired")
+
+// Claims is the payload of an access token.
+type Claims struct {
+	Subject   string `json:"sub"` // user id
+	Role      string `json:"role"`
+	SessionID string `json:"sid"` // the refresh token session the token was issued for
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// Keys signs and verifies tokens with one algorithm.
+type Keys struct {
+	algorithm  string
+	secret     []byte
+	privateKey ed25519.PrivateKey
+	publicKey  ed25519.PublicKey
+}
+
+// NewHMACKeys signs with HS256, the secret needs at least 32 bytes
+func NewHMACKeys(secret []byte) (*Keys, error) {
+	if len(secret) < 32 {
+		return nil, errors.New("HMAC secret must be at least 32 bytes long")
+	}
+	return &Keys{algorithm: HS256, secret: secret}, nil
+}
+
+// NewEd25519Keys signs with EdDSA
+func NewEd25519Keys(privateKey ed25519.PrivateKey) *Keys {
+	return &Keys{algorithm: EdDSA, privateKey: privateKey, publicKey: privateKey.Public().(ed25519.PublicKey)}
+}
+
+// Algorithm returns the signing algorithm, HS256 or EdDSA.
+func (keys *Keys) Algorithm() string {
+	return keys.algorithm
+}
+
+// Sign returns the compact JWT of claims.
+func (keys *Keys) Sign(claims Claims) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": keys.algorithm, "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := encodeSegment(header) + "." + encodeSegment(payload)
+	return signingInput + "." + encodeSegment(keys.signature(signingInput)), nil
+}
+
+// Verify checks the signature and expiry of token and returns its claims.
+// Tokens signed with another algorithm than the keys' are rejected.
+func (keys *Keys) Verify(token string, now time.Time) (Claims, error) {
+	var claims Claims
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return claims, ErrTokenMalformed
+	}
+
+	var header struct {
+		Algorithm string `json:"alg"`
+	}
+	if err := decodeJSONSegment(parts[0], &header); err != nil {
+		return claims, ErrTokenMalformed
+	}
+	if header.Algorithm != keys.algorithm {
+		return claims, ErrTokenSignature
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return claims, ErrTokenMalformed
+	}
+	if !keys.verifySignature(parts[0]+"."+parts[1], signature) {
+		return claims, ErrTokenSignature
+	}
+
+	if err := decodeJSONSegment(parts[1], &claims); err != nil {
+		return claims, ErrTokenMalformed
+	}
+	if claims.Subject == "" || claims.ExpiresAt == 0 {
+		return claims, ErrTokenMalformed
+	}
+	if now.Unix() >= claims.ExpiresAt {
+		return claims, ErrTokenExpired
+	}
+	return claims, nil
+}
+
+func (keys *Keys) signature(signingInput string) []byte {
+	if keys.algorithm == EdDSA {
+		return ed25519.Sign(keys.privateKey, []byte(signingInput))
+	}
+	mac := hmac.New(sha256.New, keys.secret)
+	mac.Write([]byte(signingInput))
+	return mac.Sum(nil)
+}
+
+func (keys *Keys) verifySignature(signingInput string, signature []byte) bool {
+	if keys.algorithm == EdDSA {
+		return ed25519.Verify(keys.publicKey, []byte(signingInput), signature)
+	}
+	return hmac.Equal(keys.signature(signingInput), signature)
+}
+
+func encodeSegment(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeJSONSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"project/config"
+)
+
+// ErrNoSigningKey is returned by LoadKeys when no key is configured.
+var ErrNoSigningKey = errors.New("no token signing key configured")
+
+// LoadKeys loads the signing keys of the configured algorithm:
+//   - HS256 (default) uses the secret of cfg
+//   - EdDSA uses the PKCS #8 PEM Ed25519 private key in cfg.PrivateKeyFile
+func LoadKeys(cfg config.JWT) (*Keys, error) {
+	algorithm := cfg.Algorithm
+	if algorithm == "" {
+		algorithm = HS256
+	}
+
+	switch algorithm {
+	case HS256:
+		if cfg.Secret == "" {
+			return nil, ErrNoSigningKey
+		}
+		return NewHMACKeys([]byte(cfg.Secret))
+	case EdDSA:
+		if cfg.PrivateKeyFile == "" {
+			return nil, ErrNoSigningKey
+		}
+		data, err := os.ReadFile(cfg.PrivateKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		privateKey, err := ParseEd25519PrivateKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", cfg.PrivateKeyFile, err)
+		}
+		return NewEd25519Keys(privateKey), nil
+	default:
+		return nil, fmt.Errorf("unknown JWT algorithm %q", algorithm)
+	}
+}
+
+// ParseEd25519PrivateKey reads a PEM encoded PKCS #8 Ed25519 private key, as
+// written by `openssl genpkey -algorithm ed25519`.
+func ParseEd25519PrivateKey(data []byte) (ed25519.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("not an Ed25519 private key")
+	}
+	return privateKey, nil
+}
@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// Revocations lists the revoked sessions whose access tokens may not have
+// expired yet. It is kept in memory so access tokens are checked without a
+// database round trip.
+type Revocations struct {
+	mu sync.RWMutex
+	// sessions maps a session id to when its last access token expires
+	sessions map[string]time.Time
+}
+
+func NewRevocations() *Revocations {
+	return &Revocations{sessions: map[string]time.Time{}}
+}
+
+// Revoke rejects the access tokens of a session until they have expired.
+func (revocations *Revocations) Revoke(sessionID string, until time.Time) {
+	revocations.mu.Lock()
+	defer revocations.mu.Unlock()
+	if until.After(revocations.sessions[sessionID]) {
+		revocations.sessions[sessionID] = until
+	}
+}
+
+// Revoked reports whether the access tokens of a session are revoked.
+func (revocations *Revocations) Revoked(sessionID string, now time.Time) bool {
+	revocations.mu.RLock()
+	defer revocations.mu.RUnlock()
+	until, ok := revocations.sessions[sessionID]
+	return ok && now.Before(until)
+}
+
+// Forget drops the sessions whose access tokens have all expired.
+func (revocations *Revocations) Forget(now time.Time) {
+	revocations.mu.Lock()
+	defer revocations.mu.Unlock()
+	for sessionID, until := range revocations.sessions {
+		if !now.Before(until) {
+			delete(revocations.sessions, sessionID)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http"
+	"project/models"
+	"strconv"
+	"testing"
+)
+
+// apiErrorBody is the error response of the API
+type apiErrorBody struct {
+	Error struct {
+		Code string `json:"code"`
+	} `json:"error"`
+}
+
+func TestLogoutAllRevokesAccessTokens(t *testing.T) {
+	api := newTestAPI(t)
+	user := api.createUser("ayse", models.RoleCustomer)
+	first := api.login(user)
+	second := api.login(user)
+	path := "/users/" + strconv.Itoa(user.ID)
+
+	api.expect(api.request(http.MethodGet, path, second.AccessToken, nil), http.StatusOK, nil)
+	api.expect(api.request(http.MethodPost, "/logout/all", first.AccessToken, nil), http.StatusOK, nil)
+
+	var body apiErrorBody
+	api.expect(api.request(http.MethodGet, path, second.AccessToken, nil), http.StatusUnauthorized, &body)
+	if body.Error.Code != "token_revoked" {
+		t.Errorf("code = %q, want token_revoked", body.Error.Code)
+	}
+	api.expect(api.request(http.MethodPost, "/token/refresh", "", map[string]string{"refresh_token": second.RefreshToken}), http.StatusUnauthorized, nil)
+
+	// logging in again works
+	third := api.login(user)
+	api.expect(api.request(http.MethodGet, path, third.AccessToken, nil), http.StatusOK, nil)
+}
+
+func TestLogoutRevokesTheAccessToken(t *testing.T) {
+	api := newTestAPI(t)
+	user := api.createUser("ayse", models.RoleCustomer)
+	session := api.login(user)
+	other := api.login(user)
+	path := "/users/" + strconv.Itoa(user.ID)
+
+	api.expect(api.request(http.MethodPost, "/logout", session.AccessToken, nil), http.StatusOK, nil)
+
+	var body apiErrorBody
+	api.expect(api.request(http.MethodGet, path, session.AccessToken, nil), http.StatusUnauthorized, &body)
+	if body.Error.Code != "token_revoked" {
+		t.Errorf("code = %q, want token_revoked", body.Error.Code)
+	}
+	api.expect(api.request(http.MethodPost, "/token/refresh", "", map[string]string{"refresh_token": session.RefreshToken}), http.StatusUnauthorized, nil)
+	// the other session is still logged in
+	api.expect(api.request(http.MethodGet, path, other.AccessToken, nil), http.StatusOK, nil)
+}
+
+func TestChangePasswordKeepsTheCurrentSession(t *testing.T) {
+	api := newTestAPI(t)
+	user := api.createUser("ayse", models.RoleCustomer)
+	current := api.login(user)
+	other := api.login(user)
+	path := "/users/" + strconv.Itoa(user.ID)
+
+	var changed tokens
+	api.expect(api.request(http.MethodPost, path+"/password", current.AccessToken, map[string]string{
+		"current_password": testPassword,
+		"new_password":     "Another456?",
+	}), http.StatusOK, &changed)
+	if changed.AccessToken == "" {
+		t.Fatal("no new access token for the current session")
+	}
+
+	api.expect(api.request(http.MethodPost, "/token/refresh", "", map[string]string{"refresh_token": other.RefreshToken}), http.StatusUnauthorized, nil)
+	api.expect(api.request(http.MethodGet, path, other.AccessToken, nil), http.StatusUnauthorized, nil)
+	api.expect(api.request(http.MethodPost, "/token/refresh", "", map[string]string{"refresh_token": current.RefreshToken}), http.StatusOK, nil)
+	api.expect(api.request(http.MethodGet, path, changed.AccessToken, nil), http.StatusOK, nil)
+}
+
+func TestDeletedUserTokensAreRejected(t *testing.T) {
+	api := newTestAPI(t)
+	admin := api.createUser("admin", models.RoleAdmin)
+	user := api.createUser("ayse", models.RoleCustomer)
+	adminTokens := api.login(admin)
+	userTokens := api.login(user)
+	path := "/users/" + strconv.Itoa(user.ID)
+
+	api.expect(api.request(http.MethodDelete, path, adminTokens.AccessToken, nil), http.StatusOK, nil)
+	api.expect(api.request(http.MethodGet, path, userTokens.AccessToken, nil), http.StatusUnauthorized, nil)
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"project/config"
+	"project/controllers"
+	"project/models"
+	"project/payments"
+	"project/store"
+	"project/store/sqlite"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// cancellation is the body of a cancelled booked ticket
+type cancellation struct {
+	Refund *struct {
+		Amount int64 `json:"amount"`
+	} `json:"refund"`
+}
+
+func TestBookingWithoutPaymentIsNotPossible(t *testing.T) {
+	api := newTestAPI(t)
+	user := api.createUser("ayse", models.RoleCustomer)
+	session := api.login(user)
+	ticket := api.createTicket(10, 150000)
+
+	var booked booking
+	api.expect(api.request(http.MethodPost, "/tickets/"+strconv.Itoa(ticket.ID)+"/book", session.AccessToken, map[string]interface{}{
+		"passengers": []interface{}{adult},
+	}), http.StatusOK, &booked)
+	if booked.Status != models.BookingPending || len(booked.BTickets) != 1 {
+		t.Fatalf("booked ticket = %+v, want a pending booking with one booked ticket", booked)
+	}
+
+	var hold struct {
+		ID int `json:"id"`
+	}
+	api.expect(api.request(http.MethodPost, "/tickets/"+strconv.Itoa(ticket.ID)+"/hold", session.AccessToken, map[string]int{"quantity": 1}), http.StatusOK, &hold)
+	confirm := "/holds/" + strconv.Itoa(hold.ID) + "/confirm"
+	api.expect(api.request(http.MethodPost, confirm, session.AccessToken, nil), http.StatusBadRequest, nil)
+	var body apiErrorBody
+	api.expect(api.request(http.MethodPost, confirm, session.AccessToken, map[string]interface{}{
+		"passengers": []interface{}{adult, adult},
+	}), http.StatusUnprocessableEntity, &body)
+	if body.Error.Code != "hold_passenger_count" {
+		t.Errorf("code = %q, want hold_passenger_count", body.Error.Code)
+	}
+
+	var confirmed struct {
+		Booking booking `json:"booking"`
+	}
+	api.expect(api.request(http.MethodPost, confirm, session.AccessToken, map[string]interface{}{
+		"passengers": []interface{}{adult},
+	}), http.StatusOK, &confirmed)
+	if confirmed.Booking.Status != models.BookingPending || len(confirmed.Booking.BTickets) != 1 {
+		t.Fatalf("confirmed hold = %+v, want a pending booking with one booked ticket", confirmed.Booking)
+	}
+
+	var paid struct {
+		Booking booking `json:"booking"`
+	}
+	api.expect(api.request(http.MethodPost, "/bookings/"+confirmed.Booking.Locator+"/pay", session.AccessToken, card), http.StatusOK, &paid)
+	if paid.Booking.Status != models.BookingConfirmed {
+		t.Errorf("status = %q after paying, want %q", paid.Booking.Status, models.BookingConfirmed)
+	}
+}
+
+func TestOnlyPaidTicketsAreRefunded(t *testing.T) {
+	api := newTestAPI(t)
+	user := api.createUser("ayse", models.RoleCustomer)
+	session := api.login(user)
+	ticket := api.createTicket(10, 150000)
+
+	unpaid := api.book(session.AccessToken, ticket)
+	var cancelled cancellation
+	api.expect(api.request(http.MethodPost, "/btickets/"+strconv.Itoa(unpaid.BTickets[0].ID)+"/cancel", session.AccessToken, nil), http.StatusOK, &cancelled)
+	if cancelled.Refund != nil {
+		t.Errorf("unpaid ticket refunded %d", cancelled.Refund.Amount)
+	}
+
+	paid := api.book(session.AccessToken, ticket)
+	api.expect(api.request(http.MethodPost, "/bookings/"+paid.Locator+"/pay", session.AccessToken, card), http.StatusOK, nil)
+	cancelled = cancellation{}
+	api.expect(api.request(http.MethodPost, "/btickets/"+strconv.Itoa(paid.BTickets[0].ID)+"/cancel", session.AccessToken, nil), http.StatusOK, &cancelled)
+	if cancelled.Refund == nil || cancelled.Refund.Amount != 150000 {
+		t.Errorf("refund of a paid ticket a week before departure = %+v, want 150000", cancelled.Refund)
+	}
+
+	// a booked ticket outside of a booking was never paid
+	legacy := models.BTicket{TicketID: ticket.ID, UserID: user.ID, FareAmount: 150000, Currency: "TRY"}
+	if err := api.db.Create(&legacy).Error; err != nil {
+		t.Fatal(err)
+	}
+	cancelled = cancellation{}
+	api.expect(api.request(http.MethodPost, "/btickets/"+strconv.Itoa(legacy.ID)+"/cancel", session.AccessToken, nil), http.StatusOK, &cancelled)
+	if cancelled.Refund != nil {
+		t.Errorf("booked ticket without a payment refunded %d", cancelled.Refund.Amount)
+	}
+
+	var count int64
+	if err := api.db.Model(&models.Refund{}).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("%d refunds recorded, want 1", count)
+	}
+}
+
+// flakyGateway fails the refunds while failRefunds is set
+type flakyGateway struct {
+	payments.Gateway
+	failRefunds bool
+}
+
+func (gateway *flakyGateway) Refund(ctx context.Context, reference string, amount int64) (payments.Result, error) {
+	if gateway.failRefunds {
+		return payments.Result{}, errors.New("provider unavailable")
+	}
+	return gateway.Gateway.Refund(ctx, reference, amount)
+}
+
+func TestFailedRefundsAreRetried(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := sqlite.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	gateway := &flakyGateway{Gateway: payments.NewMockGateway(), failRefunds: true}
+	api := newTestAPIWithGateway(t, db, config.Default(), gateway)
+	user := api.createUser("ayse", models.RoleCustomer)
+	session := api.login(user)
+	ticket := api.createTicket(10, 150000)
+
+	paid := api.book(session.AccessToken, ticket)
+	api.expect(api.request(http.MethodPost, "/bookings/"+paid.Locator+"/pay", session.AccessToken, card), http.StatusOK, nil)
+	var cancelled struct {
+		Refund struct {
+			ID      int    `json:"id"`
+			Status  string `json:"status"`
+			Failure string `json:"failure"`
+		} `json:"refund"`
+	}
+	api.expect(api.request(http.MethodPost, "/btickets/"+strconv.Itoa(paid.BTickets[0].ID)+"/cancel", session.AccessToken, nil), http.StatusOK, &cancelled)
+	if cancelled.Refund.Status != models.RefundFailed || cancelled.Refund.Failure == "" {
+		t.Fatalf("refund while the provider fails = %+v, want failed", cancelled.Refund)
+	}
+
+	gateway.failRefunds = false
+	retried, err := controllers.RetryRefunds(store.New(api.db).Bookings, gateway, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retried != 1 {
+		t.Errorf("%d refunds retried, want 1", retried)
+	}
+	var refund models.Refund
+	if err := api.db.First(&refund, cancelled.Refund.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if refund.Status != models.RefundSucceeded || refund.Attempts != 2 || refund.Failure != "" {
+		t.Errorf("retried refund = %s after %d attempts (%q), want succeeded after 2", refund.Status, refund.Attempts, refund.Failure)
+	}
+
+	// succeeded refunds are not sent again
+	retried, err = controllers.RetryRefunds(store.New(api.db).Bookings, gateway, time.Now())
+	if err != nil || retried != 0 {
+		t.Errorf("retried %d refunds again (%v), want 0", retried, err)
+	}
+}
+
+// The requests run concurrently through the whole router. SQLite runs one
+// transaction at a time, so this checks that the seat count is read and
+// taken in the same transaction.
+func TestConcurrentBookingsOfTheLastSeat(t *testing.T) {
+	api := newTestAPI(t)
+	user := api.createUser("ayse", models.RoleCustomer)
+	session := api.login(user)
+	ticket := api.createTicket(1, 150000)
+
+	const customers = 20
+	statuses := make(chan int, customers)
+	codes := make(chan string, customers)
+	var wg sync.WaitGroup
+	for i := 0; i < customers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			recorder := api.request(http.MethodPost, "/bookings", session.AccessToken, map[string]interface{}{
+				"ticket_ids": []int{ticket.ID},
+				"passengers": []interface{}{adult},
+			})
+			statuses <- recorder.Code
+			var body apiErrorBody
+			json.Unmarshal(recorder.Body.Bytes(), &body)
+			codes <- body.Error.Code
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+	close(codes)
+
+	booked := 0
+	for status := range statuses {
+		switch status {
+		case http.StatusOK:
+			booked++
+		case http.StatusConflict:
+		default:
+			t.Errorf("unexpected status %d", status)
+		}
+	}
+	soldOut := 0
+	for code := range codes {
+		if code == "sold_out" {
+			soldOut++
+		}
+	}
+	if booked != 1 || soldOut != customers-1 {
+		t.Errorf("%d bookings and %d sold_out answers, want 1 and %d", booked, soldOut, customers-1)
+	}
+
+	var stored models.Ticket
+	if err := api.db.First(&stored, ticket.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.AvailableSeats != 0 {
+		t.Errorf("available seats = %d, want 0", stored.AvailableSeats)
+	}
+	var bTickets int64
+	if err := api.db.Model(&models.BTicket{}).Where("ticket_id = ? AND cancelled_at IS NULL", ticket.ID).Count(&bTickets).Error; err != nil {
+		t.Fatal(err)
+	}
+	if bTickets != 1 {
+		t.Errorf("%d booked tickets, want 1", bTickets)
+	}
+}
+
+func TestBookingPicksSeatsPerSegment(t *testing.T) {
+	api := newTestAPI(t)
+	user := api.createUser("ayse", models.RoleCustomer)
+	session := api.login(user)
+	first := api.createTicket(10, 150000)
+	second := api.createTicket(10, 90000)
+	for _, letter := range []string{"A", "B"} {
+		if err := api.db.Create(&models.Seat{PlaneID: first.PlaneID, Row: 1, Letter: letter, Cabin: models.CabinEconomy}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var body apiErrorBody
+	api.expect(api.request(http.MethodPost, "/bookings", session.AccessToken, map[string]interface{}{
+		"ticket_ids": []int{first.ID, second.ID},
+		"passengers": []interface{}{adult},
+		"seats":      [][]string{{"1B"}},
+	}), http.StatusUnprocessableEntity, &body)
+	if body.Error.Code != "segment_seat_count" {
+		t.Errorf("code = %q, want segment_seat_count", body.Error.Code)
+	}
+	api.expect(api.request(http.MethodPost, "/bookings", session.AccessToken, map[string]interface{}{
+		"ticket_ids": []int{first.ID, second.ID},
+		"passengers": []interface{}{adult},
+		"seats":      [][]string{{"1B"}, {"2A"}},
+	}), http.StatusUnprocessableEntity, &body)
+	if body.Error.Code != "no_seat_map" {
+		t.Errorf("code = %q, want no_seat_map", body.Error.Code)
+	}
+
+	var booked struct {
+		BTickets []struct {
+			Seat string `json:"seat"`
+		} `json:"btickets"`
+	}
+	api.expect(api.request(http.MethodPost, "/bookings", session.AccessToken, map[string]interface{}{
+		"ticket_ids": []int{first.ID, second.ID},
+		"passengers": []interface{}{adult},
+		"seats":      [][]string{{"1B"}, {}},
+	}), http.StatusOK, &booked)
+	if len(booked.BTickets) != 2 || booked.BTickets[0].Seat != "1B" || booked.BTickets[1].Seat != "" {
+		t.Errorf("booked tickets = %+v, want seat 1B on the first segment only", booked.BTickets)
+	}
+}
+
+func TestAgentBookedTicketsTakeSeats(t *testing.T) {
+	api := newTestAPI(t)
+	agent := api.login(api.createUser("agent", models.RoleAgent))
+	customer := api.createUser("ayse", models.RoleCustomer)
+	first := api.createTicket(1, 150000)
+	second := api.createTicket(1, 90000)
+	availableSeats := func(ticket models.Ticket) int {
+		t.Helper()
+		var stored models.Ticket
+		if err := api.db.First(&stored, ticket.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+		return stored.AvailableSeats
+	}
+
+	api.expect(api.request(http.MethodPost, "/btickets", agent.AccessToken, map[string]int{"ticket_id": 999999, "user_id": customer.ID}), http.StatusNotFound, nil)
+	api.expect(api.request(http.MethodPost, "/btickets", agent.AccessToken, map[string]int{"ticket_id": first.ID, "user_id": 999999}), http.StatusNotFound, nil)
+
+	var created struct {
+		ID         int   `json:"id"`
+		TicketID   int   `json:"ticket_id"`
+		FareAmount int64 `json:"fare_amount"`
+	}
+	api.expect(api.request(http.MethodPost, "/btickets", agent.AccessToken, map[string]int{"ticket_id": first.ID, "user_id": customer.ID}), http.StatusOK, &created)
+	if created.ID == 0 || created.FareAmount != first.PriceAmount {
+		t.Errorf("created = %+v, want the stored booked ticket with the fare of the ticket", created)
+	}
+	if seats := availableSeats(first); seats != 0 {
+		t.Errorf("available seats = %d after booking, want 0", seats)
+	}
+	api.expect(api.request(http.MethodPost, "/btickets", agent.AccessToken, map[string]int{"ticket_id": first.ID, "user_id": customer.ID}), http.StatusConflict, nil)
+
+	path := "/btickets/" + strconv.Itoa(created.ID)
+	api.expect(api.request(http.MethodPut, "/btickets/999999", agent.AccessToken, map[string]int{"ticket_id": second.ID, "user_id": customer.ID}), http.StatusNotFound, nil)
+	api.expect(api.request(http.MethodPut, path, agent.AccessToken, map[string]int{"ticket_id": 999999, "user_id": customer.ID}), http.StatusNotFound, nil)
+	api.expect(api.request(http.MethodPut, path, agent.AccessToken, map[string]int{"ticket_id": second.ID, "user_id": customer.ID}), http.StatusOK, &created)
+	if created.TicketID != second.ID || created.FareAmount != second.PriceAmount {
+		t.Errorf("updated = %+v, want it on the second ticket with its fare", created)
+	}
+	if first, second := availableSeats(first), availableSeats(second); first != 1 || second != 0 {
+		t.Errorf("available seats = %d and %d after moving, want 1 and 0", first, second)
+	}
+}
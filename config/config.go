@@ -0,0 +1,430 @@
+// Package config loads the settings of the server.
+//
+// Settings come from, in increasing order of precedence: defaults, a config
+// file, environment variables and command line flags. The config file is a
+// list of KEY=VALUE lines such as pro.env, using the names of the
+// environment variables. Every setting of the server is read here, and Load
+// rejects invalid values before anything starts.
+package config
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"project/models"
+	"project/payments"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	// Addr is the address the HTTP server listens on
+	Addr string
+	// BaseURL is where users reach the app, the links in emails point to it
+	BaseURL string
+	// AdminEmail is the account given the admin role at startup, if any
+	AdminEmail string
+	// PaymentProvider is the name of the payment gateway, see payments.New
+	PaymentProvider string
+	// FareRules is the JSON refund policy of cancellations, the default
+	// policy when empty, see models.ParseRefundPolicy
+	FareRules string
+
+	Database  Database
+	Lifetimes Lifetimes
+	JWT       JWT
+	Mail      Mail
+
+	// LegacyTicketTimezone is the IANA timezone of the dates of tickets
+	// stored as text, read when they are converted by the migrations
+	LegacyTicketTimezone string
+	// DefaultCurrency is given to legacy prices that don't name a currency
+	DefaultCurrency string
+}
+
+// Database holds the connection and pool settings of the MySQL database.
+type Database struct {
+	Host     string
+	Port     int
+	User     string
+	Password string
+	Name     string
+
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+	// ConnectTimeout is how long startup keeps retrying to reach the database
+	ConnectTimeout time.Duration
+}
+
+// Lifetimes holds how long codes, tokens, holds and stored responses last.
+type Lifetimes struct {
+	ActivationCode time.Duration
+	AccessToken    time.Duration
+	RefreshToken   time.Duration
+	PasswordReset  time.Duration
+	// BookingPayment is how long a new booking waits for payment
+	BookingPayment time.Duration
+	// SeatHold is how long seats stay held before they are released
+	SeatHold time.Duration
+	// IdempotencyKey is how long responses are kept for replays
+	IdempotencyKey time.Duration
+}
+
+// JWT holds the keys access tokens are signed with.
+type JWT struct {
+	// Algorithm is HS256, signing with Secret, or EdDSA, signing with the
+	// PKCS #8 PEM Ed25519 private key in PrivateKeyFile
+	Algorithm      string
+	Secret         string
+	PrivateKeyFile string
+}
+
+// Mail holds how emails are written and sent.
+type Mail struct {
+	// Mailer is "smtp", "file" or "memory"
+	Mailer       string
+	SMTPServer   string
+	SMTPPort     int
+	SMTPInsecure bool
+	// SenderEmail and SenderPassword log in to the SMTP server
+	SenderEmail    string
+	SenderPassword string
+	// SenderName and SenderVisibleEmail make up the From of emails
+	SenderName         string
+	SenderVisibleEmail string
+	// Dir is where the file mailer writes emails
+	Dir string
+	// TemplateDir holds templates replacing the built-in ones, if set
+	TemplateDir string
+}
+
+// Default returns the settings used when nothing else is configured. There
+// is no default database password, it has to be configured.
+func Default() Config {
+	return Config{
+		Addr:                 ":8080",
+		BaseURL:              "http://localhost:8080",
+		PaymentProvider:      "mock",
+		LegacyTicketTimezone: "Europe/Istanbul",
+		DefaultCurrency:      "TRY",
+		Database: Database{
+			Host:            "project-db",
+			Port:            3306,
+			User:            "root",
+			Name:            "databasepr",
+			MaxOpenConns:    25,
+			MaxIdleConns:    10,
+			ConnMaxLifetime: 30 * time.Minute,
+			ConnMaxIdleTime: 5 * time.Minute,
+			ConnectTimeout:  time.Minute,
+		},
+		Lifetimes: Lifetimes{
+			ActivationCode: 48 * time.Hour,
+			AccessToken:    15 * time.Minute,
+			RefreshToken:   30 * 24 * time.Hour,
+			PasswordReset:  time.Hour,
+			BookingPayment: 30 * time.Minute,
+			SeatHold:       15 * time.Minute,
+			IdempotencyKey: 24 * time.Hour,
+		},
+		JWT: JWT{Algorithm: "HS256"},
+		Mail: Mail{
+			SMTPPort: 587,
+			Dir:      "mail",
+		},
+	}
+}
+
+// Load reads the settings from the config file named by -config or
+// CONFIG_FILE, the environment and the command line arguments args.
+func Load(args []string) (Config, error) {
+	cfg := Default()
+
+	flags := flag.NewFlagSet("server", flag.ContinueOnError)
+	file := flags.String("config", os.Getenv("CONFIG_FILE"), "path of a KEY=VALUE config file")
+	addr := flags.String("addr", "", "address the HTTP server listens on")
+	dbHost := flags.String("db-host", "", "database host")
+	dbPort := flags.Int("db-port", 0, "database port")
+	dbUser := flags.String("db-user", "", "database user")
+	dbName := flags.String("db-name", "", "database name")
+	maxOpenConns := flags.Int("db-max-open-conns", 0, "maximum open database connections")
+	maxIdleConns := flags.Int("db-max-idle-conns", 0, "maximum idle database connections")
+	if err := flags.Parse(args); err != nil {
+		return cfg, err
+	}
+
+	fileValues := map[string]string{}
+	if *file != "" {
+		var err error
+		if fileValues, err = loadFile(*file); err != nil {
+			return cfg, err
+		}
+	}
+	// The environment overrides the file
+	lookup := func(key string) string {
+		if value := os.Getenv(key); value != "" {
+			return value
+		}
+		return fileValues[key]
+	}
+	if err := cfg.load(lookup); err != nil {
+		return cfg, err
+	}
+
+	// Only flags given on the command line override the environment
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "addr":
+			cfg.Addr = *addr
+		case "db-host":
+			cfg.Database.Host = *dbHost
+		case "db-port":
+			cfg.Database.Port = *dbPort
+		case "db-user":
+			cfg.Database.User = *dbUser
+		case "db-name":
+			cfg.Database.Name = *dbName
+		case "db-max-open-conns":
+			cfg.Database.MaxOpenConns = *maxOpenConns
+		case "db-max-idle-conns":
+			cfg.Database.MaxIdleConns = *maxIdleConns
+		}
+	})
+
+	return cfg, cfg.Validate()
+}
+
+// load overrides cfg with the values lookup finds, lookup returns "" for
+// settings that are not set
+func (cfg *Config) load(lookup func(key string) string) error {
+	var errs []string
+	setString := func(key string, value *string) {
+		if v := lookup(key); v != "" {
+			*value = v
+		}
+	}
+	setInt := func(key string, value *int) {
+		if v := lookup(key); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				errs = append(errs, key+" must be an integer")
+				return
+			}
+			*value = n
+		}
+	}
+	setBool := func(key string, value *bool) {
+		if v := lookup(key); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				errs = append(errs, key+" must be true or false")
+				return
+			}
+			*value = b
+		}
+	}
+	setDuration := func(key string, value *time.Duration) {
+		if v := lookup(key); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				errs = append(errs, key+" must be a duration such as 30s or 5m")
+				return
+			}
+			*value = d
+		}
+	}
+
+	setString("ADDR", &cfg.Addr)
+	setString("APP_BASE_URL", &cfg.BaseURL)
+	setString("ADMIN_EMAIL", &cfg.AdminEmail)
+	setString("PAYMENT_PROVIDER", &cfg.PaymentProvider)
+	setString("FARE_RULES", &cfg.FareRules)
+	setString("LEGACY_TICKET_TIMEZONE", &cfg.LegacyTicketTimezone)
+	setString("DEFAULT_CURRENCY", &cfg.DefaultCurrency)
+
+	setString("PROJECT_HOST", &cfg.Database.Host)
+	setInt("PROJECT_PORT", &cfg.Database.Port)
+	setString("PROJECT_USER", &cfg.Database.User)
+	setString("PROJECT_PASS", &cfg.Database.Password)
+	setString("PROJECT_NAME", &cfg.Database.Name)
+	setInt("DB_MAX_OPEN_CONNS", &cfg.Database.MaxOpenConns)
+	setInt("DB_MAX_IDLE_CONNS", &cfg.Database.MaxIdleConns)
+	setDuration("DB_CONN_MAX_LIFETIME", &cfg.Database.ConnMaxLifetime)
+	setDuration("DB_CONN_MAX_IDLE_TIME", &cfg.Database.ConnMaxIdleTime)
+	setDuration("DB_CONNECT_TIMEOUT", &cfg.Database.ConnectTimeout)
+
+	setDuration("ACTIVATION_CODE_TTL", &cfg.Lifetimes.ActivationCode)
+	setDuration("ACCESS_TOKEN_TTL", &cfg.Lifetimes.AccessToken)
+	setDuration("REFRESH_TOKEN_TTL", &cfg.Lifetimes.RefreshToken)
+	setDuration("PASSWORD_RESET_TTL", &cfg.Lifetimes.PasswordReset)
+	setDuration("BOOKING_PAYMENT_TTL", &cfg.Lifetimes.BookingPayment)
+	setDuration("SEAT_HOLD_TTL", &cfg.Lifetimes.SeatHold)
+	setDuration("IDEMPOTENCY_KEY_TTL", &cfg.Lifetimes.IdempotencyKey)
+
+	setString("JWT_ALGORITHM", &cfg.JWT.Algorithm)
+	setString("JWT_SECRET", &cfg.JWT.Secret)
+	setString("JWT_PRIVATE_KEY_FILE", &cfg.JWT.PrivateKeyFile)
+
+	setString("MAILER", &cfg.Mail.Mailer)
+	setString("SMTP_SERVER", &cfg.Mail.SMTPServer)
+	setInt("SMTP_PORT", &cfg.Mail.SMTPPort)
+	setBool("SMTP_INSECURE", &cfg.Mail.SMTPInsecure)
+	setString("SENDER_EMAIL", &cfg.Mail.SenderEmail)
+	setString("SENDER_PASSWORD", &cfg.Mail.SenderPassword)
+	setString("SENDER_NAME", &cfg.Mail.SenderName)
+	setString("SENDER_EMAIL_VISIBLE", &cfg.Mail.SenderVisibleEmail)
+	setString("MAIL_DIR", &cfg.Mail.Dir)
+	setString("MAIL_TEMPLATE_DIR", &cfg.Mail.TemplateDir)
+	// Without MAILER, emails go over SMTP when a server is set and are
+	// written to files otherwise
+	if cfg.Mail.Mailer == "" {
+		cfg.Mail.Mailer = "file"
+		if cfg.Mail.SMTPServer != "" {
+			cfg.Mail.Mailer = "smtp"
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+var currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// Validate checks that the required settings are present and sensible.
+func (cfg Config) Validate() error {
+	var problems []string
+	if cfg.Addr == "" {
+		problems = append(problems, "the listen address is required")
+	}
+	if baseURL, err := url.Parse(cfg.BaseURL); err != nil || (baseURL.Scheme != "http" && baseURL.Scheme != "https") || baseURL.Host == "" {
+		problems = append(problems, "the base URL must be an http or https URL such as https://example.com")
+	}
+	if _, err := payments.New(cfg.PaymentProvider); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if cfg.FareRules != "" {
+		if _, err := models.ParseRefundPolicy(cfg.FareRules); err != nil {
+			problems = append(problems, "invalid fare rules: "+err.Error())
+		}
+	}
+	if _, err := time.LoadLocation(cfg.LegacyTicketTimezone); err != nil || cfg.LegacyTicketTimezone == "" {
+		problems = append(problems, "the legacy ticket timezone must be an IANA timezone such as Europe/Istanbul")
+	}
+	if !currencyPattern.MatchString(cfg.DefaultCurrency) {
+		problems = append(problems, "the default currency must be a 3 letter code such as TRY")
+	}
+
+	db := cfg.Database
+	if db.Host == "" {
+		problems = append(problems, "the database host is required")
+	}
+	if db.Port < 1 || db.Port > 65535 {
+		problems = append(problems, "the database port must be between 1 and 65535")
+	}
+	if db.User == "" {
+		problems = append(problems, "the database user is required")
+	}
+	if db.Password == "" {
+		problems = append(problems, "the database password is required")
+	}
+	if db.Name == "" {
+		problems = append(problems, "the database name is required")
+	}
+	if db.MaxOpenConns < 1 {
+		problems = append(problems, "the maximum of open database connections must be positive")
+	}
+	if db.MaxIdleConns < 0 || db.MaxIdleConns > db.MaxOpenConns {
+		problems = append(problems, "the maximum of idle database connections must be between 0 and the maximum of open connections")
+	}
+	if db.ConnMaxLifetime < 0 || db.ConnMaxIdleTime < 0 || db.ConnectTimeout < 0 {
+		problems = append(problems, "database durations must not be negative")
+	}
+
+	lifetimes := cfg.Lifetimes
+	for _, lifetime := range []time.Duration{lifetimes.ActivationCode, lifetimes.AccessToken, lifetimes.RefreshToken, lifetimes.PasswordReset, lifetimes.BookingPayment, lifetimes.SeatHold, lifetimes.IdempotencyKey} {
+		if lifetime <= 0 {
+			problems = append(problems, "token, code, hold and payment lifetimes must be positive")
+			break
+		}
+	}
+	if lifetimes.AccessToken >= lifetimes.RefreshToken {
+		problems = append(problems, "access tokens must expire before refresh tokens")
+	}
+
+	switch cfg.JWT.Algorithm {
+	case "HS256":
+		if cfg.JWT.Secret == "" {
+			problems = append(problems, "JWT_SECRET is required to sign access tokens with HS256")
+		} else if len(cfg.JWT.Secret) < 32 {
+			problems = append(problems, "JWT_SECRET must be at least 32 bytes long")
+		}
+	case "EdDSA":
+		if cfg.JWT.PrivateKeyFile == "" {
+			problems = append(problems, "the EdDSA algorithm needs a private key file")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("unknown JWT algorithm %q, use HS256 or EdDSA", cfg.JWT.Algorithm))
+	}
+
+	mail := cfg.Mail
+	switch mail.Mailer {
+	case "smtp":
+		if mail.SMTPServer == "" {
+			problems = append(problems, "the SMTP server is required to send emails over SMTP")
+		}
+		if mail.SMTPPort < 1 || mail.SMTPPort > 65535 {
+			problems = append(problems, "the SMTP port must be between 1 and 65535")
+		}
+	case "file":
+		if mail.Dir == "" {
+			problems = append(problems, "the mail directory is required to write emails to files")
+		}
+	case "memory":
+	default:
+		problems = append(problems, fmt.Sprintf("unknown mailer %q, use smtp, file or memory", mail.Mailer))
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration: %s", strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+// loadFile reads the KEY=VALUE lines of a config file
+func loadFile(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	values := map[string]string{}
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("%s:%d: expected KEY=VALUE", path, lineNumber)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		values[key] = value
+	}
+	return values, scanner.Err()
+}
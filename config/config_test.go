@@ -0,0 +1,81 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.env")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadFileAndEnvironment(t *testing.T) {
+	path := writeFile(t, `# settings
+PROJECT_PASS=secret
+PROJECT_HOST=file-host
+SEAT_HOLD_TTL="5m"
+JWT_SECRET=a file secret of at least 32 bytes
+`)
+	t.Setenv("PROJECT_HOST", "env-host")
+
+	cfg, err := Load([]string{"-config", path, "-db-name", "flagdb"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Database.Host != "env-host" {
+		t.Errorf("host = %q, the environment must override the file", cfg.Database.Host)
+	}
+	if cfg.Database.Password != "secret" || cfg.Database.Name != "flagdb" {
+		t.Errorf("password = %q, name = %q", cfg.Database.Password, cfg.Database.Name)
+	}
+	if cfg.Lifetimes.SeatHold != 5*time.Minute || cfg.Lifetimes.AccessToken != 15*time.Minute {
+		t.Errorf("lifetimes = %+v", cfg.Lifetimes)
+	}
+	if cfg.JWT.Secret != "a file secret of at least 32 bytes" {
+		t.Errorf("JWT secret = %q", cfg.JWT.Secret)
+	}
+	if cfg.Mail.Mailer != "file" {
+		t.Errorf("mailer = %q, want file without an SMTP server", cfg.Mail.Mailer)
+	}
+	if _, set := os.LookupEnv("JWT_SECRET"); set {
+		t.Error("the config file was exported to the environment")
+	}
+}
+
+func TestLoadRejectsInvalidValues(t *testing.T) {
+	tests := []struct {
+		key, value, problem string
+	}{
+		{"PROJECT_PASS", "", "database password is required"},
+		{"SEAT_HOLD_TTL", "soon", "SEAT_HOLD_TTL must be a duration"},
+		{"BOOKING_PAYMENT_TTL", "-1m", "lifetimes must be positive"},
+		{"ACCESS_TOKEN_TTL", "2000h", "access tokens must expire before refresh tokens"},
+		{"APP_BASE_URL", "example.com", "base URL"},
+		{"JWT_ALGORITHM", "RS256", "unknown JWT algorithm"},
+		{"JWT_SECRET", "", "JWT_SECRET is required"},
+		{"JWT_SECRET", "short", "JWT_SECRET must be at least 32 bytes long"},
+		{"MAILER", "pigeon", "unknown mailer"},
+		{"SMTP_INSECURE", "maybe", "SMTP_INSECURE must be true or false"},
+		{"PAYMENT_PROVIDER", "cash", "unknown payment provider"},
+		{"FARE_RULES", "[{", "invalid fare rules"},
+		{"DEFAULT_CURRENCY", "lira", "default currency"},
+	}
+	for _, test := range tests {
+		t.Run(test.key, func(t *testing.T) {
+			t.Setenv("PROJECT_PASS", "secret")
+			t.Setenv(test.key, test.value)
+			_, err := Load(nil)
+			if err == nil || !strings.Contains(err.Error(), test.problem) {
+				t.Errorf("Load with %s=%q = %v, want an error about %q", test.key, test.value, err, test.problem)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package controllers
+
+import (
+	"net/http"
+	"project/models"
+	"project/store"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AirportRepo struct {
+	Airports store.Airports
+}
+
+// airportRequest is the body of POST /airports and PUT /airports/:id
+type airportRequest struct {
+	IATA      string  `json:"iata" binding:"required,len=3"`
+	ICAO      string  `json:"icao" binding:"omitempty,len=4"`
+	Name      string  `json:"name" binding:"required"`
+	City      string  `json:"city" binding:"required"`
+	Country   string  `json:"country" binding:"required"`
+	Latitude  float64 `json:"latitude" binding:"min=-90,max=90"`
+	Longitude float64 `json:"longitude" binding:"min=-180,max=180"`
+	Timezone  string  `json:"timezone" binding:"required,timezone"`
+}
+
+// bindAirport reads and checks the airport of the request
+func bindAirport(c *gin.Context) (models.Airport, bool) {
+	var request airportRequest
+	if !bindJSON(c, &request) {
+		return models.Airport{}, false
+	}
+	airport := models.Airport{
+		IATA:      request.IATA,
+		ICAO:      request.ICAO,
+		Name:      request.Name,
+		City:      request.City,
+		Country:   request.Country,
+		Latitude:  request.Latitude,
+		Longitude: request.Longitude,
+		Timezone:  request.Timezone,
+	}
+	if err := airport.Validate(); err != nil {
+		abortWithError(c, validationFailed(err.Error()))
+		return airport, false
+	}
+	return airport, true
+}
+
+func NewAirportController(repos store.Repositories) *AirportRepo {
+	return &AirportRepo{Airports: repos.Airports}
+}
+
+func (repository *AirportRepo) CreateAirport(c *gin.Context) {
+	airport, ok := bindAirport(c)
+	if !ok {
+		return
+	}
+	err := repository.Airports.Create(&airport)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, newAirportResponse(airport))
+}
+
+var airportListSpec = listSpec{
+	Sorts: map[string]string{
+		"iata":    "iata",
+		"city":    "city",
+		"country": "country",
+	},
+	DefaultSort: "iata",
+	Filters: []listFilter{
+		{Param: "country", Column: "country", Operator: store.Equal, Kind: "string"},
+		{Param: "city", Column: "city", Operator: store.Equal, Kind: "string"},
+	},
+}
+
+func (repository *AirportRepo) GetAirports(c *gin.Context) {
+	params, err := parseListParams(c, airportListSpec)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	var airports []models.Airport
+	total, err := repository.Airports.List(&airports, params.query())
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	setPageHeaders(c, params, total)
+	c.JSON(http.StatusOK, newAirportResponses(airports))
+}
+
+// Autocomplete airports by code, city or name: /airports/search?q=ist&limit=10
+func (repository *AirportRepo) SearchAirports(c *gin.Context) {
+	q := c.Query("q")
+	if len(q) < 2 {
+		abortWithError(c, invalidRequest("q must be at least 2 characters"))
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil || limit < 1 || limit > 50 {
+		abortWithError(c, invalidRequest("limit must be between 1 and 50"))
+		return
+	}
+
+	var airports []models.Airport
+	err = repository.Airports.Search(&airports, q, limit)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, newAirportResponses(airports))
+}
+
+func (repository *AirportRepo) GetAirport(c *gin.Context) {
+	id := c.Param("id")
+	var airport models.Airport
+	err := repository.Airports.Get(&airport, id)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, newAirportResponse(airport))
+}
+
+func (repository *AirportRepo) UpdateAirport(c *gin.Context) {
+	id := c.Param("id")
+	airport, ok := bindAirport(c)
+	if !ok {
+		return
+	}
+	err := repository.Airports.Update(&airport, id)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, newAirportResponse(airport))
+}
+
+func (repository *AirportRepo) DeleteAirport(c *gin.Context) {
+	id := c.Param("id")
+	var airport models.Airport
+	err := repository.Airports.Get(&airport, id)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	err = repository.Airports.Delete(&airport, id)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "Airport deleted"})
+}
@@ -1,93 +1,173 @@
 package controllers
 
 import (
-	"errors"
 	"net/http"
-	"project/database"
+	"project/config"
 	"project/models"
+	"project/payments"
+	"project/store"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 )
 
 type BTicketRepo struct {
-	Db *gorm.DB
+	Bookings     store.Bookings
+	Tickets      store.Tickets
+	Users        store.Users
+	Emails       Emails
+	Payments     payments.Gateway
+	RefundPolicy models.RefundPolicy
 }
 
-func NewBTicketController() *BTicketRepo {
-	db := database.InitDb()
-	db.AutoMigrate(&models.BTicket{})
-	return &BTicketRepo{Db: db}
+// bTicketRequest is the body of POST /btickets and PUT /btickets/:id
+type bTicketRequest struct {
+	TicketID int `json:"ticket_id" binding:"required"`
+	UserID   int `json:"user_id" binding:"required"`
+}
+
+func NewBTicketController(repos store.Repositories, cfg config.Config, services Services) *BTicketRepo {
+	return &BTicketRepo{
+		Bookings:     repos.Bookings,
+		Tickets:      repos.Tickets,
+		Users:        repos.Users,
+		Emails:       NewEmails(repos, cfg),
+		Payments:     services.Payments,
+		RefundPolicy: refundPolicy(cfg.FareRules),
+	}
 }
 
 func (repository *BTicketRepo) CreateBTicket(c *gin.Context) {
-	var bTicket models.BTicket
-	c.BindJSON(&bTicket)
-	err := models.CreateBTicket(repository.Db, &bTicket)
+	var request bTicketRequest
+	if !bindJSON(c, &request) {
+		return
+	}
+	bTicket := models.BTicket{TicketID: request.TicketID, UserID: request.UserID}
+	err := repository.Bookings.CreateBTicket(&bTicket)
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		abortWithError(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, bTicket)
+	c.JSON(http.StatusOK, newBTicketResponse(bTicket))
+}
+
+var bTicketListSpec = listSpec{
+	Sorts: map[string]string{
+		"id":      "id",
+		"created": "created_at",
+	},
+	DefaultSort: "-id",
+	Filters: []listFilter{
+		{Param: "user_id", Column: "user_id", Operator: store.Equal, Kind: "int"},
+		{Param: "ticket_id", Column: "ticket_id", Operator: store.Equal, Kind: "int"},
+	},
 }
 
 func (repository *BTicketRepo) GetBTickets(c *gin.Context) {
+	params, err := parseListParams(c, bTicketListSpec)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	query := params.query()
+	// Customers only ever see their own bookings
+	if c.GetString("user_role") == models.RoleCustomer {
+		query = query.Where("user_id", store.Equal, c.GetInt("user_id"))
+	}
 	var bTickets []models.BTicket
-	err := models.GetBTickets(repository.Db, &bTickets)
+	total, err := repository.Bookings.ListBTickets(&bTickets, query)
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		abortWithError(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, bTickets)
+	setPageHeaders(c, params, total)
+	c.JSON(http.StatusOK, newBTicketResponses(bTickets))
 }
 
 func (repository *BTicketRepo) GetBTicket(c *gin.Context) {
 	id := c.Param("id")
 	var bTicket models.BTicket
-	err := models.GetBTicket(repository.Db, &bTicket, id)
+	err := repository.Bookings.GetBTicket(&bTicket, id)
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.AbortWithStatus(http.StatusNotFound)
-			return
-		}
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		abortWithError(c, err)
+		return
+	}
+	// Customers can't see other users' bookings
+	if c.GetString("user_role") == models.RoleCustomer && bTicket.UserID != c.GetInt("user_id") {
+		abortWithError(c, store.ErrNotFound)
 		return
 	}
-	c.JSON(http.StatusOK, bTicket)
+	c.JSON(http.StatusOK, newBTicketResponse(bTicket))
 }
 
 func (repository *BTicketRepo) UpdateBTicket(c *gin.Context) {
 	id := c.Param("id")
-	var bTicket models.BTicket
-	c.BindJSON(&bTicket)
-	err := models.UpdateBTicket(repository.Db, &bTicket, id)
+	var request bTicketRequest
+	if !bindJSON(c, &request) {
+		return
+	}
+	bTicket := models.BTicket{TicketID: request.TicketID, UserID: request.UserID}
+	err := repository.Bookings.UpdateBTicket(&bTicket, id)
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.AbortWithStatus(http.StatusNotFound)
-			return
-		}
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		abortWithError(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, bTicket)
+	c.JSON(http.StatusOK, newBTicketResponse(bTicket))
 }
 
-func (repository *BTicketRepo) DeleteBTicket(c *gin.Context) {
+// Cancel a booked ticket, the seat goes back on sale and paid tickets are
+// refunded following the fare rules
+func (repository *BTicketRepo) CancelBTicket(c *gin.Context) {
 	id := c.Param("id")
 	var bTicket models.BTicket
-	err := models.GetBTicket(repository.Db, &bTicket, id)
+	err := repository.Bookings.GetBTicket(&bTicket, id)
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.AbortWithStatus(http.StatusNotFound)
-			return
-		}
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		abortWithError(c, err)
+		return
+	}
+	if !isSelfOrRole(c, strconv.Itoa(bTicket.UserID), models.RoleAgent, models.RoleAdmin) {
+		abortWithError(c, store.ErrNotFound)
+		return
+	}
+	reason, ok := cancelReason(c)
+	if !ok {
+		return
+	}
+	repository.cancel(c, id, reason)
+}
+
+// Booked tickets are cancelled rather than deleted, so the seat is given
+// back and the refund can be reported on
+func (repository *BTicketRepo) DeleteBTicket(c *gin.Context) {
+	reason, ok := cancelReason(c)
+	if !ok {
 		return
 	}
-	err = models.DeleteBTicket(repository.Db, &bTicket, id)
+	repository.cancel(c, c.Param("id"), reason)
+}
+
+func (repository *BTicketRepo) cancel(c *gin.Context, id string, reason string) {
+	var bTicket models.BTicket
+	var refund models.Refund
+	err := repository.Bookings.CancelBTicket(&bTicket, id, c.GetInt("user_id"), reason, repository.RefundPolicy, &refund)
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		abortWithError(c, err)
+		return
+	}
+	var ticket models.Ticket
+	if err := repository.Tickets.Get(&ticket, strconv.Itoa(bTicket.TicketID)); err == nil {
+		var refunds []models.Refund
+		if refund.ID != 0 {
+			refunds = append(refunds, refund)
+		}
+		queueCancellationEmail(repository.Users, repository.Emails, bTicket.UserID, "", reason, []models.Ticket{ticket}, refunds)
+	}
+	if refund.ID == 0 {
+		// the ticket was not paid for
+		c.JSON(http.StatusOK, gin.H{"status": "Booked Ticket cancelled", "bticket": newBTicketResponse(bTicket)})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"status": "Booked Ticket deleted"})
+	refunds := []models.Refund{refund}
+	refundPayments(c, repository.Bookings, repository.Payments, refunds)
+	c.JSON(http.StatusOK, gin.H{"status": "Booked Ticket cancelled", "bticket": newBTicketResponse(bTicket), "refund": newRefundResponse(refunds[0])})
 }
@@ -0,0 +1,234 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"project/config"
+	"project/models"
+	"project/payments"
+	"project/store"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type BookingRepo struct {
+	Bookings     store.Bookings
+	Users        store.Users
+	Emails       Emails
+	Payments     payments.Gateway
+	RefundPolicy models.RefundPolicy
+	// PaymentTTL is how long a new booking waits for payment
+	PaymentTTL time.Duration
+}
+
+type passengerRequest struct {
+	FirstName      string `json:"first_name" binding:"required"`
+	LastName       string `json:"last_name" binding:"required"`
+	DateOfBirth    string `json:"date_of_birth" binding:"required,datetime=2006-01-02"` // YYYY-MM-DD
+	DocumentNumber string `json:"document_number" binding:"required"`
+	Type           string `json:"type" binding:"required"` // ADT, CHD or INF
+}
+
+type bookingRequest struct {
+	TicketIDs  []int              `json:"ticket_ids" binding:"required,min=1"`
+	Passengers []passengerRequest `json:"passengers" binding:"required,min=1,dive"`
+	// Seats optionally picks the seats of each ticket, in the order of
+	// TicketIDs, one per passenger but infants
+	Seats [][]string `json:"seats"`
+}
+
+// bookTicketRequest is the body of POST /tickets/:ticket_id/book
+type bookTicketRequest struct {
+	Passengers []passengerRequest `json:"passengers" binding:"required,min=1,dive"`
+	Seats      []string           `json:"seats"`
+}
+
+func NewBookingController(repos store.Repositories, cfg config.Config, services Services) *BookingRepo {
+	return &BookingRepo{
+		Bookings:     repos.Bookings,
+		Users:        repos.Users,
+		Emails:       NewEmails(repos, cfg),
+		Payments:     services.Payments,
+		RefundPolicy: refundPolicy(cfg.FareRules),
+		PaymentTTL:   cfg.Lifetimes.BookingPayment,
+	}
+}
+
+// Book tickets for several passengers under one locator, the booking is
+// confirmed once it is paid
+func (repository *BookingRepo) CreateBooking(c *gin.Context) {
+	var request bookingRequest
+	if !bindJSON(c, &request) {
+		return
+	}
+	repository.createBooking(c, request.TicketIDs, request.Passengers, request.Seats)
+}
+
+// Book a single ticket, the same as POST /bookings with one ticket
+func (repository *BookingRepo) BookTicket(c *gin.Context) {
+	ticketID, err := strconv.Atoi(c.Param("ticket_id"))
+	if err != nil {
+		abortWithError(c, notFound("Ticket not found"))
+		return
+	}
+	var request bookTicketRequest
+	if !bindJSON(c, &request) {
+		return
+	}
+	var seats [][]string
+	if len(request.Seats) > 0 {
+		seats = [][]string{request.Seats}
+	}
+	repository.createBooking(c, []int{ticketID}, request.Passengers, seats)
+}
+
+// createBooking books the tickets for the passengers of the current user and
+// answers with the booking, which waits for payment
+func (repository *BookingRepo) createBooking(c *gin.Context, ticketIDs []int, requests []passengerRequest, seats [][]string) {
+	passengers, ok := newPassengers(c, requests)
+	if !ok {
+		return
+	}
+	paymentDueAt := time.Now().Add(repository.PaymentTTL)
+	booking := models.Booking{UserID: c.GetInt("user_id"), Passengers: passengers, PaymentDueAt: &paymentDueAt}
+
+	err := repository.Bookings.Create(&booking, ticketIDs, seats)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			abortWithError(c, notFound("Ticket not found"))
+			return
+		}
+		abortWithError(c, err)
+		return
+	}
+
+	err = repository.Bookings.Get(&booking, booking.Locator)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, newBookingResponse(booking))
+}
+
+// newPassengers checks the passengers of a request, the request is aborted
+// when one is invalid
+func newPassengers(c *gin.Context, requests []passengerRequest) ([]models.Passenger, bool) {
+	var passengers []models.Passenger
+	for i, p := range requests {
+		dateOfBirth, err := time.Parse("2006-01-02", p.DateOfBirth)
+		if err != nil {
+			abortWithError(c, invalidField(fmt.Sprintf("passengers[%d].date_of_birth", i), "must be formatted like 2006-01-02"))
+			return nil, false
+		}
+		passenger := models.Passenger{
+			FirstName:      p.FirstName,
+			LastName:       p.LastName,
+			DateOfBirth:    dateOfBirth,
+			DocumentNumber: p.DocumentNumber,
+			Type:           strings.ToUpper(p.Type),
+		}
+		if err := passenger.Validate(); err != nil {
+			abortWithError(c, invalidField(fmt.Sprintf("passengers[%d]", i), err.Error()))
+			return nil, false
+		}
+		passengers = append(passengers, passenger)
+	}
+	return passengers, true
+}
+
+var bookingListSpec = listSpec{
+	Sorts: map[string]string{
+		"id":      "id",
+		"created": "created_at",
+	},
+	DefaultSort: "-id",
+	Filters: []listFilter{
+		{Param: "user_id", Column: "user_id", Operator: store.Equal, Kind: "int"},
+		{Param: "status", Column: "status", Operator: store.Equal, Kind: "string"},
+	},
+}
+
+// List bookings, customers only see their own
+func (repository *BookingRepo) GetBookings(c *gin.Context) {
+	params, err := parseListParams(c, bookingListSpec)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	query := params.query()
+	if c.GetString("user_role") == models.RoleCustomer {
+		query = query.Where("user_id", store.Equal, c.GetInt("user_id"))
+	}
+	var bookings []models.Booking
+	total, err := repository.Bookings.List(&bookings, query)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	setPageHeaders(c, params, total)
+	c.JSON(http.StatusOK, newBookingResponses(bookings))
+}
+
+// Find a booking by locator and a passenger last name, without logging in:
+// /bookings/K7QX2M?last_name=Yilmaz. Passenger documents are masked.
+func (repository *BookingRepo) FindBooking(c *gin.Context) {
+	var booking models.Booking
+	err := repository.Bookings.Find(&booking, c.Param("locator"), c.Query("last_name"))
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, newPublicBookingResponse(booking))
+}
+
+// Cancel a booking with all of its booked tickets, paid bookings are
+// refunded following the fare rules
+func (repository *BookingRepo) CancelBooking(c *gin.Context) {
+	if _, ok := repository.ownBooking(c); !ok {
+		return
+	}
+	reason, ok := cancelReason(c)
+	if !ok {
+		return
+	}
+
+	var booking models.Booking
+	var refunds []models.Refund
+	err := repository.Bookings.Cancel(&booking, c.Param("locator"), c.GetInt("user_id"), reason, repository.RefundPolicy, &refunds)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	refundPayments(c, repository.Bookings, repository.Payments, refunds)
+	err = repository.Bookings.Get(&booking, c.Param("locator"))
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	var tickets []models.Ticket
+	for _, segment := range booking.Segments {
+		tickets = append(tickets, segment.Ticket)
+	}
+	queueCancellationEmail(repository.Users, repository.Emails, booking.UserID, booking.Locator, reason, tickets, refunds)
+	c.JSON(http.StatusOK, gin.H{"booking": newBookingResponse(booking), "refunds": newRefundResponses(refunds)})
+}
+
+// ownBooking loads the booking of the request and makes sure it belongs to
+// the current user. Agents and admins can act on any booking.
+func (repository *BookingRepo) ownBooking(c *gin.Context) (models.Booking, bool) {
+	var booking models.Booking
+	err := repository.Bookings.Get(&booking, c.Param("locator"))
+	if err != nil {
+		abortWithError(c, err)
+		return booking, false
+	}
+	if !isSelfOrRole(c, strconv.Itoa(booking.UserID), models.RoleAgent, models.RoleAdmin) {
+		abortWithError(c, store.ErrNotFound)
+		return booking, false
+	}
+	return booking, true
+}
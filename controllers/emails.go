@@ -0,0 +1,131 @@
+package controllers
+
+import (
+	"project/mail"
+	"project/models"
+	"project/store"
+	"strconv"
+	"time"
+)
+
+// data of the email templates
+
+type activationEmail struct {
+	Name      string
+	Link      string
+	ExpiresAt time.Time
+}
+
+type passwordResetEmail struct {
+	Name      string
+	Link      string
+	ExpiresAt time.Time
+}
+
+type flightSummary struct {
+	From        string
+	To          string
+	DepartureAt time.Time // in the time zone of the departure airport
+	ArrivalAt   time.Time // in the time zone of the arrival airport
+}
+
+type bookingConfirmedEmail struct {
+	Name       string
+	Locator    string
+	Flights    []flightSummary
+	Passengers []string
+	Amount     int64
+	Currency   string
+}
+
+type bookingCancelledEmail struct {
+	Name         string
+	Locator      string // empty for a single booked ticket
+	Reason       string
+	Flights      []flightSummary
+	RefundAmount int64
+	Currency     string
+}
+
+type flightChangedEmail struct {
+	Name string
+	Old  flightSummary
+	New  flightSummary
+}
+
+// summarizeFlight describes a ticket with its airports loaded
+func summarizeFlight(ticket models.Ticket) flightSummary {
+	return flightSummary{
+		From:        airportName(ticket.FromAirport),
+		To:          airportName(ticket.ToAirport),
+		DepartureAt: ticket.DepartureAt.In(ticket.FromAirport.Location()),
+		ArrivalAt:   ticket.ArrivalAt.In(ticket.ToAirport.Location()),
+	}
+}
+
+func airportName(airport models.Airport) string {
+	if airport.City == "" {
+		return airport.IATA
+	}
+	return airport.City + " (" + airport.IATA + ")"
+}
+
+// queueBookingConfirmedEmail tells the owner of a paid booking that it is confirmed
+func queueBookingConfirmedEmail(users store.Users, emails Emails, booking models.Booking, payment models.Payment) error {
+	var user models.User
+	err := users.Get(&user, strconv.Itoa(booking.UserID))
+	if err != nil {
+		return err
+	}
+	data := bookingConfirmedEmail{
+		Name:     user.Username,
+		Locator:  booking.Locator,
+		Amount:   payment.Amount,
+		Currency: payment.Currency,
+	}
+	for _, segment := range booking.Segments {
+		data.Flights = append(data.Flights, summarizeFlight(segment.Ticket))
+	}
+	for _, passenger := range booking.Passengers {
+		data.Passengers = append(data.Passengers, passenger.FirstName+" "+passenger.LastName)
+	}
+	return emails.queueTemplate(user.Email, user.Locale, mail.TemplateBookingConfirmed, data)
+}
+
+// queueCancellationEmail tells the owner of cancelled booked tickets what
+// was cancelled and what is refunded. locator is empty for a single ticket.
+func queueCancellationEmail(users store.Users, emails Emails, userID int, locator string, reason string, tickets []models.Ticket, refunds []models.Refund) error {
+	var user models.User
+	err := users.Get(&user, strconv.Itoa(userID))
+	if err != nil {
+		return err
+	}
+	data := bookingCancelledEmail{Name: user.Username, Locator: locator, Reason: reason}
+	for _, ticket := range tickets {
+		data.Flights = append(data.Flights, summarizeFlight(ticket))
+	}
+	for _, refund := range refunds {
+		data.RefundAmount += refund.Amount
+		data.Currency = refund.Currency
+	}
+	return emails.queueTemplate(user.Email, user.Locale, mail.TemplateBookingCancelled, data)
+}
+
+// queueFlightChangedEmails tells everyone holding a ticket on a flight that
+// its airports or times changed. Nothing is sent when neither did.
+func queueFlightChangedEmails(users store.Users, emails Emails, before models.Ticket, after models.Ticket) error {
+	if before.FromAirportID == after.FromAirportID && before.ToAirportID == after.ToAirportID &&
+		before.DepartureAt.Equal(after.DepartureAt) && before.ArrivalAt.Equal(after.ArrivalAt) {
+		return nil
+	}
+	var holders []models.User
+	err := users.ListByTicket(&holders, after.ID)
+	if err != nil {
+		return err
+	}
+	for _, user := range holders {
+		data := flightChangedEmail{Name: user.Username, Old: summarizeFlight(before), New: summarizeFlight(after)}
+		emails.queueTemplate(user.Email, user.Locale, mail.TemplateFlightChanged, data)
+	}
+	return nil
+}
@@ -0,0 +1,318 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"project/models"
+	"project/payments"
+	"project/store"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// Every error response has the same body:
+//
+//	{"error": {"code": "validation_failed", "message": "Request is invalid",
+//	           "fields": [{"field": "passengers[0].last_name", "message": "is required"}]}}
+//
+// code is meant for programs and does not change, message is meant for
+// people. fields is only set for validation failures.
+
+type apiError struct {
+	Status  int          `json:"-"`
+	Code    string       `json:"code"`
+	Message string       `json:"message"`
+	Fields  []fieldError `json:"fields,omitempty"`
+}
+
+type fieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (err *apiError) Error() string {
+	return err.Message
+}
+
+// general error codes, known errors of the models have codes of their own
+const (
+	codeInvalidRequest = "invalid_request"   // 400, the body or query can't be read
+	codeValidation     = "validation_failed" // 422, the request is well formed but invalid
+	codeUnauthorized   = "unauthorized"
+	codeTokenExpired   = "token_expired"
+	codeTokenRevoked   = "token_revoked"
+	codeForbidden      = "forbidden"
+	codeNotFound       = "not_found"
+	codeInternal       = "internal_error"
+	codePaymentFailed  = "payment_provider_error"
+)
+
+func invalidRequest(message string) *apiError {
+	return &apiError{Status: http.StatusBadRequest, Code: codeInvalidRequest, Message: message}
+}
+
+// validationFailed is a 422 for the request as a whole
+func validationFailed(message string) *apiError {
+	return &apiError{Status: http.StatusUnprocessableEntity, Code: codeValidation, Message: message}
+}
+
+// invalidField is a 422 for one field of the request
+func invalidField(field string, message string) *apiError {
+	return &apiError{
+		Status:  http.StatusUnprocessableEntity,
+		Code:    codeValidation,
+		Message: "Request is invalid",
+		Fields:  []fieldError{{Field: field, Message: message}},
+	}
+}
+
+// invalidPassword lists the rules of the password policy a password breaks,
+// other errors are returned as they are
+func invalidPassword(field string, err error) error {
+	var policyErr *models.PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		return err
+	}
+	apiErr := validationFailed("Request is invalid")
+	for _, problem := range policyErr.Problems {
+		apiErr.Fields = append(apiErr.Fields, fieldError{Field: field, Message: problem})
+	}
+	return apiErr
+}
+
+func unauthorized(message string) *apiError {
+	return &apiError{Status: http.StatusUnauthorized, Code: codeUnauthorized, Message: message}
+}
+
+func forbidden(message string) *apiError {
+	return &apiError{Status: http.StatusForbidden, Code: codeForbidden, Message: message}
+}
+
+func notFound(message string) *apiError {
+	return &apiError{Status: http.StatusNotFound, Code: codeNotFound, Message: message}
+}
+
+// knownErrors gives the status and code of the errors the models return
+var knownErrors = []struct {
+	err    error
+	status int
+	code   string
+}{
+	{store.ErrNotFound, http.StatusNotFound, codeNotFound},
+
+	{models.ErrTicketSoldOut, http.StatusConflict, "sold_out"},
+	{models.ErrSeatUnavailable, http.StatusConflict, "seat_unavailable"},
+	{models.ErrAlreadyCancelled, http.StatusConflict, "already_cancelled"},
+	{models.ErrBTicketOfBooking, http.StatusConflict, "bticket_of_booking"},
+	{models.ErrUsernameTaken, http.StatusConflict, "username_taken"},
+	{models.ErrEmailTaken, http.StatusConflict, "email_taken"},
+	{models.ErrSeatMapInUse, http.StatusConflict, "seat_map_in_use"},
+	{models.ErrCapacityBelowBooked, http.StatusConflict, "capacity_below_booked"},
+	{models.ErrPlaneChangeBooked, http.StatusConflict, "plane_change_booked"},
+	{models.ErrHoldNotActive, http.StatusConflict, "hold_not_active"},
+	{models.ErrBookingNotPending, http.StatusConflict, "booking_not_pending"},
+	{models.ErrPaymentNotPending, http.StatusConflict, "payment_not_pending"},
+	{models.ErrNothingToRefund, http.StatusConflict, "nothing_to_refund"},
+
+	{models.ErrHoldExpired, http.StatusGone, "hold_expired"},
+	{models.ErrPaymentOverdue, http.StatusGone, "payment_overdue"},
+	{models.ErrActivationCodeExpired, http.StatusGone, "activation_code_expired"},
+	{models.ErrResetTokenExpired, http.StatusGone, "reset_token_expired"},
+
+	{models.ErrActivationCodeInvalid, http.StatusBadRequest, "activation_code_invalid"},
+	{models.ErrResetTokenInvalid, http.StatusBadRequest, "reset_token_invalid"},
+
+	{models.ErrInvalidPassengers, http.StatusUnprocessableEntity, "invalid_passengers"},
+	{models.ErrNoSegments, http.StatusUnprocessableEntity, "no_segments"},
+	{models.ErrDuplicateSegment, http.StatusUnprocessableEntity, "duplicate_segment"},
+	{models.ErrMixedCurrency, http.StatusUnprocessableEntity, "mixed_currency"},
+	{models.ErrNoSeats, http.StatusUnprocessableEntity, "no_seats"},
+	{models.ErrSeatNotFound, http.StatusUnprocessableEntity, "seat_not_found"},
+	{models.ErrNoSeatMap, http.StatusUnprocessableEntity, "no_seat_map"},
+	{models.ErrHoldSeatCount, http.StatusUnprocessableEntity, "hold_seat_count"},
+	{models.ErrSegmentSeatCount, http.StatusUnprocessableEntity, "segment_seat_count"},
+	{models.ErrHoldPassengerCount, http.StatusUnprocessableEntity, "hold_passenger_count"},
+
+	{models.ErrRefreshTokenInvalid, http.StatusUnauthorized, "refresh_token_invalid"},
+	{models.ErrRefreshTokenExpired, http.StatusUnauthorized, "refresh_token_expired"},
+	{models.ErrRefreshTokenReused, http.StatusUnauthorized, "refresh_token_reused"},
+
+	{payments.ErrDeclined, http.StatusPaymentRequired, "payment_declined"},
+	{payments.ErrInvalidCard, http.StatusPaymentRequired, "card_invalid"},
+	{payments.ErrChallengeFailed, http.StatusPaymentRequired, "challenge_failed"},
+	{payments.ErrTimeout, http.StatusGatewayTimeout, "payment_timeout"},
+	{context.DeadlineExceeded, http.StatusGatewayTimeout, "payment_timeout"},
+}
+
+// toAPIError returns the error response for err. Unknown errors become a
+// 500 whose message hides the details, they are logged instead.
+func toAPIError(err error) *apiError {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	var policyErr *models.PasswordPolicyError
+	if errors.As(err, &policyErr) {
+		return invalidPassword("password", err).(*apiError)
+	}
+	for _, known := range knownErrors {
+		if errors.Is(err, known.err) {
+			message := err.Error()
+			if known.err == store.ErrNotFound {
+				message = "Not found"
+			}
+			return &apiError{Status: known.status, Code: known.code, Message: message}
+		}
+	}
+	log.Printf("Internal error: %s\n", err)
+	return &apiError{Status: http.StatusInternalServerError, Code: codeInternal, Message: "Internal server error"}
+}
+
+// abortWithError answers the request with the error response for err
+func abortWithError(c *gin.Context, err error) {
+	apiErr := toAPIError(err)
+	c.AbortWithStatusJSON(apiErr.Status, gin.H{"error": apiErr})
+}
+
+// bindJSON reads the JSON body of the request into request and checks its
+// binding tags. On failure it answers 400 for a body that can't be read or
+// 422 listing the invalid fields, and returns false.
+func bindJSON(c *gin.Context, request interface{}) bool {
+	err := c.ShouldBindJSON(request)
+	if err == nil {
+		return true
+	}
+	abortWithError(c, bindingError(err, request))
+	return false
+}
+
+// bindOptionalJSON is bindJSON for requests whose body may be left out
+func bindOptionalJSON(c *gin.Context, request interface{}) bool {
+	if c.Request.ContentLength <= 0 {
+		return true
+	}
+	return bindJSON(c, request)
+}
+
+// bindingError describes why request could not be bound
+func bindingError(err error, request interface{}) *apiError {
+	var validationErrs validator.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		apiErr := &apiError{Status: http.StatusUnprocessableEntity, Code: codeValidation, Message: "Request is invalid"}
+		for _, fieldErr := range validationErrs {
+			apiErr.Fields = append(apiErr.Fields, fieldError{Field: fieldPath(fieldErr, request), Message: fieldMessage(fieldErr)})
+		}
+		return apiErr
+	}
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return invalidField(typeErr.Field, "must be a "+jsonTypeName(typeErr.Type))
+	}
+	var timeErr *time.ParseError
+	if errors.As(err, &timeErr) {
+		return validationFailed("Times must be formatted like 2006-01-02T15:04:05+03:00")
+	}
+	if errors.Is(err, io.EOF) {
+		return invalidRequest("Request body is required")
+	}
+	return invalidRequest("Request body is not valid JSON")
+}
+
+// fieldPath names a field the way it is written in the JSON body, such as
+// passengers[0].last_name
+func fieldPath(fieldErr validator.FieldError, request interface{}) string {
+	namespace := fieldErr.Namespace()
+	// the namespace starts with the name of the request type, anonymous
+	// request structs have none
+	requestType := reflect.TypeOf(request)
+	for requestType != nil && requestType.Kind() == reflect.Ptr {
+		requestType = requestType.Elem()
+	}
+	if requestType != nil && requestType.Name() != "" {
+		return strings.TrimPrefix(namespace, requestType.Name()+".")
+	}
+	return namespace
+}
+
+// fieldMessage describes the binding tag a field failed
+func fieldMessage(fieldErr validator.FieldError) string {
+	param := fieldErr.Param()
+	counted := fieldErr.Kind() == reflect.String || fieldErr.Kind() == reflect.Slice || fieldErr.Kind() == reflect.Map
+	unit := "characters"
+	if fieldErr.Kind() != reflect.String {
+		unit = "items"
+	}
+	switch fieldErr.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "oneof":
+		return "must be one of " + strings.Join(strings.Fields(param), ", ")
+	case "len":
+		if counted {
+			return fmt.Sprintf("must be exactly %s %s long", param, unit)
+		}
+		return "must be " + param
+	case "min", "gte":
+		if counted {
+			return fmt.Sprintf("must have at least %s %s", param, unit)
+		}
+		return "must be at least " + param
+	case "max", "lte":
+		if counted {
+			return fmt.Sprintf("must have at most %s %s", param, unit)
+		}
+		return "must be at most " + param
+	case "datetime":
+		return "must be formatted like " + param
+	case "uppercase":
+		return "must be in upper case"
+	case "timezone":
+		return "must be an IANA timezone such as Europe/Istanbul"
+	}
+	return "is invalid"
+}
+
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "list"
+	}
+	return "object"
+}
+
+// Validation errors name fields by their JSON names
+func init() {
+	if engine, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		engine.RegisterTagNameFunc(func(field reflect.StructField) string {
+			name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+			if name == "-" {
+				return ""
+			}
+			if name == "" {
+				return field.Name
+			}
+			return name
+		})
+	}
+}
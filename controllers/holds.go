@@ -0,0 +1,139 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"project/models"
+	"project/store"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StartHoldExpiryWorker releases expired seat holds and the seats of bookings
+// that were not paid in time every interval, in the background. It also
+// forgets expired idempotency keys. A failing step is logged and does not
+// keep the others from running.
+func StartHoldExpiryWorker(repos store.Repositories, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			expired, err := repos.Bookings.ExpireHolds()
+			if err != nil {
+				log.Printf("Failed to release expired seat holds: %s\n", err)
+			} else if expired > 0 {
+				log.Printf("Released %d expired seat holds\n", expired)
+			}
+			expired, err = repos.Bookings.ExpireUnpaid()
+			if err != nil {
+				log.Printf("Failed to expire unpaid bookings: %s\n", err)
+			} else if expired > 0 {
+				log.Printf("Expired %d unpaid bookings\n", expired)
+			}
+			if _, err := repos.IdempotencyKeys.DeleteExpired(); err != nil {
+				log.Printf("Failed to delete expired idempotency keys: %s\n", err)
+			}
+		}
+	}()
+}
+
+// Hold seats of a ticket before paying for them
+func (repository *UserRepo) HoldTicket(c *gin.Context) {
+	var body struct {
+		Quantity int `json:"quantity" binding:"required,min=1,max=9"`
+	}
+	if !bindJSON(c, &body) {
+		return
+	}
+
+	hold := models.SeatHold{
+		UserID:   c.GetInt("user_id"),
+		Quantity: body.Quantity,
+	}
+	err := repository.Bookings.CreateHold(&hold, c.Param("ticket_id"), repository.Lifetimes.SeatHold)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			abortWithError(c, notFound("Ticket not found"))
+			return
+		}
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, newHoldResponse(hold))
+}
+
+func (repository *UserRepo) GetHold(c *gin.Context) {
+	hold, ok := repository.ownHold(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, newHoldResponse(hold))
+}
+
+// Book the passengers of a hold, the booking is confirmed once it is paid
+func (repository *UserRepo) ConfirmHold(c *gin.Context) {
+	if _, ok := repository.ownHold(c); !ok {
+		return
+	}
+
+	var body struct {
+		Passengers []passengerRequest `json:"passengers" binding:"required,min=1,dive"`
+		Seats      []string           `json:"seats"`
+	}
+	if !bindJSON(c, &body) {
+		return
+	}
+	passengers, ok := newPassengers(c, body.Passengers)
+	if !ok {
+		return
+	}
+
+	var hold models.SeatHold
+	paymentDueAt := time.Now().Add(repository.Lifetimes.BookingPayment)
+	booking := models.Booking{Passengers: passengers, PaymentDueAt: &paymentDueAt}
+	err := repository.Bookings.ConfirmHold(&hold, c.Param("id"), &booking, body.Seats)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	err = repository.Bookings.Get(&booking, booking.Locator)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"hold": newHoldResponse(hold), "booking": newBookingResponse(booking)})
+}
+
+// Give the seats of a hold back
+func (repository *UserRepo) ReleaseHold(c *gin.Context) {
+	if _, ok := repository.ownHold(c); !ok {
+		return
+	}
+
+	var hold models.SeatHold
+	err := repository.Bookings.ReleaseHold(&hold, c.Param("id"))
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, newHoldResponse(hold))
+}
+
+// ownHold loads the hold of the request and makes sure it belongs to the
+// current user. Agents and admins can act on any hold.
+func (repository *UserRepo) ownHold(c *gin.Context) (models.SeatHold, bool) {
+	var hold models.SeatHold
+	err := repository.Bookings.GetHold(&hold, c.Param("id"))
+	if err != nil {
+		abortWithError(c, err)
+		return hold, false
+	}
+	if !isSelfOrRole(c, strconv.Itoa(hold.UserID), models.RoleAgent, models.RoleAdmin) {
+		abortWithError(c, store.ErrNotFound)
+		return hold, false
+	}
+	return hold, true
+}
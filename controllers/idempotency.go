@@ -0,0 +1,180 @@
+package controllers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"project/config"
+	"project/models"
+	"project/store"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxIdempotencyKeyLength = 255
+
+var errRequestInProgress = &apiError{Status: http.StatusConflict, Code: "request_in_progress", Message: "A request with this Idempotency-Key is being processed, retry later"}
+
+type IdempotencyRepo struct {
+	IdempotencyKeys store.IdempotencyKeys
+	// TTL is how long responses are kept for replays
+	TTL time.Duration
+}
+
+func NewIdempotencyController(repos store.Repositories, cfg config.Config) *IdempotencyRepo {
+	return &IdempotencyRepo{IdempotencyKeys: repos.IdempotencyKeys, TTL: cfg.Lifetimes.IdempotencyKey}
+}
+
+// responseRecorder keeps a copy of what a handler writes
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (recorder *responseRecorder) Write(data []byte) (int, error) {
+	recorder.body.Write(data)
+	return recorder.ResponseWriter.Write(data)
+}
+
+func (recorder *responseRecorder) WriteString(s string) (int, error) {
+	recorder.body.WriteString(s)
+	return recorder.ResponseWriter.WriteString(s)
+}
+
+// IdempotencyMiddleware makes mutating requests sent with an Idempotency-Key
+// header safe to retry. The first request with a key runs and its response
+// is stored; later requests with the same key and the same method, path and
+// body get the stored response back without running again. Reusing a key for
+// a different request is rejected with 422, and a retry arriving while the
+// first request still runs gets 409.
+//
+// It goes after AuthMiddleware on authenticated routes, keys are per user.
+// Keys sent without authentication are per client address, method and path.
+// Requests without the header, server errors and panics are not remembered.
+func IdempotencyMiddleware(idempotencyRepo *IdempotencyRepo) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader("Idempotency-Key")
+		if key == "" || c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead || c.Request.Method == http.MethodOptions {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			abortWithError(c, invalidRequest("Idempotency-Key is too long"))
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			abortWithError(c, invalidRequest("Request body can't be read"))
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		fingerprint := sha256.New()
+		fingerprint.Write([]byte(c.Request.Method + " " + c.Request.URL.RequestURI() + "\n"))
+		fingerprint.Write(body)
+		record := models.IdempotencyKey{
+			Key:         key,
+			UserID:      c.GetInt("user_id"),
+			Method:      c.Request.Method,
+			Path:        c.Request.URL.RequestURI(),
+			Fingerprint: hex.EncodeToString(fingerprint.Sum(nil)),
+			Status:      models.IdempotencyInProgress,
+			ExpiresAt:   time.Now().Add(idempotencyRepo.TTL),
+		}
+		if record.UserID == 0 {
+			// anonymous clients share one keyspace, so their keys are scoped
+			// to the client and route and can't replay or block the requests
+			// of another
+			scoped := sha256.Sum256([]byte(c.ClientIP() + "\n" + record.Method + " " + c.Request.URL.Path + "\n" + key))
+			record.Key = "anonymous:" + hex.EncodeToString(scoped[:])
+		}
+
+		created, err := idempotencyRepo.IdempotencyKeys.Create(&record)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		var stored models.IdempotencyKey
+		if !created {
+			err = idempotencyRepo.IdempotencyKeys.Get(&stored, record.UserID, record.Key)
+			if err == nil && time.Now().After(stored.ExpiresAt) {
+				// expired but not cleaned up yet, the key can be used again
+				err = idempotencyRepo.IdempotencyKeys.Delete(stored.ID)
+				if err == nil {
+					created, err = idempotencyRepo.IdempotencyKeys.Create(&record)
+				}
+			}
+		}
+		if !created {
+			if err == nil {
+				err = idempotencyRepo.IdempotencyKeys.Get(&stored, record.UserID, record.Key)
+			}
+			if err != nil {
+				if errors.Is(err, store.ErrNotFound) {
+					// deleted since, by a failed first request or as expired
+					abortWithError(c, errRequestInProgress)
+					return
+				}
+				abortWithError(c, err)
+				return
+			}
+			replayIdempotentResponse(c, stored, record.Fingerprint)
+			return
+		}
+
+		// Unless the response is stored, the key is released so the client
+		// can retry the request for real, also when the handler panics
+		completed := false
+		defer func() {
+			if completed {
+				return
+			}
+			if err := idempotencyRepo.IdempotencyKeys.Delete(record.ID); err != nil {
+				log.Printf("Failed to delete Idempotency-Key %d: %s\n", record.ID, err)
+			}
+		}()
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		if recorder.Status() >= http.StatusInternalServerError {
+			return
+		}
+		record.ResponseStatus = recorder.Status()
+		record.ContentType = recorder.Header().Get("Content-Type")
+		record.ResponseBody = recorder.body.Bytes()
+		if err := idempotencyRepo.IdempotencyKeys.Complete(&record); err != nil {
+			log.Printf("Failed to store the response of Idempotency-Key %d: %s\n", record.ID, err)
+			return
+		}
+		completed = true
+	}
+}
+
+// replayIdempotentResponse answers a request whose key was used before
+func replayIdempotentResponse(c *gin.Context, stored models.IdempotencyKey, fingerprint string) {
+	if stored.Fingerprint != fingerprint {
+		abortWithError(c, &apiError{Status: http.StatusUnprocessableEntity, Code: "idempotency_key_reused", Message: "Idempotency-Key was already used for a different request"})
+		return
+	}
+	if stored.Status != models.IdempotencyCompleted {
+		abortWithError(c, errRequestInProgress)
+		return
+	}
+	c.Header("Idempotent-Replayed", "true")
+	if stored.ContentType == "" {
+		c.Status(stored.ResponseStatus)
+		c.Writer.WriteHeaderNow()
+		c.Abort()
+		return
+	}
+	c.Data(stored.ResponseStatus, stored.ContentType, stored.ResponseBody)
+	c.Abort()
+}
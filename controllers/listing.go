@@ -0,0 +1,151 @@
+package controllers
+
+import (
+	"fmt"
+	"net/url"
+	"project/models"
+	"project/store"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const defaultPageLimit = 20
+const maxPageLimit = 100
+
+// listSpec describes what clients may sort and filter a list endpoint on.
+type listSpec struct {
+	// Sorts maps the names accepted by sort= to columns
+	Sorts map[string]string
+	// DefaultSort is used when there is no sort=, e.g. "-id"
+	DefaultSort string
+	Filters     []listFilter
+}
+
+// listFilter maps a query parameter to a filter on a column.
+type listFilter struct {
+	Param    string
+	Column   string
+	Operator store.Operator
+	Kind     string // "int", "string", "bool", "time" or "price"
+}
+
+// listParams holds the validated paging, sorting and filter options of a request.
+type listParams struct {
+	page    int
+	limit   int
+	sorts   []store.Sort
+	filters []store.Filter
+}
+
+// parseListParams reads page, limit, sort and the filters of spec from the
+// query string. sort takes a comma separated list of names, prefixed with "-"
+// for descending order: sort=-departure,price
+func parseListParams(c *gin.Context, spec listSpec) (listParams, error) {
+	params := listParams{page: 1, limit: defaultPageLimit}
+
+	if page := c.Query("page"); page != "" {
+		value, err := strconv.Atoi(page)
+		if err != nil || value < 1 {
+			return params, invalidRequest("page must be a positive integer")
+		}
+		params.page = value
+	}
+	if limit := c.Query("limit"); limit != "" {
+		value, err := strconv.Atoi(limit)
+		if err != nil || value < 1 || value > maxPageLimit {
+			return params, invalidRequest(fmt.Sprintf("limit must be between 1 and %d", maxPageLimit))
+		}
+		params.limit = value
+	}
+
+	sortParam := c.DefaultQuery("sort", spec.DefaultSort)
+	for _, name := range strings.Split(sortParam, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		descending := strings.HasPrefix(name, "-")
+		name = strings.TrimPrefix(name, "-")
+		column, ok := spec.Sorts[name]
+		if !ok {
+			return params, invalidRequest(fmt.Sprintf("can't sort on %q", name))
+		}
+		params.sorts = append(params.sorts, store.Sort{Column: column, Descending: descending})
+	}
+
+	for _, filter := range spec.Filters {
+		text := c.Query(filter.Param)
+		if text == "" {
+			continue
+		}
+		value, err := parseFilterValue(filter.Kind, text)
+		if err != nil {
+			return params, invalidRequest(fmt.Sprintf("invalid %s: %s", filter.Param, err))
+		}
+		params.filters = append(params.filters, store.Filter{Column: filter.Column, Operator: filter.Operator, Value: value})
+	}
+
+	return params, nil
+}
+
+func parseFilterValue(kind string, text string) (interface{}, error) {
+	switch kind {
+	case "int":
+		return strconv.Atoi(text)
+	case "bool":
+		return strconv.ParseBool(text)
+	case "time":
+		// Either a full RFC 3339 timestamp or a day in server local time
+		if value, err := time.Parse(time.RFC3339, text); err == nil {
+			return value, nil
+		}
+		return time.ParseInLocation("2006-01-02", text, time.Local)
+	case "price":
+		amount, _, err := models.ParsePrice(text)
+		return amount, err
+	default:
+		return text, nil
+	}
+}
+
+// query returns the filters, order and page of params for a repository
+func (params listParams) query() store.ListQuery {
+	return store.ListQuery{
+		Filters: params.filters,
+		Sorts:   params.sorts,
+		Offset:  (params.page - 1) * params.limit,
+		Limit:   params.limit,
+	}
+}
+
+// setPageHeaders sets X-Total-Count and an RFC 8288 Link header pointing
+// to the first, previous, next and last pages.
+func setPageHeaders(c *gin.Context, params listParams, total int64) {
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+
+	lastPage := int((total + int64(params.limit) - 1) / int64(params.limit))
+	if lastPage < 1 {
+		lastPage = 1
+	}
+	link := func(page int, rel string) string {
+		u := url.URL{Path: c.Request.URL.Path}
+		query := c.Request.URL.Query()
+		query.Set("page", strconv.Itoa(page))
+		query.Set("limit", strconv.Itoa(params.limit))
+		u.RawQuery = query.Encode()
+		return fmt.Sprintf("<%s>; rel=\"%s\"", u.String(), rel)
+	}
+
+	links := []string{link(1, "first")}
+	if params.page > 1 {
+		links = append(links, link(params.page-1, "prev"))
+	}
+	if params.page < lastPage {
+		links = append(links, link(params.page+1, "next"))
+	}
+	links = append(links, link(lastPage, "last"))
+	c.Header("Link", strings.Join(links, ", "))
+}
@@ -0,0 +1,145 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"project/config"
+	"project/mail"
+	"project/models"
+	"project/store"
+	"strings"
+	"time"
+)
+
+// attempts before an email is given up
+const maxEmailAttempts = 10
+
+// how long a worker may take to send one email before others can retry it
+const emailSendTimeout = 2 * time.Minute
+
+// Emails renders the emails of the controllers and stores them in the
+// outbox, they are sent in the background
+type Emails struct {
+	Outbox    store.Outbox
+	Templates mail.Templates
+	// From is the sender shown to recipients
+	From string
+	// BaseURL is where the links in emails point to
+	BaseURL string
+}
+
+func NewEmails(repos store.Repositories, cfg config.Config) Emails {
+	from := cfg.Mail.SenderVisibleEmail
+	if cfg.Mail.SenderName != "" {
+		from = "\"" + cfg.Mail.SenderName + "\" <" + from + ">"
+	}
+	return Emails{Outbox: repos.Outbox, Templates: mail.NewTemplates(cfg.Mail), From: from, BaseURL: cfg.BaseURL}
+}
+
+// link returns the URL of path on the app with one query parameter
+func (emails Emails) link(path string, param string, value string) string {
+	return strings.TrimRight(emails.BaseURL, "/") + path + "?" + param + "=" + url.QueryEscape(value)
+}
+
+// queue stores an email in the outbox
+func (emails Emails) queue(to string, message mail.Message) error {
+	email := models.OutboxEmail{
+		From:    emails.From,
+		To:      to,
+		Subject: message.Subject,
+		Body:    message.Body,
+		HTML:    message.HTML,
+	}
+	return emails.Outbox.Queue(&email)
+}
+
+// queueTemplate renders an email template in the language of the recipient
+// and stores it in the outbox. Failures are logged and returned.
+func (emails Emails) queueTemplate(to string, locale string, template string, data interface{}) error {
+	message, err := emails.Templates.Render(template, locale, data)
+	if err == nil {
+		err = emails.queue(to, message)
+	}
+	if err != nil {
+		log.Printf("Error queueing %s email to %s: %s\n", template, to, err)
+		return err
+	}
+	return nil
+}
+
+// emailBackoff is how long to wait before attempt number attempts+1:
+// one minute, doubling up to an hour
+func emailBackoff(attempts int) time.Duration {
+	backoff := time.Minute
+	for i := 1; i < attempts && backoff < time.Hour; i++ {
+		backoff *= 2
+	}
+	if backoff > time.Hour {
+		backoff = time.Hour
+	}
+	return backoff
+}
+
+// StartOutboxWorker sends the queued emails every interval, in the background.
+func StartOutboxWorker(outbox store.Outbox, mailer mail.Mailer, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			sent, err := deliverOutbox(outbox, mailer)
+			if err != nil {
+				log.Printf("Failed to send queued emails: %s\n", err)
+				continue
+			}
+			if sent > 0 {
+				log.Printf("Sent %d queued emails\n", sent)
+			}
+		}
+	}()
+}
+
+// deliverOutbox sends the emails that are due and returns how many were sent
+func deliverOutbox(outbox store.Outbox, mailer mail.Mailer) (sent int, err error) {
+	var emails []models.OutboxEmail
+	err = outbox.ListDue(&emails, 50)
+	if err != nil {
+		return 0, err
+	}
+	for _, email := range emails {
+		claimed, err := outbox.Claim(&email, time.Now().Add(emailSendTimeout))
+		if err != nil {
+			return sent, err
+		}
+		if !claimed {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), emailSendTimeout)
+		sendErr := mailer.Send(ctx, mail.Message{From: email.From, To: []string{email.To}, Subject: email.Subject, Body: email.Body, HTML: email.HTML})
+		cancel()
+		if sendErr == nil {
+			err = outbox.MarkSent(&email)
+			if err != nil {
+				return sent, err
+			}
+			sent++
+			continue
+		}
+
+		attempts := email.Attempts + 1
+		var nextAttemptAt *time.Time
+		if attempts < maxEmailAttempts {
+			next := time.Now().Add(emailBackoff(attempts))
+			nextAttemptAt = &next
+			log.Printf("Sending email %d to %s failed, retrying at %s: %s\n", email.ID, email.To, next.Format(time.RFC3339), sendErr)
+		} else {
+			log.Printf("Sending email %d to %s failed %d times, giving up: %s\n", email.ID, email.To, attempts, sendErr)
+		}
+		err = outbox.MarkFailed(&email, sendErr, nextAttemptAt)
+		if err != nil {
+			return sent, err
+		}
+	}
+	return sent, nil
+}
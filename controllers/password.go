@@ -0,0 +1,79 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"project/mail"
+	"project/models"
+	"project/store"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Email a password reset link. The response is the same whether or not the
+// address is registered, so it can't be used to probe which emails are.
+func (repository *UserRepo) ForgotPassword(c *gin.Context) {
+	var body emailRequest
+	if !bindJSON(c, &body) {
+		return
+	}
+
+	var user models.User
+	err := repository.Users.GetByEmail(&user, body.Email)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		abortWithError(c, err)
+		return
+	}
+
+	if err == nil {
+		token := generateActivationCode()
+		reset := models.PasswordReset{UserID: user.ID, ExpiresAt: time.Now().Add(repository.Lifetimes.PasswordReset)}
+		err = repository.Users.CreatePasswordReset(&reset, token)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		data := passwordResetEmail{Name: user.Username, Link: repository.Emails.link("/password/reset", "token", token), ExpiresAt: reset.ExpiresAt}
+		repository.Emails.queueTemplate(user.Email, user.Locale, mail.TemplatePasswordReset, data)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "If the account exists, a password reset email has been sent"})
+}
+
+// Set a new password with the token of a reset email. All sessions of the
+// user are logged out.
+func (repository *UserRepo) ResetPassword(c *gin.Context) {
+	var body struct {
+		Token    string `json:"token" binding:"required"`
+		Password string `json:"password" binding:"required"`
+	}
+	if !bindJSON(c, &body) {
+		return
+	}
+
+	var user models.User
+	err := repository.Users.GetPasswordResetUser(&user, body.Token)
+	if err == nil {
+		err = invalidPassword("password", models.ValidatePassword(body.Password, user))
+	}
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(body.Password), bcrypt.DefaultCost)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	err = repository.Users.ResetPassword(&user, body.Token, string(hashedPassword))
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	syncRevocations(repository.Tokens, repository.Revocations, repository.Lifetimes.AccessToken)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password has been reset, please log in again"})
+}
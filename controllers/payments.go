@@ -0,0 +1,165 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"project/models"
+	"project/payments"
+	"project/store"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// how long a request waits for the payment provider
+const paymentTimeout = 30 * time.Second
+
+// cardRequest holds the card details of a payment
+type cardRequest struct {
+	Number   string `json:"number" binding:"required"`
+	Holder   string `json:"holder"`
+	ExpMonth int    `json:"exp_month" binding:"required,min=1,max=12"`
+	ExpYear  int    `json:"exp_year" binding:"required"`
+	CVC      string `json:"cvc" binding:"required"`
+}
+
+// Pay for a booking by card, the booking is confirmed once the payment is captured
+func (repository *BookingRepo) PayBooking(c *gin.Context) {
+	if _, ok := repository.ownBooking(c); !ok {
+		return
+	}
+	var body struct {
+		Card cardRequest `json:"card"`
+	}
+	if !bindJSON(c, &body) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), paymentTimeout)
+	defer cancel()
+	var payment models.Payment
+	err := repository.Bookings.Pay(ctx, repository.Payments, &payment, c.Param("locator"), payments.Card(body.Card))
+	repository.respondPayment(c, payment, err)
+}
+
+// Answer the 3-D Secure challenge of a payment
+func (repository *BookingRepo) CompletePaymentChallenge(c *gin.Context) {
+	booking, ok := repository.ownBooking(c)
+	if !ok {
+		return
+	}
+	var body struct {
+		Response string `json:"response" binding:"required"`
+	}
+	if !bindJSON(c, &body) {
+		return
+	}
+	var payment models.Payment
+	err := repository.Bookings.GetPayment(&payment, c.Param("id"))
+	if err == nil && payment.BookingID != booking.ID {
+		err = store.ErrNotFound
+	}
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), paymentTimeout)
+	defer cancel()
+	err = repository.Bookings.CompletePaymentChallenge(ctx, repository.Payments, &payment, c.Param("id"), body.Response)
+	repository.respondPayment(c, payment, err)
+}
+
+// List the payment attempts of a booking
+func (repository *BookingRepo) GetPayments(c *gin.Context) {
+	booking, ok := repository.ownBooking(c)
+	if !ok {
+		return
+	}
+	var list []models.Payment
+	err := repository.Bookings.ListPayments(&list, booking.ID)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, newPaymentResponses(list))
+}
+
+// respondPayment answers a payment attempt: 200 once the booking is paid,
+// 202 while a 3-D Secure challenge is waiting and 402 when declined
+func (repository *BookingRepo) respondPayment(c *gin.Context, payment models.Payment, err error) {
+	if err != nil {
+		if payment.ID == 0 {
+			// the payment was not attempted
+			abortWithError(c, err)
+			return
+		}
+		apiErr := toAPIError(err)
+		if apiErr.Status == http.StatusInternalServerError {
+			apiErr = &apiError{Status: http.StatusBadGateway, Code: codePaymentFailed, Message: err.Error()}
+		}
+		c.AbortWithStatusJSON(apiErr.Status, gin.H{"error": apiErr, "payment": newPaymentResponse(payment)})
+		return
+	}
+	if payment.Status == models.PaymentRequiresAction {
+		c.JSON(http.StatusAccepted, gin.H{"payment": newPaymentResponse(payment)})
+		return
+	}
+
+	var booking models.Booking
+	err = repository.Bookings.Get(&booking, c.Param("locator"))
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	queueBookingConfirmedEmail(repository.Users, repository.Emails, booking, payment)
+	c.JSON(http.StatusOK, gin.H{"payment": newPaymentResponse(payment), "booking": newBookingResponse(booking)})
+}
+
+// refundPayments sends the refunds of cancelled booked tickets to the payment
+// provider, see sendRefunds
+func refundPayments(c *gin.Context, bookings store.Bookings, gateway payments.Gateway, refunds []models.Refund) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), paymentTimeout)
+	defer cancel()
+	sendRefunds(ctx, bookings, gateway, refunds)
+}
+
+// sendRefunds sends the pending and failed refunds to the payment provider,
+// per booking, and records whether each succeeded. The status of refunds is
+// updated. Failed refunds are retried by StartRefundRetryWorker.
+func sendRefunds(ctx context.Context, bookings store.Bookings, gateway payments.Gateway, refunds []models.Refund) {
+	totals := map[int]int64{}
+	// indexes in refunds by booking
+	byBooking := map[int][]int{}
+	var bookingIDs []int
+	for i, refund := range refunds {
+		if refund.BookingID == nil || refund.Status == models.RefundSucceeded {
+			continue
+		}
+		if _, ok := totals[*refund.BookingID]; !ok {
+			bookingIDs = append(bookingIDs, *refund.BookingID)
+		}
+		totals[*refund.BookingID] += refund.Amount
+		byBooking[*refund.BookingID] = append(byBooking[*refund.BookingID], i)
+	}
+
+	for _, bookingID := range bookingIDs {
+		var payment models.Payment
+		status, failure := models.RefundSucceeded, ""
+		err := bookings.RefundPayment(ctx, gateway, &payment, bookingID, totals[bookingID])
+		if err != nil {
+			log.Printf("Refund of booking %d failed: %s\n", bookingID, err)
+			status, failure = models.RefundFailed, err.Error()
+		}
+		var ids []int
+		for _, i := range byBooking[bookingID] {
+			ids = append(ids, refunds[i].ID)
+			refunds[i].Status, refunds[i].Failure = status, failure
+			refunds[i].Attempts++
+		}
+		if err := bookings.SetRefundsStatus(ids, status, failure); err != nil {
+			log.Printf("Failed to record the refunds of booking %d as %s: %s\n", bookingID, status, err)
+		}
+	}
+}
@@ -1,88 +1,179 @@
 package controllers
 
 import (
-	"errors"
 	"net/http"
-	"project/database"
 	"project/models"
+	"project/store"
 
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 )
 
 type PlaneRepo struct {
-	Db *gorm.DB
+	Planes store.Planes
 }
 
-func NewPlaneController() *PlaneRepo {
-	db := database.InitDb()
-	db.AutoMigrate(&models.Plane{})
-	return &PlaneRepo{Db: db}
+// planeRequest is the body of POST /planes and PUT /planes/:id
+type planeRequest struct {
+	FirmName   string `json:"firm_name" binding:"required"`
+	SeatNumber string `json:"seat_number"`
+}
+
+// seatLayoutRequest is the body of PUT /planes/:id/seats
+type seatLayoutRequest struct {
+	Cabins   []cabinLayoutRequest `json:"cabins" binding:"required,min=1,dive"`
+	ExitRows []int                `json:"exit_rows" binding:"dive,min=1"`
+	Blocked  []string             `json:"blocked"`
+}
+
+type cabinLayoutRequest struct {
+	Class    string `json:"class" binding:"required,oneof=economy premium business first"`
+	FirstRow int    `json:"first_row" binding:"required,min=1"`
+	LastRow  int    `json:"last_row" binding:"required,min=1"`
+	Letters  string `json:"letters" binding:"required"`
+}
+
+func (request seatLayoutRequest) layout() models.SeatLayout {
+	layout := models.SeatLayout{ExitRows: request.ExitRows, Blocked: request.Blocked}
+	for _, cabin := range request.Cabins {
+		layout.Cabins = append(layout.Cabins, models.CabinLayout(cabin))
+	}
+	return layout
+}
+
+func NewPlaneController(repos store.Repositories) *PlaneRepo {
+	return &PlaneRepo{Planes: repos.Planes}
 }
 
 func (repository *PlaneRepo) CreatePlane(c *gin.Context) {
-	var plane models.Plane
-	c.BindJSON(&plane)
-	err := models.CreatePlane(repository.Db, &plane)
+	var request planeRequest
+	if !bindJSON(c, &request) {
+		return
+	}
+	plane := models.Plane{FirmName: request.FirmName, SeatNumber: request.SeatNumber}
+	err := repository.Planes.Create(&plane)
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		abortWithError(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, plane)
+	c.JSON(http.StatusOK, newPlaneResponse(plane))
+}
+
+var planeListSpec = listSpec{
+	Sorts: map[string]string{
+		"id":        "id",
+		"firm_name": "firm_name",
+	},
+	DefaultSort: "id",
+	Filters: []listFilter{
+		{Param: "firm_name", Column: "firm_name", Operator: store.Equal, Kind: "string"},
+	},
 }
 
 func (repository *PlaneRepo) GetPlanes(c *gin.Context) {
+	params, err := parseListParams(c, planeListSpec)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
 	var planes []models.Plane
-	err := models.GetPlanes(repository.Db, &planes)
+	total, err := repository.Planes.List(&planes, params.query())
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		abortWithError(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, planes)
+	setPageHeaders(c, params, total)
+	c.JSON(http.StatusOK, newPlaneResponses(planes))
 }
 
 func (repository *PlaneRepo) GetPlane(c *gin.Context) {
 	id := c.Param("id")
 	var plane models.Plane
-	err := models.GetPlane(repository.Db, &plane, id)
+	err := repository.Planes.Get(&plane, id)
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.AbortWithStatus(http.StatusNotFound)
-			return
-		}
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		abortWithError(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, plane)
+	c.JSON(http.StatusOK, newPlaneResponse(plane))
 }
 
 func (repository *PlaneRepo) UpdatePlane(c *gin.Context) {
 	id := c.Param("id")
-	var plane models.Plane
-	c.BindJSON(&plane)
-	err := models.UpdatePlane(repository.Db, &plane, id)
+	var request planeRequest
+	if !bindJSON(c, &request) {
+		return
+	}
+	plane := models.Plane{FirmName: request.FirmName, SeatNumber: request.SeatNumber}
+	err := repository.Planes.Update(&plane, id)
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.AbortWithStatus(http.StatusNotFound)
-			return
-		}
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		abortWithError(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, plane)
+	c.JSON(http.StatusOK, newPlaneResponse(plane))
 }
 
 func (repository *PlaneRepo) DeletePlane(c *gin.Context) {
 	id := c.Param("id")
 	var plane models.Plane
-	err := models.DeletePlane(repository.Db, &plane, id)
+	err := repository.Planes.Get(&plane, id)
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.AbortWithStatus(http.StatusNotFound)
-			return
-		}
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		abortWithError(c, err)
+		return
+	}
+	err = repository.Planes.Delete(&plane, id)
+	if err != nil {
+		abortWithError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"status": "Plane deleted"})
 }
+
+// get the seat map of a plane
+func (repository *PlaneRepo) GetSeats(c *gin.Context) {
+	id := c.Param("id")
+	var plane models.Plane
+	err := repository.Planes.Get(&plane, id)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	var seats []models.Seat
+	err = repository.Planes.GetSeats(&seats, id)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	statuses := []models.SeatStatus{}
+	for _, seat := range seats {
+		statuses = append(statuses, models.SeatStatusOf(seat, !seat.Blocked))
+	}
+	c.JSON(http.StatusOK, newSeatResponses(statuses))
+}
+
+// replace the seat map of a plane from a layout:
+// {"cabins": [{"class": "economy", "first_row": 1, "last_row": 30, "letters": "ABCDEF"}], "exit_rows": [12], "blocked": ["1A"]}
+func (repository *PlaneRepo) UpdateSeats(c *gin.Context) {
+	id := c.Param("id")
+	var plane models.Plane
+	err := repository.Planes.Get(&plane, id)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	var request seatLayoutRequest
+	if !bindJSON(c, &request) {
+		return
+	}
+	seats, err := request.layout().Seats(plane.ID)
+	if err != nil {
+		abortWithError(c, validationFailed(err.Error()))
+		return
+	}
+
+	err = repository.Planes.ReplaceSeats(&seats, id)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "Seat map updated", "seats": len(seats)})
+}
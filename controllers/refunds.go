@@ -0,0 +1,155 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"project/models"
+	"project/payments"
+	"project/store"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// staleRefundAge is how long a pending refund waits for the request that made
+// it before it is sent by StartRefundRetryWorker
+const staleRefundAge = 10 * time.Minute
+
+// StartRefundRetryWorker sends the failed refunds again every interval, up to
+// models.MaxRefundAttempts times
+func StartRefundRetryWorker(bookings store.Bookings, gateway payments.Gateway, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			retried, err := RetryRefunds(bookings, gateway, time.Now().Add(-staleRefundAge))
+			if err != nil {
+				log.Printf("Failed to retry refunds: %s\n", err)
+			} else if retried > 0 {
+				log.Printf("Retried %d refunds\n", retried)
+			}
+		}
+	}()
+}
+
+// RetryRefunds sends the failed refunds with attempts left, and the pending
+// ones not updated since staleBefore, to the payment provider again and
+// returns how many were sent
+func RetryRefunds(bookings store.Bookings, gateway payments.Gateway, staleBefore time.Time) (retried int, err error) {
+	var refunds []models.Refund
+	err = bookings.ListRetryableRefunds(&refunds, staleBefore)
+	if err != nil {
+		return 0, err
+	}
+	byBooking := map[int][]models.Refund{}
+	var bookingIDs []int
+	for _, refund := range refunds {
+		if refund.BookingID == nil {
+			continue
+		}
+		if _, ok := byBooking[*refund.BookingID]; !ok {
+			bookingIDs = append(bookingIDs, *refund.BookingID)
+		}
+		byBooking[*refund.BookingID] = append(byBooking[*refund.BookingID], refund)
+	}
+
+	for _, bookingID := range bookingIDs {
+		var ids []int
+		for _, refund := range byBooking[bookingID] {
+			ids = append(ids, refund.ID)
+		}
+		// several servers may run this worker
+		claimed, err := bookings.ClaimRefunds(ids, staleBefore)
+		if err != nil {
+			return retried, err
+		}
+		if !claimed {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), paymentTimeout)
+		sendRefunds(ctx, bookings, gateway, byBooking[bookingID])
+		cancel()
+		retried += len(ids)
+	}
+	return retried, nil
+}
+
+// refundPolicy reads the fare rules of cancellations, e.g.
+// [{"min_hours_before_departure":24,"refund_percent":100},{"min_hours_before_departure":0,"refund_percent":75}]
+// and falls back to the default policy when there are none. The rules are
+// checked when the configuration is loaded.
+func refundPolicy(rules string) models.RefundPolicy {
+	if rules == "" {
+		return models.DefaultRefundPolicy
+	}
+	policy, err := models.ParseRefundPolicy(rules)
+	if err != nil {
+		log.Printf("Invalid fare rules, using the default fare rules: %s\n", err)
+		return models.DefaultRefundPolicy
+	}
+	return policy
+}
+
+// cancelReason reads the optional {"reason": "..."} body of a cancellation
+func cancelReason(c *gin.Context) (string, bool) {
+	var body struct {
+		Reason string `json:"reason"`
+	}
+	if !bindOptionalJSON(c, &body) {
+		return "", false
+	}
+	return body.Reason, true
+}
+
+var refundListSpec = listSpec{
+	Sorts: map[string]string{
+		"id":      "id",
+		"created": "created_at",
+		"amount":  "amount",
+	},
+	DefaultSort: "-id",
+	Filters: []listFilter{
+		{Param: "user_id", Column: "user_id", Operator: store.Equal, Kind: "int"},
+		{Param: "booking_id", Column: "booking_id", Operator: store.Equal, Kind: "int"},
+		{Param: "ticket_id", Column: "ticket_id", Operator: store.Equal, Kind: "int"},
+		{Param: "currency", Column: "currency", Operator: store.Equal, Kind: "string"},
+		{Param: "status", Column: "status", Operator: store.Equal, Kind: "string"},
+		{Param: "cancelled_by", Column: "cancelled_by", Operator: store.Equal, Kind: "int"},
+		{Param: "created_from", Column: "created_at", Operator: store.GreaterOrEqual, Kind: "time"},
+		{Param: "created_to", Column: "created_at", Operator: store.Less, Kind: "time"},
+	},
+}
+
+// List refunds for reporting
+func (repository *BTicketRepo) GetRefunds(c *gin.Context) {
+	params, err := parseListParams(c, refundListSpec)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	var refunds []models.Refund
+	total, err := repository.Bookings.ListRefunds(&refunds, params.query())
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	setPageHeaders(c, params, total)
+	c.JSON(http.StatusOK, newRefundResponses(refunds))
+}
+
+// Sum refunds by currency, with the same filters as the refund list
+func (repository *BTicketRepo) GetRefundSummary(c *gin.Context) {
+	params, err := parseListParams(c, refundListSpec)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	var totals []models.RefundTotal
+	err = repository.Bookings.SumRefunds(&totals, params.query())
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, newRefundTotalResponses(totals))
+}
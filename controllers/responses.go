@@ -0,0 +1,487 @@
+package controllers
+
+import (
+	"project/models"
+	"strings"
+	"time"
+)
+
+// The API never serializes models directly. Each resource has a response type
+// listing the fields clients may see, so password hashes, activation codes,
+// provider internals and half-loaded associations stay out of responses.
+
+type userResponse struct {
+	ID        int        `json:"id"`
+	Username  string     `json:"username"`
+	Email     string     `json:"email"`
+	Role      string     `json:"role"`
+	Locale    string     `json:"locale"`
+	Active    bool       `json:"active"`
+	LastLogin *time.Time `json:"last_login"`
+	CreatedAt *time.Time `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+func newUserResponse(user models.User) userResponse {
+	return userResponse{
+		ID:        user.ID,
+		Username:  user.Username,
+		Email:     user.Email,
+		Role:      user.Role,
+		Locale:    user.Locale,
+		Active:    user.Active,
+		LastLogin: user.LastLogin,
+		CreatedAt: user.CreatedAt,
+		UpdatedAt: user.UpdatedAt,
+	}
+}
+
+func newUserResponses(users []models.User) []userResponse {
+	response := []userResponse{}
+	for _, user := range users {
+		response = append(response, newUserResponse(user))
+	}
+	return response
+}
+
+type planeResponse struct {
+	ID         int    `json:"id"`
+	FirmName   string `json:"firm_name"`
+	SeatNumber string `json:"seat_number"`
+}
+
+func newPlaneResponse(plane models.Plane) planeResponse {
+	return planeResponse{ID: plane.ID, FirmName: plane.FirmName, SeatNumber: plane.SeatNumber}
+}
+
+func newPlaneResponses(planes []models.Plane) []planeResponse {
+	response := []planeResponse{}
+	for _, plane := range planes {
+		response = append(response, newPlaneResponse(plane))
+	}
+	return response
+}
+
+type seatResponse struct {
+	ID        int    `json:"id"`
+	Label     string `json:"label"`
+	Row       int    `json:"row"`
+	Letter    string `json:"letter"`
+	Cabin     string `json:"cabin"`
+	ExitRow   bool   `json:"exit_row"`
+	Blocked   bool   `json:"blocked"`
+	Available bool   `json:"available"`
+}
+
+func newSeatResponses(seats []models.SeatStatus) []seatResponse {
+	response := []seatResponse{}
+	for _, seat := range seats {
+		response = append(response, seatResponse{
+			ID:        seat.Seat.ID,
+			Label:     seat.Label,
+			Row:       seat.Row,
+			Letter:    seat.Letter,
+			Cabin:     seat.Cabin,
+			ExitRow:   seat.ExitRow,
+			Blocked:   seat.Blocked,
+			Available: seat.Available,
+		})
+	}
+	return response
+}
+
+type airportResponse struct {
+	ID        int     `json:"id"`
+	IATA      string  `json:"iata"`
+	ICAO      string  `json:"icao"`
+	Name      string  `json:"name"`
+	City      string  `json:"city"`
+	Country   string  `json:"country"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Timezone  string  `json:"timezone"`
+}
+
+func newAirportResponse(airport models.Airport) airportResponse {
+	return airportResponse{
+		ID:        airport.ID,
+		IATA:      airport.IATA,
+		ICAO:      airport.ICAO,
+		Name:      airport.Name,
+		City:      airport.City,
+		Country:   airport.Country,
+		Latitude:  airport.Latitude,
+		Longitude: airport.Longitude,
+		Timezone:  airport.Timezone,
+	}
+}
+
+func newAirportResponses(airports []models.Airport) []airportResponse {
+	response := []airportResponse{}
+	for _, airport := range airports {
+		response = append(response, newAirportResponse(airport))
+	}
+	return response
+}
+
+// airportRef is the airport of a ticket, nil when it was not loaded
+func airportRef(airport models.Airport) *airportResponse {
+	if airport.ID == 0 {
+		return nil
+	}
+	response := newAirportResponse(airport)
+	return &response
+}
+
+type ticketResponse struct {
+	ID             int              `json:"id"`
+	PlaneID        int              `json:"plane_id"`
+	FromAirportID  int              `json:"from_airport_id"`
+	FromAirport    *airportResponse `json:"from_airport,omitempty"`
+	ToAirportID    int              `json:"to_airport_id"`
+	ToAirport      *airportResponse `json:"to_airport,omitempty"`
+	DepartureAt    time.Time        `json:"departure_at"`
+	ArrivalAt      time.Time        `json:"arrival_at"`
+	SeatCapacity   int              `json:"seat_capacity"`
+	AvailableSeats int              `json:"available_seats"`
+	PriceAmount    int64            `json:"price_amount"`
+	Currency       string           `json:"currency"`
+}
+
+func newTicketResponse(ticket models.Ticket) ticketResponse {
+	return ticketResponse{
+		ID:             ticket.ID,
+		PlaneID:        ticket.PlaneID,
+		FromAirportID:  ticket.FromAirportID,
+		FromAirport:    airportRef(ticket.FromAirport),
+		ToAirportID:    ticket.ToAirportID,
+		ToAirport:      airportRef(ticket.ToAirport),
+		DepartureAt:    ticket.DepartureAt,
+		ArrivalAt:      ticket.ArrivalAt,
+		SeatCapacity:   ticket.SeatCapacity,
+		AvailableSeats: ticket.AvailableSeats,
+		PriceAmount:    ticket.PriceAmount,
+		Currency:       ticket.Currency,
+	}
+}
+
+func newTicketResponses(tickets []models.Ticket) []ticketResponse {
+	response := []ticketResponse{}
+	for _, ticket := range tickets {
+		response = append(response, newTicketResponse(ticket))
+	}
+	return response
+}
+
+type itineraryResponse struct {
+	Legs            []ticketResponse `json:"legs"`
+	Stops           int              `json:"stops"`
+	DepartureAt     time.Time        `json:"departure_at"`
+	ArrivalAt       time.Time        `json:"arrival_at"`
+	DurationMinutes int              `json:"duration_minutes"`
+	PriceAmount     int64            `json:"price_amount"`
+	Currency        string           `json:"currency"`
+}
+
+func newItineraryResponses(itineraries []models.Itinerary) []itineraryResponse {
+	response := []itineraryResponse{}
+	for _, itinerary := range itineraries {
+		response = append(response, itineraryResponse{
+			Legs:            newTicketResponses(itinerary.Legs),
+			Stops:           itinerary.Stops,
+			DepartureAt:     itinerary.DepartureAt,
+			ArrivalAt:       itinerary.ArrivalAt,
+			DurationMinutes: itinerary.DurationMinutes,
+			PriceAmount:     itinerary.PriceAmount,
+			Currency:        itinerary.Currency,
+		})
+	}
+	return response
+}
+
+type bTicketResponse struct {
+	ID           int        `json:"id"`
+	TicketID     int        `json:"ticket_id"`
+	UserID       int        `json:"user_id"`
+	BookingID    *int       `json:"booking_id"`
+	PassengerID  *int       `json:"passenger_id"`
+	Seat         string     `json:"seat,omitempty"`
+	FareAmount   int64      `json:"fare_amount"`
+	Currency     string     `json:"currency"`
+	CreatedAt    time.Time  `json:"created_at"`
+	CancelledAt  *time.Time `json:"cancelled_at"`
+	CancelledBy  *int       `json:"cancelled_by,omitempty"`
+	CancelReason string     `json:"cancel_reason,omitempty"`
+}
+
+func newBTicketResponse(bTicket models.BTicket) bTicketResponse {
+	response := bTicketResponse{
+		ID:           bTicket.ID,
+		TicketID:     bTicket.TicketID,
+		UserID:       bTicket.UserID,
+		BookingID:    bTicket.BookingID,
+		PassengerID:  bTicket.PassengerID,
+		FareAmount:   bTicket.FareAmount,
+		Currency:     bTicket.Currency,
+		CreatedAt:    bTicket.CreatedAt,
+		CancelledAt:  bTicket.CancelledAt,
+		CancelledBy:  bTicket.CancelledBy,
+		CancelReason: bTicket.CancelReason,
+	}
+	if bTicket.SeatAssignment != nil {
+		response.Seat = bTicket.SeatAssignment.Seat.Label()
+	}
+	return response
+}
+
+func newBTicketResponses(bTickets []models.BTicket) []bTicketResponse {
+	response := []bTicketResponse{}
+	for _, bTicket := range bTickets {
+		response = append(response, newBTicketResponse(bTicket))
+	}
+	return response
+}
+
+type holdResponse struct {
+	ID        int       `json:"id"`
+	TicketID  int       `json:"ticket_id"`
+	UserID    int       `json:"user_id"`
+	Quantity  int       `json:"quantity"`
+	Status    string    `json:"status"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func newHoldResponse(hold models.SeatHold) holdResponse {
+	return holdResponse{
+		ID:        hold.ID,
+		TicketID:  hold.TicketID,
+		UserID:    hold.UserID,
+		Quantity:  hold.Quantity,
+		Status:    hold.Status,
+		ExpiresAt: hold.ExpiresAt,
+		CreatedAt: hold.CreatedAt,
+	}
+}
+
+type passengerResponse struct {
+	ID             int    `json:"id"`
+	FirstName      string `json:"first_name"`
+	LastName       string `json:"last_name"`
+	DateOfBirth    string `json:"date_of_birth,omitempty"` // YYYY-MM-DD
+	DocumentNumber string `json:"document_number"`
+	Type           string `json:"type"`
+}
+
+type bookingResponse struct {
+	ID           int                 `json:"id"`
+	Locator      string              `json:"locator"`
+	UserID       int                 `json:"user_id"`
+	Status       string              `json:"status"`
+	PaymentDueAt *time.Time          `json:"payment_due_at"`
+	CreatedAt    time.Time           `json:"created_at"`
+	Passengers   []passengerResponse `json:"passengers"`
+	Segments     []ticketResponse    `json:"segments"`
+	BTickets     []bTicketResponse   `json:"btickets"`
+	Payments     []paymentResponse   `json:"payments"`
+}
+
+func newBookingResponse(booking models.Booking) bookingResponse {
+	response := bookingResponse{
+		ID:           booking.ID,
+		Locator:      booking.Locator,
+		UserID:       booking.UserID,
+		Status:       booking.Status,
+		PaymentDueAt: booking.PaymentDueAt,
+		CreatedAt:    booking.CreatedAt,
+		Passengers:   []passengerResponse{},
+		Segments:     []ticketResponse{},
+		BTickets:     newBTicketResponses(booking.BTickets),
+		Payments:     newPaymentResponses(booking.Payments),
+	}
+	for _, passenger := range booking.Passengers {
+		response.Passengers = append(response.Passengers, passengerResponse{
+			ID:             passenger.ID,
+			FirstName:      passenger.FirstName,
+			LastName:       passenger.LastName,
+			DateOfBirth:    passenger.DateOfBirth.Format("2006-01-02"),
+			DocumentNumber: passenger.DocumentNumber,
+			Type:           passenger.Type,
+		})
+	}
+	for _, segment := range booking.Segments {
+		response.Segments = append(response.Segments, newTicketResponse(segment.Ticket))
+	}
+	return response
+}
+
+// newPublicBookingResponse is a booking as shown to anyone who knows its
+// locator and last name, without the birth dates and with the document
+// numbers reduced to their last 4 characters
+func newPublicBookingResponse(booking models.Booking) bookingResponse {
+	response := newBookingResponse(booking)
+	for i := range response.Passengers {
+		response.Passengers[i].DateOfBirth = ""
+		response.Passengers[i].DocumentNumber = maskDocumentNumber(response.Passengers[i].DocumentNumber)
+	}
+	return response
+}
+
+// maskDocumentNumber replaces all but the last 4 characters with '*'
+func maskDocumentNumber(number string) string {
+	runes := []rune(number)
+	if len(runes) <= 4 {
+		return strings.Repeat("*", len(runes))
+	}
+	return strings.Repeat("*", len(runes)-4) + string(runes[len(runes)-4:])
+}
+
+func newBookingResponses(bookings []models.Booking) []bookingResponse {
+	response := []bookingResponse{}
+	for _, booking := range bookings {
+		response = append(response, newBookingResponse(booking))
+	}
+	return response
+}
+
+type paymentEventResponse struct {
+	Operation string    `json:"operation"`
+	Amount    int64     `json:"amount"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type paymentResponse struct {
+	ID             int                    `json:"id"`
+	BookingID      int                    `json:"booking_id"`
+	Provider       string                 `json:"provider"`
+	Reference      string                 `json:"reference"`
+	Amount         int64                  `json:"amount"`
+	Currency       string                 `json:"currency"`
+	RefundedAmount int64                  `json:"refunded_amount"`
+	Status         string                 `json:"status"`
+	CardLast4      string                 `json:"card_last4"`
+	ChallengeURL   string                 `json:"challenge_url,omitempty"`
+	FailureReason  string                 `json:"failure_reason,omitempty"`
+	CreatedAt      time.Time              `json:"created_at"`
+	Events         []paymentEventResponse `json:"events,omitempty"`
+}
+
+func newPaymentResponse(payment models.Payment) paymentResponse {
+	response := paymentResponse{
+		ID:             payment.ID,
+		BookingID:      payment.BookingID,
+		Provider:       payment.Provider,
+		Reference:      payment.Reference,
+		Amount:         payment.Amount,
+		Currency:       payment.Currency,
+		RefundedAmount: payment.RefundedAmount,
+		Status:         payment.Status,
+		CardLast4:      payment.CardLast4,
+		ChallengeURL:   payment.ChallengeURL,
+		FailureReason:  payment.FailureReason,
+		CreatedAt:      payment.CreatedAt,
+	}
+	for _, event := range payment.Events {
+		response.Events = append(response.Events, paymentEventResponse{
+			Operation: event.Operation,
+			Amount:    event.Amount,
+			Status:    event.Status,
+			Error:     event.Error,
+			CreatedAt: event.CreatedAt,
+		})
+	}
+	return response
+}
+
+func newPaymentResponses(payments []models.Payment) []paymentResponse {
+	response := []paymentResponse{}
+	for _, payment := range payments {
+		response = append(response, newPaymentResponse(payment))
+	}
+	return response
+}
+
+type refundResponse struct {
+	ID          int       `json:"id"`
+	BTicketID   int       `json:"bticket_id"`
+	BookingID   *int      `json:"booking_id"`
+	UserID      int       `json:"user_id"`
+	TicketID    int       `json:"ticket_id"`
+	FareAmount  int64     `json:"fare_amount"`
+	Amount      int64     `json:"amount"`
+	Currency    string    `json:"currency"`
+	Percent     int       `json:"percent"`
+	Rule        string    `json:"rule"`
+	CancelledBy int       `json:"cancelled_by"`
+	Reason      string    `json:"reason"`
+	Status      string    `json:"status"`
+	Attempts    int       `json:"attempts"`
+	Failure     string    `json:"failure,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func newRefundResponse(refund models.Refund) refundResponse {
+	return refundResponse{
+		ID:          refund.ID,
+		BTicketID:   refund.BTicketID,
+		BookingID:   refund.BookingID,
+		UserID:      refund.UserID,
+		TicketID:    refund.TicketID,
+		FareAmount:  refund.FareAmount,
+		Amount:      refund.Amount,
+		Currency:    refund.Currency,
+		Percent:     refund.Percent,
+		Rule:        refund.Rule,
+		CancelledBy: refund.CancelledBy,
+		Reason:      refund.Reason,
+		Status:      refund.Status,
+		Attempts:    refund.Attempts,
+		Failure:     refund.Failure,
+		CreatedAt:   refund.CreatedAt,
+	}
+}
+
+func newRefundResponses(refunds []models.Refund) []refundResponse {
+	response := []refundResponse{}
+	for _, refund := range refunds {
+		response = append(response, newRefundResponse(refund))
+	}
+	return response
+}
+
+type refundTotalResponse struct {
+	Currency   string `json:"currency"`
+	Count      int64  `json:"count"`
+	FareAmount int64  `json:"fare_amount"`
+	Amount     int64  `json:"amount"`
+	Withheld   int64  `json:"withheld"`
+}
+
+func newRefundTotalResponses(totals []models.RefundTotal) []refundTotalResponse {
+	response := []refundTotalResponse{}
+	for _, total := range totals {
+		response = append(response, refundTotalResponse(total))
+	}
+	return response
+}
+
+// tokenResponse holds the tokens handed out at login and on refresh
+type tokenResponse struct {
+	AccessToken   string     `json:"access_token"`
+	TokenType     string     `json:"token_type"`
+	ExpiresIn     int64      `json:"expires_in"` // seconds
+	RefreshToken  string     `json:"refresh_token"`
+	RefreshExpiry *time.Time `json:"refresh_expiry"`
+}
+
+func newTokenResponse(accessToken string, ttl time.Duration, token models.Token, refreshToken string) tokenResponse {
+	return tokenResponse{
+		AccessToken:   accessToken,
+		TokenType:     "Bearer",
+		ExpiresIn:     int64(ttl / time.Second),
+		RefreshToken:  refreshToken,
+		RefreshExpiry: token.EndingDate,
+	}
+}
@@ -0,0 +1,16 @@
+package controllers
+
+import (
+	"project/auth"
+	"project/payments"
+)
+
+// Services are the dependencies built once when the server starts and
+// shared by the controllers.
+type Services struct {
+	// Keys sign and verify access tokens
+	Keys *auth.Keys
+	// Revocations are the revoked sessions whose access tokens are rejected
+	Revocations *auth.Revocations
+	Payments    payments.Gateway
+}
@@ -3,137 +3,366 @@ package controllers
 import (
 	"errors"
 	"net/http"
-	"project/database"
+	"project/config"
 	"project/models"
+	"project/store"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 )
 
 type TicketRepo struct {
-	Db *gorm.DB
+	Tickets  store.Tickets
+	Planes   store.Planes
+	Airports store.Airports
+	Users    store.Users
+	Emails   Emails
 }
 
-func NewTicketController() *TicketRepo {
-	db := database.InitDb()
-	db.AutoMigrate(&models.Ticket{})
-	return &TicketRepo{Db: db}
+func NewTicketController(repos store.Repositories, cfg config.Config) *TicketRepo {
+	return &TicketRepo{Tickets: repos.Tickets, Planes: repos.Planes, Airports: repos.Airports, Users: repos.Users, Emails: NewEmails(repos, cfg)}
+}
+
+// ticketRequest is the body of POST /tickets and PUT /tickets/:id. Times
+// are RFC 3339 with their timezone offset, prices in minor units.
+type ticketRequest struct {
+	PlaneID       int       `json:"plane_id" binding:"required"`
+	FromAirportID int       `json:"from_airport_id" binding:"required"`
+	ToAirportID   int       `json:"to_airport_id" binding:"required"`
+	DepartureAt   time.Time `json:"departure_at" binding:"required"`
+	ArrivalAt     time.Time `json:"arrival_at" binding:"required"`
+	SeatCapacity  int       `json:"seat_capacity" binding:"min=0"`
+	PriceAmount   int64     `json:"price_amount" binding:"min=0"`
+	Currency      string    `json:"currency" binding:"required,len=3,uppercase"`
+}
+
+// bindTicket reads and checks the ticket of the request
+func bindTicket(c *gin.Context) (models.Ticket, bool) {
+	var request ticketRequest
+	if !bindJSON(c, &request) {
+		return models.Ticket{}, false
+	}
+	ticket := models.Ticket{
+		PlaneID:       request.PlaneID,
+		FromAirportID: request.FromAirportID,
+		ToAirportID:   request.ToAirportID,
+		DepartureAt:   request.DepartureAt,
+		ArrivalAt:     request.ArrivalAt,
+		SeatCapacity:  request.SeatCapacity,
+		PriceAmount:   request.PriceAmount,
+		Currency:      request.Currency,
+	}
+	if err := ticket.Validate(); err != nil {
+		abortWithError(c, validationFailed(err.Error()))
+		return ticket, false
+	}
+	return ticket, true
+}
+
+// checkReferences makes sure the plane and airports of ticket exist, so a
+// missing one is reported on its field instead of failing the foreign key
+func (repository *TicketRepo) checkReferences(c *gin.Context, ticket models.Ticket) bool {
+	var plane models.Plane
+	err := repository.Planes.Get(&plane, strconv.Itoa(ticket.PlaneID))
+	if err != nil {
+		abortWithError(c, missingReference("plane_id", "plane", err))
+		return false
+	}
+	airports := []struct {
+		field string
+		id    int
+	}{
+		{"from_airport_id", ticket.FromAirportID},
+		{"to_airport_id", ticket.ToAirportID},
+	}
+	for _, ref := range airports {
+		var airport models.Airport
+		err := repository.Airports.Get(&airport, strconv.Itoa(ref.id))
+		if err != nil {
+			abortWithError(c, missingReference(ref.field, "airport", err))
+			return false
+		}
+	}
+	return true
+}
+
+// missingReference turns the not found error of a referenced record into a
+// 422 on the field holding its id
+func missingReference(field string, name string, err error) error {
+	if errors.Is(err, store.ErrNotFound) {
+		return invalidField(field, "must be the id of an existing "+name)
+	}
+	return err
 }
 
 func (repository *TicketRepo) CreateTicket(c *gin.Context) {
-	var ticket models.Ticket
-	c.BindJSON(&ticket)
-	err := models.CreateTicket(repository.Db, &ticket)
+	ticket, ok := bindTicket(c)
+	if !ok || !repository.checkReferences(c, ticket) {
+		return
+	}
+	err := repository.Tickets.Create(&ticket)
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		abortWithError(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, ticket)
+	c.JSON(http.StatusOK, newTicketResponse(ticket))
+}
+
+var ticketListSpec = listSpec{
+	Sorts: map[string]string{
+		"id":        "id",
+		"departure": "departure_at",
+		"arrival":   "arrival_at",
+		"price":     "price_amount",
+		"seats":     "available_seats",
+	},
+	DefaultSort: "departure",
+	Filters: []listFilter{
+		{Param: "price_min", Column: "price_amount", Operator: store.GreaterOrEqual, Kind: "price"},
+		{Param: "price_max", Column: "price_amount", Operator: store.LessOrEqual, Kind: "price"},
+		{Param: "currency", Column: "currency", Operator: store.Equal, Kind: "string"},
+		{Param: "departure_from", Column: "departure_at", Operator: store.GreaterOrEqual, Kind: "time"},
+		{Param: "departure_to", Column: "departure_at", Operator: store.Less, Kind: "time"},
+		{Param: "plane_id", Column: "plane_id", Operator: store.Equal, Kind: "int"},
+		{Param: "from_airport_id", Column: "from_airport_id", Operator: store.Equal, Kind: "int"},
+		{Param: "to_airport_id", Column: "to_airport_id", Operator: store.Equal, Kind: "int"},
+		{Param: "min_seats", Column: "available_seats", Operator: store.GreaterOrEqual, Kind: "int"},
+	},
 }
 
 func (repository *TicketRepo) GetTickets(c *gin.Context) {
+	params, err := parseListParams(c, ticketListSpec)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
 	var tickets []models.Ticket
-	err := models.GetTickets(repository.Db, &tickets)
+	total, err := repository.Tickets.List(&tickets, params.query())
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		abortWithError(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, tickets)
+	setPageHeaders(c, params, total)
+	c.JSON(http.StatusOK, newTicketResponses(tickets))
 }
 
 func (repository *TicketRepo) FilterTickets(c *gin.Context) {
+	params, err := parseListParams(c, ticketListSpec)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
 	from := c.Query("from")
 	to := c.Query("to")
-	departureDateStr := c.Query("departureDate")
-	returnDateStr := c.Query("returnDate")
-
-	query := repository.Db.Model(&models.Ticket{})
-
-	if from != "" {
-		query = query.Where("`From` = ?", from)
+	departureDateStr := c.Query("departure_date")
+	arrivalDateStr := c.Query("arrival_date")
+	if arrivalDateStr == "" {
+		// return_date is the name this filter had before tickets got arrival times
+		arrivalDateStr = c.Query("return_date")
 	}
 
-	if to != "" {
-		query = query.Where("`To` = ?", to)
-	}
+	query := params.query()
 
+	// Dates are days at the departure and arrival airports
 	if departureDateStr != "" {
-		departureDate, err := time.Parse("2006-01-02", departureDateStr)
+		loc, err := repository.airportLocation(from)
 		if err != nil {
-			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid departureDate format"})
+			abortWithError(c, err)
 			return
 		}
-		departureDateFormatted := departureDate.Format("2006-01-02")
-		query = query.Where("DATE(`departure_date`) = ?", departureDateFormatted)
+		start, end, err := dayRange(departureDateStr, loc)
+		if err != nil {
+			abortWithError(c, invalidRequest("departure_date must be formatted like 2006-01-02"))
+			return
+		}
+		query = query.Where("departure_at", store.GreaterOrEqual, start).Where("departure_at", store.Less, end)
 	}
 
-	if returnDateStr != "" {
-		returnDate, err := time.Parse("2006-01-02", returnDateStr)
+	if arrivalDateStr != "" {
+		loc, err := repository.airportLocation(to)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		start, end, err := dayRange(arrivalDateStr, loc)
 		if err != nil {
-			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid returnDate format"})
+			abortWithError(c, invalidRequest("arrival_date must be formatted like 2006-01-02"))
 			return
 		}
-		returnDateFormatted := returnDate.Format("2006-01-02")
-		query = query.Where("DATE(`return_date`) = ?", returnDateFormatted)
+		query = query.Where("arrival_at", store.GreaterOrEqual, start).Where("arrival_at", store.Less, end)
 	}
 
+	// Airports can be given by IATA or ICAO code or by city, in any case
 	var tickets []models.Ticket
-	err := query.Find(&tickets).Error
+	total, err := repository.Tickets.Filter(&tickets, from, to, query)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	setPageHeaders(c, params, total)
+
+	c.JSON(http.StatusOK, newTicketResponses(tickets))
+}
+
+// Search itineraries with connections:
+// /routes?from=ESB&to=AMS&date=2024-06-01&max_stops=1&min_layover=45&max_layover=720&sort=duration
+// Layovers are in minutes.
+func (repository *TicketRepo) SearchRoutes(c *gin.Context) {
+	from := c.Query("from")
+	to := c.Query("to")
+	if from == "" || to == "" {
+		abortWithError(c, invalidRequest("from and to are required"))
+		return
+	}
+
+	loc, err := repository.airportLocation(from)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	start, end, err := dayRange(c.Query("date"), loc)
+	if err != nil {
+		abortWithError(c, invalidRequest("date must be formatted like 2006-01-02"))
+		return
+	}
+
+	maxStops, err := strconv.Atoi(c.DefaultQuery("max_stops", "1"))
+	if err != nil || maxStops < 0 || maxStops > 3 {
+		abortWithError(c, invalidRequest("max_stops must be between 0 and 3"))
+		return
+	}
+	minLayover, err := strconv.Atoi(c.DefaultQuery("min_layover", "45"))
+	if err != nil || minLayover < 0 {
+		abortWithError(c, invalidRequest("min_layover must be a number of minutes, 0 or more"))
+		return
+	}
+	maxLayover, err := strconv.Atoi(c.DefaultQuery("max_layover", "720"))
+	if err != nil || maxLayover < minLayover || maxLayover > 48*60 {
+		abortWithError(c, invalidRequest("max_layover must be between min_layover and 2880"))
+		return
+	}
+	sortBy := c.DefaultQuery("sort", "duration")
+	if sortBy != "duration" && sortBy != "price" {
+		abortWithError(c, invalidRequest("sort must be duration or price"))
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 || limit > 100 {
+		abortWithError(c, invalidRequest("limit must be between 1 and 100"))
+		return
+	}
+
+	opts := models.ConnectionOptions{
+		MinLayover: time.Duration(minLayover) * time.Minute,
+		MaxLayover: time.Duration(maxLayover) * time.Minute,
+		MaxStops:   maxStops,
+		SortBy:     sortBy,
+		Limit:      limit,
+	}
+	var itineraries []models.Itinerary
+	err = repository.Tickets.SearchConnections(&itineraries, from, to, start, end, opts)
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		abortWithError(c, err)
 		return
 	}
+	c.JSON(http.StatusOK, newItineraryResponses(itineraries))
+}
 
-	c.JSON(http.StatusOK, tickets)
+// airportLocation returns the timezone of the airport given by code or
+// city, UTC without one
+func (repository *TicketRepo) airportLocation(airport string) (*time.Location, error) {
+	if airport == "" {
+		return time.UTC, nil
+	}
+	return repository.Airports.Location(airport)
+}
+
+// dayRange returns the start of the given day (YYYY-MM-DD) and of the next
+// one in loc
+func dayRange(date string, loc *time.Location) (time.Time, time.Time, error) {
+	start, err := time.ParseInLocation("2006-01-02", date, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return start, start.AddDate(0, 0, 1), nil
 }
 
 func (repository *TicketRepo) GetTicket(c *gin.Context) {
 	id := c.Param("id")
 	var ticket models.Ticket
-	err := models.GetTicket(repository.Db, &ticket, id)
+	err := repository.Tickets.Get(&ticket, id)
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.AbortWithStatus(http.StatusNotFound)
-			return
-		}
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		abortWithError(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, ticket)
+	c.JSON(http.StatusOK, newTicketResponse(ticket))
 }
 
-func (repository *TicketRepo) UpdateTicket(c *gin.Context) {
+// get the seat map of a ticket with the seats that are still free
+func (repository *TicketRepo) GetTicketSeats(c *gin.Context) {
 	id := c.Param("id")
 	var ticket models.Ticket
-	c.BindJSON(&ticket)
-	err := models.UpdateTicket(repository.Db, &ticket, id)
+	err := repository.Tickets.Get(&ticket, id)
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.AbortWithStatus(http.StatusNotFound)
-			return
-		}
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		abortWithError(c, err)
+		return
+	}
+	var seats []models.SeatStatus
+	err = repository.Tickets.GetSeats(&seats, ticket)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	if len(seats) == 0 {
+		abortWithError(c, notFound("Plane has no seat map"))
+		return
+	}
+	c.JSON(http.StatusOK, newSeatResponses(seats))
+}
+
+func (repository *TicketRepo) UpdateTicket(c *gin.Context) {
+	id := c.Param("id")
+	ticket, ok := bindTicket(c)
+	if !ok {
 		return
 	}
-	c.JSON(http.StatusOK, ticket)
+	var before models.Ticket
+	err := repository.Tickets.Get(&before, id)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	if !repository.checkReferences(c, ticket) {
+		return
+	}
+	err = repository.Tickets.Update(&ticket, id)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	var after models.Ticket
+	err = repository.Tickets.Get(&after, id)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	queueFlightChangedEmails(repository.Users, repository.Emails, before, after)
+	c.JSON(http.StatusOK, newTicketResponse(after))
 }
 
 func (repository *TicketRepo) DeleteTicket(c *gin.Context) {
 	id := c.Param("id")
 	var ticket models.Ticket
-	err := models.GetTicket(repository.Db, &ticket, id)
+	err := repository.Tickets.Get(&ticket, id)
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.AbortWithStatus(http.StatusNotFound)
-			return
-		}
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		abortWithError(c, err)
 		return
 	}
-	err = models.DeleteTicket(repository.Db, &ticket, id)
+	err = repository.Tickets.Delete(&ticket, id)
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		abortWithError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"status": "Ticket deleted"})
@@ -1,57 +1,157 @@
 package controllers
 
 import (
+	"errors"
+	"log"
 	"net/http"
-	"project/database"
+	"project/auth"
+	"project/config"
 	"project/models"
+	"project/store"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 )
 
 type TokenRepo struct {
-	Db *gorm.DB
+	Users       store.Users
+	Tokens      store.Tokens
+	Keys        *auth.Keys
+	Revocations *auth.Revocations
+	Lifetimes   config.Lifetimes
 }
 
 type StatusToken struct {
 	Status string
 }
 
-func NewTokenController() *TokenRepo {
-	db := database.InitDb()
-	db.AutoMigrate(&models.Token{})
-	return &TokenRepo{Db: db}
+func NewTokenController(repos store.Repositories, cfg config.Config, services Services) *TokenRepo {
+	return &TokenRepo{Users: repos.Users, Tokens: repos.Tokens, Keys: services.Keys, Revocations: services.Revocations, Lifetimes: cfg.Lifetimes}
 }
 
-// create Token
-func (repository *TokenRepo) CreateToken(c *gin.Context) {
+// signAccessToken returns an access token of user valid for ttl
+func signAccessToken(keys *auth.Keys, ttl time.Duration, user models.User, sessionID string) (string, error) {
+	now := time.Now()
+	return keys.Sign(auth.Claims{
+		Subject:   strconv.Itoa(user.ID),
+		Role:      user.Role,
+		SessionID: sessionID,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(ttl).Unix(),
+	})
+}
+
+// loadRevocations adds the sessions revoked in the database during the
+// last ttl, the lifetime of access tokens, to revocations
+func loadRevocations(tokens store.Tokens, revocations *auth.Revocations, ttl time.Duration) error {
+	var revoked []models.Token
+	err := tokens.ListRevoked(&revoked, time.Now().Add(-ttl))
+	if err != nil {
+		return err
+	}
+	for _, token := range revoked {
+		revocations.Revoke(token.SessionID, token.RevokedAt.Add(ttl))
+	}
+	return nil
+}
+
+// syncRevocations loads the sessions just revoked in the database, so their
+// access tokens are rejected right away. A failure is only logged, the
+// revocation worker loads them later.
+func syncRevocations(tokens store.Tokens, revocations *auth.Revocations, ttl time.Duration) {
+	if err := loadRevocations(tokens, revocations, ttl); err != nil {
+		log.Printf("Failed to load revoked sessions: %s\n", err)
+	}
+}
+
+// StartRevocationWorker loads the sessions revoked by every instance of the
+// API every interval, in the background, and forgets the sessions whose
+// access tokens have expired.
+func StartRevocationWorker(tokens store.Tokens, revocations *auth.Revocations, ttl time.Duration, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			revocations.Forget(time.Now())
+			if err := loadRevocations(tokens, revocations, ttl); err != nil {
+				log.Printf("Failed to load revoked sessions: %s\n", err)
+			}
+		}
+	}()
+}
+
+// issueTokens answers with a new access token for user and the refresh token
+// of its session
+func issueTokens(c *gin.Context, keys *auth.Keys, ttl time.Duration, user models.User, token models.Token, refreshToken string) {
+	accessToken, err := signAccessToken(keys, ttl, user, token.SessionID)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, newTokenResponse(accessToken, ttl, token, refreshToken))
+}
+
+// Exchange a refresh token for a new access token and refresh token.
+// Each refresh token works once, reusing one revokes its session.
+func (repository *TokenRepo) RefreshToken(c *gin.Context) {
+	var body struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+	if !bindJSON(c, &body) {
+		return
+	}
+
 	var token models.Token
-	c.BindJSON(&token)
-	user, _ := c.Get("user")
-	tokenObject, err := models.CreateToken(repository.Db, user.(models.User))
+	refreshToken, err := repository.Tokens.Rotate(&token, body.RefreshToken, repository.Lifetimes.RefreshToken)
+	if err != nil {
+		if errors.Is(err, models.ErrRefreshTokenReused) {
+			syncRevocations(repository.Tokens, repository.Revocations, repository.Lifetimes.AccessToken)
+		}
+		abortWithError(c, err)
+		return
+	}
+
+	// The role is read again, so role changes apply from the next refresh
+	var user models.User
+	err = repository.Users.Get(&user, strconv.Itoa(token.UserID))
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		if errors.Is(err, store.ErrNotFound) {
+			repository.Tokens.RevokeSession(token.SessionID)
+			repository.Revocations.Revoke(token.SessionID, time.Now().Add(repository.Lifetimes.AccessToken))
+			abortWithError(c, models.ErrRefreshTokenInvalid)
+			return
+		}
+		abortWithError(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, tokenObject)
+	issueTokens(c, repository.Keys, repository.Lifetimes.AccessToken, user, token, refreshToken)
 }
 
 // get Token by id
 func (repository *TokenRepo) GetToken(tokenID uint) (*models.Token, error) {
 	var token models.Token
-	err := repository.Db.First(&token, tokenID).Error
+	err := repository.Tokens.Get(&token, strconv.FormatUint(uint64(tokenID), 10))
 	if err != nil {
 		return nil, err
 	}
 	return &token, nil
 }
 
-func (repository *TokenRepo) GetTokenByTokenString(tokenString string) (*models.Token, error) {
-	var token models.Token
-	err := repository.Db.Where("token = ? AND starting_date <= ? AND ending_date >= ?", tokenString, time.Now(), time.Now()).First(&token).Error
+// revoke all sessions of any user
+func (repository *TokenRepo) RevokeUserSessions(c *gin.Context) {
+	id := c.Param("id")
+	var user models.User
+	err := repository.Users.Get(&user, id)
 	if err != nil {
-		return nil, err
+		abortWithError(c, err)
+		return
 	}
-	return &token, nil
+	revoked, err := repository.Tokens.RevokeUser(user.ID)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	syncRevocations(repository.Tokens, repository.Revocations, repository.Lifetimes.AccessToken)
+	c.JSON(http.StatusOK, gin.H{"status": "Sessions revoked", "revoked": revoked})
 }
@@ -4,65 +4,153 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"errors"
-	"fmt"
 	"log"
 	"net/http"
-	"net/smtp"
-	"os"
-	"project/database"
+	netmail "net/mail"
+	"project/auth"
+	"project/config"
+	"project/mail"
+	"project/store"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
-	"gorm.io/gorm"
 
 	"project/models"
 )
 
 type UserRepo struct {
-	Db *gorm.DB
+	Users       store.Users
+	Tokens      store.Tokens
+	Bookings    store.Bookings
+	Emails      Emails
+	Keys        *auth.Keys
+	Revocations *auth.Revocations
+	Lifetimes   config.Lifetimes
 }
 
 type StatusUser struct {
 	Status string
 }
 
-func NewUserController() *UserRepo {
-	db := database.InitDb()
-	db.AutoMigrate(&models.User{})
-	return &UserRepo{Db: db}
+func NewUserController(repos store.Repositories, cfg config.Config, services Services) *UserRepo {
+
+	// Bootstrap the first administrator from the configuration
+	if cfg.AdminEmail != "" {
+		if err := repos.Users.SetRoleByEmail(cfg.AdminEmail, models.RoleAdmin); err != nil {
+			log.Printf("Failed to grant admin role to %s: %s\n", cfg.AdminEmail, err)
+		}
+	}
+
+	return &UserRepo{
+		Users:       repos.Users,
+		Tokens:      repos.Tokens,
+		Bookings:    repos.Bookings,
+		Emails:      NewEmails(repos, cfg),
+		Keys:        services.Keys,
+		Revocations: services.Revocations,
+		Lifetimes:   cfg.Lifetimes,
+	}
+}
+
+// userCreateRequest is the body of POST /users
+type userCreateRequest struct {
+	Username string `json:"username" binding:"required"`
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required"`
+	Role     string `json:"role" binding:"omitempty,oneof=customer agent admin"`
+	Locale   string `json:"locale"`
+}
+
+// registerRequest is the body of POST /register
+type registerRequest struct {
+	Username string `json:"username" binding:"required"`
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required"`
+	Locale   string `json:"locale"`
+}
+
+type loginRequest struct {
+	Email    string `json:"email" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+type emailRequest struct {
+	Email string `json:"email" binding:"required,email"`
 }
 
 // create User
 func (repository *UserRepo) CreateUser(c *gin.Context) {
-	var User models.User
-	c.BindJSON(&User)
-	err := models.CreateUser(repository.Db, &User)
+	var request userCreateRequest
+	if !bindJSON(c, &request) {
+		return
+	}
+	User := models.User{
+		Username: request.Username,
+		Email:    request.Email,
+		Password: request.Password,
+		Role:     request.Role,
+		Locale:   request.Locale,
+	}
+	if User.Role == "" {
+		User.Role = models.RoleCustomer
+	}
+	if err := models.ValidatePassword(User.Password, User); err != nil {
+		abortWithError(c, invalidPassword("password", err))
+		return
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(User.Password), bcrypt.DefaultCost)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	User.Password = string(hashedPassword)
+	err = repository.Users.Create(&User)
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		abortWithError(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, User)
+	c.JSON(http.StatusOK, newUserResponse(User))
 }
 
 func (repository *UserRepo) Register(c *gin.Context) {
-	var user models.User
-	c.BindJSON(&user)
+	var request registerRequest
+	if !bindJSON(c, &request) {
+		return
+	}
+	user := models.User{
+		Username: request.Username,
+		Email:    request.Email,
+		Password: request.Password,
+		Locale:   request.Locale,
+	}
+	if err := models.ValidatePassword(user.Password, user); err != nil {
+		abortWithError(c, invalidPassword("password", err))
+		return
+	}
 	// Hash password before storing it in the database
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash the password"})
+		abortWithError(c, err)
 		return
 	}
 	user.Password = string(hashedPassword)
 
+	user.Active = false
+	user.Role = models.RoleCustomer
+	user.Locale = mail.NormalizeLocale(user.Locale)
+	if user.Locale == "" {
+		user.Locale = mail.DefaultLocale
+	}
 	user.ActivationCode = generateActivationCode()
-	err = models.Register(repository.Db, &user)
+	activationExpiresAt := time.Now().Add(repository.Lifetimes.ActivationCode)
+	user.ActivationExpiresAt = &activationExpiresAt
+	err = repository.Users.Register(&user)
 
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		abortWithError(c, err)
 		return
 	}
 	/*
@@ -72,14 +160,66 @@ func (repository *UserRepo) Register(c *gin.Context) {
 		}
 	*/
 
-	if err := sendActivationEmail(user); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send activation email"})
+	// The account exists either way, a lost email can be sent again with
+	// /activate/resend
+	queueActivationEmail(repository.Emails, user)
+
+	c.JSON(http.StatusOK, gin.H{"message": "User registered successfully"})
+}
+
+// Activate a user account with the code sent by email.
+// The code is read from the "code" query parameter or from a JSON body.
+func (repository *UserRepo) Activate(c *gin.Context) {
+	code := c.Query("code")
+	if code == "" {
+		var body struct {
+			Code string `json:"code" binding:"required"`
+		}
+		if !bindJSON(c, &body) {
+			return
+		}
+		code = body.Code
+	}
+
+	var user models.User
+	err := repository.Users.Activate(&user, code)
+	if err != nil {
+		abortWithError(c, err)
 		return
 	}
 
-	user.Active = true
+	c.JSON(http.StatusOK, gin.H{"message": "Account activated successfully"})
+}
+
+// Send a fresh activation email. The response is the same whether or not
+// the address belongs to an inactive account, so it can't be used to probe
+// which emails are registered.
+func (repository *UserRepo) ResendActivation(c *gin.Context) {
+	var body emailRequest
+	if !bindJSON(c, &body) {
+		return
+	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "User registered successfully"})
+	var user models.User
+	err := repository.Users.GetByEmail(&user, body.Email)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		abortWithError(c, err)
+		return
+	}
+
+	if err == nil && !user.Active {
+		err = repository.Users.SetActivationCode(&user, generateActivationCode(), time.Now().Add(repository.Lifetimes.ActivationCode))
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		if err := queueActivationEmail(repository.Emails, user); err != nil {
+			abortWithError(c, err)
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "If the account exists and is not active yet, a new activation email has been sent"})
 }
 
 func generateActivationCode() string {
@@ -88,50 +228,28 @@ func generateActivationCode() string {
 	return hex.EncodeToString(token)
 }
 
-func sendActivationEmail(user models.User) error {
-	// Kullanıcının e-posta adresini alın
-	recipientEmail := user.Email
-
-	// E-posta konusu ve içeriği oluşturun
-	subject := "Hesap Aktivasyonu Tamamlandı"
-	body := "Merhaba " + user.Username + ",\n\nHesabınız başarıyla aktive edildi. Artık giriş yapabilir ve sitemizi kullanabilirsiniz.\n\nTeşekkürler,\nSitemiz Ekibi"
-
-	// Get Sender Name and Sender Email Address from environment variables
-	senderName := os.Getenv("SENDER_NAME")
-	senderEmailVisible := os.Getenv("SENDER_EMAIL_VISIBLE")
-
-	// E-postanın gönderici adresi ve bilgileri
-	senderEmail := os.Getenv("SENDER_EMAIL")
-	senderPassword := os.Getenv("SENDER_PASSWORD")
-	smtpServer := os.Getenv("SMTP_SERVER")
-	smtpPortStr := os.Getenv("SMTP_PORT")
-	smtpPort, err := strconv.Atoi(smtpPortStr)
-	if err != nil {
-		log.Printf("SMTP_PORT is not a valid integer: %s\n", err)
-		return err
-	}
-
-	// E-posta gövdesini ayarlayın
-	//message := []byte("From: " + senderName + "<" + senderEmailVisible + ">" + "\r\n" + "To: " + recipientEmail + "\r\n" + "Subject: " + subject + "\r\n" + "\r\n" + body + "\r\n")
-	message := []byte("To: " + recipientEmail + "\r\n" + "From: \"" + senderName + "\" <" + senderEmailVisible + ">\r\n" + "Subject: " + subject + "\r\n" + "\r\n" + body + "\r\n")
-
-	// SMTP sunucusuna bağlanın ve e-postayı gönderin
-	auth := smtp.PlainAuth("", senderEmail, senderPassword, smtpServer)
-	err = smtp.SendMail(smtpServer+":"+strconv.Itoa(smtpPort), auth, senderEmail, []string{recipientEmail}, message)
-	if err != nil {
-		log.Printf("Error sending activation email to %s: %s\n", recipientEmail, err)
-		return err
+// queueActivationEmail puts the activation email of user in the outbox. The
+// link in it opens /activate with the code.
+func queueActivationEmail(emails Emails, user models.User) error {
+	data := activationEmail{Name: user.Username, Link: emails.link("/activate", "code", user.ActivationCode)}
+	if user.ActivationExpiresAt != nil {
+		data.ExpiresAt = *user.ActivationExpiresAt
 	}
-
-	return nil
+	return emails.queueTemplate(user.Email, user.Locale, mail.TemplateActivation, data)
 }
 
+// AuthMiddleware checks the signed access token of the request and that
+// its user still exists and has not revoked it. Logging out everywhere and
+// password changes revoke the access tokens issued until then, to the
+// second. Logging out of one session only ends its refresh token, its
+// access token works until it expires, after the access token lifetime at
+// most.
 func AuthMiddleware(tokenRepo *TokenRepo) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		tokenString := c.GetHeader("Authorization")
 
 		if tokenString == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authorization token not provided"})
+			abortWithError(c, unauthorized("Authorization token not provided"))
 			return
 		}
 
@@ -140,37 +258,81 @@ func AuthMiddleware(tokenRepo *TokenRepo) gin.HandlerFunc {
 			tokenString = tokenString[7:]
 		}
 
-		fmt.Println("Token string:", tokenString) // logging added here
-
-		// Get the token from the database based on the token string
-		tokenObj, err := tokenRepo.GetTokenByTokenString(tokenString)
+		claims, err := tokenRepo.Keys.Verify(tokenString, time.Now())
 		if err != nil {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Token not validated"})
+			if errors.Is(err, auth.ErrTokenExpired) {
+				abortWithError(c, &apiError{Status: http.StatusUnauthorized, Code: codeTokenExpired, Message: "Authorization token has expired"})
+				return
+			}
+			abortWithError(c, unauthorized("Invalid authorization token"))
 			return
 		}
-
-		// Check if the token is valid based on its start and expiry dates
-		if time.Now().Before(*tokenObj.StartingDate) || time.Now().After(*tokenObj.EndingDate) {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization token"})
+		userID, err := strconv.Atoi(claims.Subject)
+		if err != nil {
+			abortWithError(c, unauthorized("Invalid authorization token"))
+			return
+		}
+		// Sessions are revoked in memory, the database is only read on refresh
+		if tokenRepo.Revocations.Revoked(claims.SessionID, time.Now()) {
+			abortWithError(c, &apiError{Status: http.StatusUnauthorized, Code: codeTokenRevoked, Message: "Authorization token has been revoked"})
 			return
 		}
 
-		// Set user ID in context for further use
-		c.Set("user_id", tokenObj.UserID)
+		// Set user, role and session in context for further use
+		c.Set("user_id", userID)
+		c.Set("user_role", claims.Role)
+		c.Set("session_id", claims.SessionID)
 		c.Next()
 
 	}
 }
 
+// RequireRoles only lets through users that have one of the given roles.
+// It must be used after AuthMiddleware.
+func RequireRoles(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := c.GetString("user_role")
+		for _, allowed := range roles {
+			if role == allowed {
+				c.Next()
+				return
+			}
+		}
+		abortWithError(c, forbidden("You are not allowed to access this resource"))
+	}
+}
+
+// isSelfOrRole reports whether the current user is the user with the given
+// id, or has one of the given roles.
+func isSelfOrRole(c *gin.Context, id string, roles ...string) bool {
+	if strconv.Itoa(c.GetInt("user_id")) == id {
+		return true
+	}
+	role := c.GetString("user_role")
+	for _, allowed := range roles {
+		if role == allowed {
+			return true
+		}
+	}
+	return false
+}
+
 func (repository *UserRepo) Login(c *gin.Context) {
+	var request loginRequest
+	if !bindJSON(c, &request) {
+		return
+	}
 	var user models.User
-	c.BindJSON(&user)
-	email := user.Email
-	password := user.Password
-	err := models.Login(repository.Db, &user, email)
+	email := request.Email
+	password := request.Password
+	err := repository.Users.GetByEmail(&user, email)
 
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if errors.Is(err, store.ErrNotFound) {
+			abortWithError(c, unauthorized("Invalid credentials"))
+			return
+		}
+		abortWithError(c, err)
 		return
 	}
 	/*
@@ -184,18 +346,18 @@ func (repository *UserRepo) Login(c *gin.Context) {
 
 	// Compare hashed passwords
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		abortWithError(c, unauthorized("Invalid credentials"))
 		return
 	}
 
 	if !user.Active {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Account is not activated. Please activate your account."})
+		abortWithError(c, &apiError{Status: http.StatusUnauthorized, Code: "account_inactive", Message: "Account is not activated. Please activate your account."})
 		return
 	}
 
-	token, err := models.CreateToken(repository.Db, user)
+	token, refreshToken, err := repository.Tokens.Create(user, repository.Lifetimes.RefreshToken)
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		abortWithError(c, err)
 		return
 	}
 	/*
@@ -208,151 +370,246 @@ func (repository *UserRepo) Login(c *gin.Context) {
 		}
 	*/
 
-	c.JSON(http.StatusOK, gin.H{"token": token.Token, "start": token.StartingDate, "expiry": token.EndingDate, "message": "User logged in successfully"})
+	issueTokens(c, repository.Keys, repository.Lifetimes.AccessToken, user, token, refreshToken)
 	//c.JSON(http.StatusOK, gin.H{"message": "User logged in successfully"})
 }
 
-// Book a ticket
-func (repository *UserRepo) BookTicket(c *gin.Context) {
-	// Get user ID from the context
-	userID, exists := c.Get("user_id")
-	if !exists {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user ID"})
+var userListSpec = listSpec{
+	Sorts: map[string]string{
+		"id":       "id",
+		"username": "username",
+		"email":    "email",
+		"created":  "created_at",
+	},
+	DefaultSort: "id",
+	Filters: []listFilter{
+		{Param: "role", Column: "role", Operator: store.Equal, Kind: "string"},
+		{Param: "active", Column: "active", Operator: store.Equal, Kind: "bool"},
+		{Param: "created_from", Column: "created_at", Operator: store.GreaterOrEqual, Kind: "time"},
+		{Param: "created_to", Column: "created_at", Operator: store.Less, Kind: "time"},
+	},
+}
+
+// get Users
+func (repository *UserRepo) GetUsers(c *gin.Context) {
+	params, err := parseListParams(c, userListSpec)
+	if err != nil {
+		abortWithError(c, err)
 		return
 	}
-
-	// Get the ticket ID from the request parameters
-	ticketID := c.Param("ticket_id")
-
-	// Retrieve the ticket from the database
-	var ticket models.Ticket
-	err := models.GetTicket(repository.Db, &ticket, ticketID)
+	var User []models.User
+	total, err := repository.Users.List(&User, params.query())
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.AbortWithStatus(http.StatusNotFound)
-			return
-		}
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		abortWithError(c, err)
 		return
 	}
+	setPageHeaders(c, params, total)
+	c.JSON(http.StatusOK, newUserResponses(User))
+}
 
-	// Check if the ticket is available
-	if ticket.NofSeats == "0" {
-		c.JSON(http.StatusConflict, gin.H{"error": "Ticket is not available"})
+// get User by id
+func (repository *UserRepo) GetUser(c *gin.Context) {
+	id, _ := c.Params.Get("id")
+	if !isSelfOrRole(c, id, models.RoleAdmin) {
+		abortWithError(c, forbidden("You are not allowed to access this resource"))
 		return
 	}
-
-	// Convert the number of seats to an integer
-	numSeats, err := strconv.Atoi(ticket.NofSeats)
+	var User models.User
+	err := repository.Users.Get(&User, id)
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		abortWithError(c, err)
 		return
 	}
+	c.JSON(http.StatusOK, newUserResponse(User))
+}
 
-	// Decrement the number of seats available in the ticket
-	numSeats -= 1
-	ticket.NofSeats = strconv.Itoa(numSeats)
+// userUpdateRequest is the body of PATCH /users/:id, fields left out are
+// not changed
+type userUpdateRequest struct {
+	models.UserProfile
+	Role *string `json:"role" binding:"omitempty,oneof=customer agent admin"` // admins only
+	// not accepted here, only listed to tell clients where they go
+	Password       *string `json:"password"`
+	Active         *bool   `json:"active"`
+	ActivationCode *string `json:"activation_code"`
+}
 
-	// Update the ticket in the database
-	err = models.UpdateTicket(repository.Db, &ticket, ticketID)
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+// update the profile of a User
+func (repository *UserRepo) UpdateUser(c *gin.Context) {
+	id, _ := c.Params.Get("id")
+	if !isSelfOrRole(c, id, models.RoleAdmin) {
+		abortWithError(c, forbidden("You are not allowed to access this resource"))
 		return
 	}
-	// Convert the user ID to the desired type (int)
-	userIDInt, ok := userID.(int)
-	if !ok {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to convert user ID to int"})
+	var request userUpdateRequest
+	if !bindJSON(c, &request) {
 		return
 	}
-
-	// Create a new booked ticket record
-	bookedTicket := models.BTicket{
-		TicketID: ticket.ID,
-		UserID:   userIDInt,
+	if request.Password != nil {
+		abortWithError(c, invalidField("password", "is changed with POST /users/"+id+"/password"))
+		return
 	}
-
-	// Create the booked ticket in the database
-	err = models.CreateBTicket(repository.Db, &bookedTicket)
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+	if request.Active != nil {
+		abortWithError(c, invalidField("active", "accounts are activated with the code sent by email"))
+		return
+	}
+	if request.ActivationCode != nil {
+		abortWithError(c, invalidField("activation_code", "accounts are activated with the code sent by email"))
+		return
+	}
+	if request.Role != nil && c.GetString("user_role") != models.RoleAdmin {
+		abortWithError(c, forbidden("Only admins can change roles"))
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Ticket booked successfully"})
-}
+	profile := request.UserProfile
+	if profile.Username != nil {
+		username := strings.TrimSpace(*profile.Username)
+		if username == "" {
+			abortWithError(c, invalidField("username", "can't be empty"))
+			return
+		}
+		profile.Username = &username
+	}
+	if profile.Email != nil {
+		address, err := netmail.ParseAddress(*profile.Email)
+		if err != nil || address.Name != "" {
+			abortWithError(c, invalidField("email", "must be a valid email address"))
+			return
+		}
+		profile.Email = &address.Address
+	}
+	if profile.Locale != nil {
+		locale := mail.NormalizeLocale(*profile.Locale)
+		if locale == "" {
+			abortWithError(c, invalidField("locale", "is not supported"))
+			return
+		}
+		profile.Locale = &locale
+	}
 
-// get Users
-func (repository *UserRepo) GetUsers(c *gin.Context) {
-	var User []models.User
-	err := models.GetUsers(repository.Db, &User)
+	var User models.User
+	err := repository.Users.Update(&User, id, profile)
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		abortWithError(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, User)
+	if request.Role != nil {
+		err = repository.Users.SetRole(&User, id, *request.Role)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+	}
+	c.JSON(http.StatusOK, newUserResponse(User))
 }
 
-// get User by id
-func (repository *UserRepo) GetUser(c *gin.Context) {
+// Change the password of the current user, which needs the current password.
+// Other sessions of the user are logged out, and the current one gets a new
+// access token since the ones issued before are revoked.
+func (repository *UserRepo) ChangePassword(c *gin.Context) {
 	id, _ := c.Params.Get("id")
-	var User models.User
-	err := models.GetUser(repository.Db, &User, id)
-	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.AbortWithStatus(http.StatusNotFound)
-			return
-		}
+	if id != strconv.Itoa(c.GetInt("user_id")) {
+		abortWithError(c, forbidden("You can only change your own password"))
+		return
+	}
+	var body struct {
+		CurrentPassword string `json:"current_password" binding:"required"`
+		NewPassword     string `json:"new_password" binding:"required"`
+	}
+	if !bindJSON(c, &body) {
+		return
+	}
 
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+	var user models.User
+	err := repository.Users.Get(&user, id)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(body.CurrentPassword)); err != nil {
+		abortWithError(c, forbidden("Current password is incorrect"))
+		return
+	}
+	if err := models.ValidatePassword(body.NewPassword, user); err != nil {
+		abortWithError(c, invalidPassword("new_password", err))
 		return
 	}
-	c.JSON(http.StatusOK, User)
-}
 
-// update User
-func (repository *UserRepo) UpdateUser(c *gin.Context) {
-	id, _ := c.Params.Get("id")
-	var User models.User
-	c.BindJSON(&User)
-	err := models.UpdateUser(repository.Db, &User, id)
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(body.NewPassword), bcrypt.DefaultCost)
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.AbortWithStatus(http.StatusNotFound)
-			return
-		}
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		abortWithError(c, err)
+		return
+	}
+	err = repository.Users.ChangePassword(&user, id, string(hashedPassword), c.GetString("session_id"))
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	syncRevocations(repository.Tokens, repository.Revocations, repository.Lifetimes.AccessToken)
+	accessToken, err := signAccessToken(repository.Keys, repository.Lifetimes.AccessToken, user, c.GetString("session_id"))
+	if err != nil {
+		abortWithError(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, User)
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "Password changed, other sessions have been logged out",
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   int64(repository.Lifetimes.AccessToken / time.Second),
+	})
 }
 
 // delete Country
 func (repository *UserRepo) DeleteUser(c *gin.Context) {
 	id, _ := c.Params.Get("id")
 	var User models.User
-	err := models.DeleteUser(repository.Db, &User, id)
+	err := repository.Users.Get(&User, id)
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.AbortWithStatus(http.StatusNotFound)
-			return
-		}
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err})
+		abortWithError(c, err)
+		return
+	}
+	err = repository.Users.Delete(&User, id)
+	if err != nil {
+		abortWithError(c, err)
 		return
 	}
+	syncRevocations(repository.Tokens, repository.Revocations, repository.Lifetimes.AccessToken)
 	c.JSON(http.StatusOK, gin.H{"status": "User deleted"})
 }
 
+// Log out by revoking the session of the access token used for this request
 func (repository *UserRepo) Logout(c *gin.Context) {
-	/*
-		// Clear session cookie
-		session := sessions.Default(c)
-		session.Clear()
-		if err := session.Save(); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
+	sessionID := c.GetString("session_id")
+	if sessionID == "" {
+		abortWithError(c, errors.New("failed to get session ID"))
+		return
+	}
 
-		c.JSON(http.StatusOK, gin.H{"message": "User logged out successfully"})
-	*/
+	err := repository.Tokens.RevokeSession(sessionID)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	repository.Revocations.Revoke(sessionID, time.Now().Add(repository.Lifetimes.AccessToken))
+
+	c.JSON(http.StatusOK, gin.H{"message": "User logged out successfully"})
+}
+
+// Log out everywhere by revoking every token of the current user
+func (repository *UserRepo) LogoutAll(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		abortWithError(c, errors.New("failed to get user ID"))
+		return
+	}
+
+	revoked, err := repository.Tokens.RevokeUser(userID.(int))
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	syncRevocations(repository.Tokens, repository.Revocations, repository.Lifetimes.AccessToken)
+
+	c.JSON(http.StatusOK, gin.H{"message": "User logged out from all sessions", "revoked": revoked})
 }
@@ -2,56 +2,62 @@ package database
 
 import (
 	"fmt"
-	"os"
+	"log"
+	"net"
+	"project/config"
+	"strconv"
+	"time"
 
+	mysqldriver "github.com/go-sql-driver/mysql"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 )
 
-var DB_USERNAME = "root"
-var DB_PASSWORD = "projectDbPass"
-var DB_NAME = "databasepr"
-var DB_HOST = "project-db"
-var DB_PORT = "3306"
-
-var Db *gorm.DB
-
-func InitDb() *gorm.DB {
-	Db = connectDB()
-	return Db
-}
-
-func connectDB() *gorm.DB {
-
-	if len(os.Getenv("PROJECT_USER")) > 0 {
-		DB_USERNAME = os.Getenv("PROJECT_USER")
-	}
-
-	if len(os.Getenv("PROJECT_HOST")) > 0 {
-		DB_HOST = os.Getenv("PROJECT_HOST")
-	}
-
-	if len(os.Getenv("PROJECT_PASS")) > 0 {
-		DB_PASSWORD = os.Getenv("PROJECT_PASS")
-	}
-
-	if len(os.Getenv("PROJECT_PORT")) > 0 {
-		DB_PORT = os.Getenv("PROJECT_PORT")
-	}
-
-	if len(os.Getenv("PROJECT_NAME")) > 0 {
-		DB_NAME = os.Getenv("PROJECT_NAME")
-	}
-
-	var err error
-	dsn := DB_USERNAME + ":" + DB_PASSWORD + "@tcp" + "(" + DB_HOST + ":" + DB_PORT + ")/" + DB_NAME + "?" + "parseTime=true&loc=Local"
-	fmt.Println("dsn : ", dsn)
-	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
-
-	if err != nil {
-		fmt.Println("Error connecting to database : error=%v", err)
-		return nil
+// Open connects to the database and sets up the connection pool. The
+// database often starts together with the server, so failed attempts are
+// retried with backoff until cfg.ConnectTimeout has passed.
+func Open(cfg config.Database) (*gorm.DB, error) {
+	dsn := dataSourceName(cfg)
+
+	deadline := time.Now().Add(cfg.ConnectTimeout)
+	backoff := 500 * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+		if err == nil {
+			sqlDB, err := db.DB()
+			if err != nil {
+				return nil, err
+			}
+			sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+			sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+			sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+			sqlDB.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+			return db, nil
+		}
+
+		// The error names the host but never the password
+		if time.Now().Add(backoff).After(deadline) {
+			return nil, fmt.Errorf("connecting to database %s on %s:%d failed after %d attempts: %w", cfg.Name, cfg.Host, cfg.Port, attempt, err)
+		}
+		log.Printf("Connecting to database %s on %s:%d failed, retrying in %s: %s\n", cfg.Name, cfg.Host, cfg.Port, backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > 10*time.Second {
+			backoff = 10 * time.Second
+		}
 	}
+}
 
-	return db
+// dataSourceName returns the DSN of the database, the driver escapes the
+// password and the other settings
+func dataSourceName(cfg config.Database) string {
+	dsn := mysqldriver.NewConfig()
+	dsn.User = cfg.User
+	dsn.Passwd = cfg.Password
+	dsn.Net = "tcp"
+	dsn.Addr = net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+	dsn.DBName = cfg.Name
+	dsn.ParseTime = true
+	dsn.Loc = time.Local
+	return dsn.FormatDSN()
 }
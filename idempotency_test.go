@@ -0,0 +1,144 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"project/config"
+	"project/controllers"
+	"project/models"
+	"project/store"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestIdempotencyKeyReplaysTheFirstResponse(t *testing.T) {
+	api := newTestAPI(t)
+	session := api.login(api.createUser("ayse", models.RoleCustomer))
+	ticket := api.createTicket(10, 150000)
+	key := map[string]string{"Idempotency-Key": "book-once"}
+	request := map[string]interface{}{"ticket_ids": []int{ticket.ID}, "passengers": []interface{}{adult}}
+
+	first := api.requestWithHeaders(http.MethodPost, "/bookings", session.AccessToken, key, request)
+	api.expect(first, http.StatusOK, nil)
+	replay := api.requestWithHeaders(http.MethodPost, "/bookings", session.AccessToken, key, request)
+	api.expect(replay, http.StatusOK, nil)
+	if replay.Header().Get("Idempotent-Replayed") != "true" || replay.Body.String() != first.Body.String() {
+		t.Errorf("replay = %s, want the first response replayed", replay.Body)
+	}
+	var bookings int64
+	api.db.Model(&models.Booking{}).Count(&bookings)
+	if bookings != 1 {
+		t.Errorf("%d bookings, want 1", bookings)
+	}
+
+	var body apiErrorBody
+	request["passengers"] = []interface{}{adult, adult}
+	api.expect(api.requestWithHeaders(http.MethodPost, "/bookings", session.AccessToken, key, request), http.StatusUnprocessableEntity, &body)
+	if body.Error.Code != "idempotency_key_reused" {
+		t.Errorf("code = %q, want idempotency_key_reused", body.Error.Code)
+	}
+}
+
+func TestAnonymousIdempotencyKeyRejectsAnotherRequest(t *testing.T) {
+	api := newTestAPI(t)
+	key := map[string]string{"Idempotency-Key": "register"}
+	register := func(username string) map[string]string {
+		return map[string]string{"username": username, "email": username + "@example.com", "password": testPassword}
+	}
+
+	api.expect(api.requestWithHeaders(http.MethodPost, "/register", "", key, register("mehmet")), http.StatusOK, nil)
+	var body apiErrorBody
+	api.expect(api.requestWithHeaders(http.MethodPost, "/register", "", key, register("ayse")), http.StatusUnprocessableEntity, &body)
+	if body.Error.Code != "idempotency_key_reused" {
+		t.Errorf("code = %q, want idempotency_key_reused", body.Error.Code)
+	}
+	var users int64
+	api.db.Model(&models.User{}).Count(&users)
+	if users != 1 {
+		t.Errorf("%d users, want 1", users)
+	}
+}
+
+// Retries sent while the first request runs either wait for a replay or are
+// told to retry later, the request itself runs once.
+func TestConcurrentRequestsWithOneIdempotencyKey(t *testing.T) {
+	api := newTestAPI(t)
+	session := api.login(api.createUser("ayse", models.RoleCustomer))
+	ticket := api.createTicket(10, 150000)
+	key := map[string]string{"Idempotency-Key": "book-concurrently"}
+	request := map[string]interface{}{"ticket_ids": []int{ticket.ID}, "passengers": []interface{}{adult}}
+
+	const retries = 20
+	responses := make(chan *httptest.ResponseRecorder, retries)
+	var wg sync.WaitGroup
+	for i := 0; i < retries; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			responses <- api.requestWithHeaders(http.MethodPost, "/bookings", session.AccessToken, key, request)
+		}()
+	}
+	wg.Wait()
+	close(responses)
+
+	ran := 0
+	for recorder := range responses {
+		switch {
+		case recorder.Code == http.StatusOK && recorder.Header().Get("Idempotent-Replayed") == "":
+			ran++
+		case recorder.Code == http.StatusOK:
+		case recorder.Code == http.StatusConflict && recorder.Body.Len() > 0:
+		default:
+			t.Errorf("status %d: %s", recorder.Code, recorder.Body)
+		}
+	}
+	var bookings int64
+	api.db.Model(&models.Booking{}).Count(&bookings)
+	if ran != 1 || bookings != 1 {
+		t.Errorf("the request ran %d times and made %d bookings, want 1 and 1", ran, bookings)
+	}
+}
+
+func TestIdempotencyKeyIsReleasedWhenTheHandlerPanics(t *testing.T) {
+	api := newTestAPI(t)
+	router := gin.New()
+	router.Use(gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, _ interface{}) {
+		c.AbortWithStatus(http.StatusInternalServerError)
+	}))
+	calls := 0
+	router.POST("/flaky", controllers.IdempotencyMiddleware(controllers.NewIdempotencyController(store.New(api.db), config.Default())), func(c *gin.Context) {
+		calls++
+		if calls == 1 {
+			panic("first call fails")
+		}
+		c.JSON(http.StatusOK, gin.H{"calls": calls})
+	})
+	api.router = router
+	key := map[string]string{"Idempotency-Key": "flaky"}
+
+	api.expect(api.requestWithHeaders(http.MethodPost, "/flaky", "", key, nil), http.StatusInternalServerError, nil)
+	api.expect(api.requestWithHeaders(http.MethodPost, "/flaky", "", key, nil), http.StatusOK, nil)
+	if calls != 2 {
+		t.Errorf("the handler ran %d times, want 2", calls)
+	}
+}
+
+// The new access token of a password change must never be stored
+func TestPasswordChangesAreNotRemembered(t *testing.T) {
+	api := newTestAPI(t)
+	user := api.createUser("ayse", models.RoleCustomer)
+	session := api.login(user)
+	api.expect(api.requestWithHeaders(http.MethodPost, "/users/"+strconv.Itoa(user.ID)+"/password", session.AccessToken, map[string]string{"Idempotency-Key": "password"}, map[string]string{
+		"current_password": testPassword,
+		"new_password":     "Another456?",
+	}), http.StatusOK, nil)
+	var keys int64
+	api.db.Model(&models.IdempotencyKey{}).Count(&keys)
+	if keys != 0 {
+		t.Errorf("%d idempotency keys stored, want 0", keys)
+	}
+}
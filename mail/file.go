@@ -0,0 +1,28 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// FileMailer writes each email to a .eml file in Dir instead of sending it,
+// for local development. The files open in any mail client.
+type FileMailer struct {
+	Dir   string
+	count atomic.Int64
+}
+
+func (mailer *FileMailer) Send(ctx context.Context, message Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(mailer.Dir, 0o755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%d.eml", time.Now().Format("20060102-150405.000000"), mailer.count.Add(1))
+	return os.WriteFile(filepath.Join(mailer.Dir, name), message.Bytes(), 0o644)
+}
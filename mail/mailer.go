@@ -0,0 +1,118 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"project/config"
+	"strings"
+	"time"
+)
+
+// Message is an email to send.
+type Message struct {
+	// From is the address shown to recipients, e.g. "Team <team@example.com>"
+	From    string
+	To      []string
+	Subject string
+	Body    string // plain text
+	// HTML is sent next to Body as multipart/alternative when set
+	HTML string
+}
+
+// Mailer sends emails.
+type Mailer interface {
+	Send(ctx context.Context, message Message) error
+}
+
+// Bytes encodes the message in the RFC 5322 format
+func (message Message) Bytes() []byte {
+	var buf bytes.Buffer
+	writeHeader := func(name, value string) {
+		buf.WriteString(name + ": " + value + "\r\n")
+	}
+	writeHeader("From", encodeAddress(message.From))
+	writeHeader("To", strings.Join(message.To, ", "))
+	writeHeader("Subject", mime.QEncoding.Encode("utf-8", message.Subject))
+	writeHeader("Date", time.Now().Format(time.RFC1123Z))
+	writeHeader("Message-ID", messageID(message.From))
+	writeHeader("MIME-Version", "1.0")
+	if message.HTML == "" {
+		writePart(&buf, "text/plain; charset=utf-8", message.Body)
+		return buf.Bytes()
+	}
+
+	parts := multipart.NewWriter(&buf)
+	writeHeader("Content-Type", "multipart/alternative; boundary="+parts.Boundary())
+	buf.WriteString("\r\n")
+	// Clients show the last part they understand, so HTML goes last
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", message.Body},
+		{"text/html; charset=utf-8", message.HTML},
+	} {
+		buf.WriteString("--" + parts.Boundary() + "\r\n")
+		writePart(&buf, part.contentType, part.content)
+		buf.WriteString("\r\n")
+	}
+	buf.WriteString("--" + parts.Boundary() + "--\r\n")
+	return buf.Bytes()
+}
+
+// writePart writes the headers and the quoted-printable content of a part
+func writePart(buf *bytes.Buffer, contentType string, content string) {
+	buf.WriteString("Content-Type: " + contentType + "\r\n")
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+	body := quotedprintable.NewWriter(buf)
+	body.Write([]byte(strings.ReplaceAll(strings.ReplaceAll(content, "\r\n", "\n"), "\n", "\r\n")))
+	body.Close()
+}
+
+// encodeAddress encodes the display name of an address like
+// "Name <user@example.com>" so it can hold non-ASCII characters
+func encodeAddress(address string) string {
+	start := strings.LastIndex(address, "<")
+	if start <= 0 {
+		return address
+	}
+	name := strings.Trim(strings.TrimSpace(address[:start]), `"`)
+	return mime.QEncoding.Encode("utf-8", name) + " " + address[start:]
+}
+
+func messageID(from string) string {
+	domain := "localhost"
+	if at := strings.LastIndex(from, "@"); at >= 0 {
+		domain = strings.TrimRight(from[at+1:], ">")
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	return "<" + hex.EncodeToString(id) + "@" + domain + ">"
+}
+
+// New returns the Mailer chosen by cfg.Mailer: "smtp", "file" or "memory".
+//
+// SMTP logs in to cfg.SMTPServer with the sender email and password, and
+// SMTPInsecure allows servers without STARTTLS. Files go to cfg.Dir.
+func New(cfg config.Mail) (Mailer, error) {
+	switch cfg.Mailer {
+	case "smtp":
+		return &SMTPMailer{
+			Host:          cfg.SMTPServer,
+			Port:          cfg.SMTPPort,
+			Username:      cfg.SenderEmail,
+			Password:      cfg.SenderPassword,
+			EnvelopeFrom:  cfg.SenderEmail,
+			AllowInsecure: cfg.SMTPInsecure,
+		}, nil
+	case "file":
+		return &FileMailer{Dir: cfg.Dir}, nil
+	case "memory":
+		return &MemoryMailer{}, nil
+	default:
+		return nil, fmt.Errorf("unknown mailer %q", cfg.Mailer)
+	}
+}
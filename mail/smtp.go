@@ -0,0 +1,88 @@
+package mail
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+// SMTPMailer sends emails through an SMTP server. The connection is upgraded
+// with STARTTLS, or uses TLS from the start on port 465.
+type SMTPMailer struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	// EnvelopeFrom is the sender given to the server, where bounces go
+	EnvelopeFrom string
+	// AllowInsecure sends without TLS when the server doesn't offer
+	// STARTTLS, for local test servers only
+	AllowInsecure bool
+}
+
+var ErrNoSTARTTLS = errors.New("SMTP server does not support STARTTLS")
+
+func (mailer *SMTPMailer) Send(ctx context.Context, message Message) error {
+	address := net.JoinHostPort(mailer.Host, strconv.Itoa(mailer.Port))
+	tlsConfig := &tls.Config{ServerName: mailer.Host}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else {
+		conn.SetDeadline(time.Now().Add(time.Minute))
+	}
+	if mailer.Port == 465 {
+		conn = tls.Client(conn, tlsConfig)
+	}
+
+	client, err := smtp.NewClient(conn, mailer.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if mailer.Port != 465 {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(tlsConfig); err != nil {
+				return err
+			}
+		} else if !mailer.AllowInsecure {
+			return ErrNoSTARTTLS
+		}
+	}
+	if mailer.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", mailer.Username, mailer.Password, mailer.Host)); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(mailer.EnvelopeFrom); err != nil {
+		return err
+	}
+	for _, to := range message.To {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	data, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := data.Write(message.Bytes()); err != nil {
+		return err
+	}
+	if err := data.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
@@ -0,0 +1,155 @@
+package mail
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"os"
+	"path"
+	"project/config"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+// email templates
+const (
+	TemplateActivation       = "activation"
+	TemplatePasswordReset    = "password_reset"
+	TemplateBookingConfirmed = "booking_confirmed"
+	TemplateBookingCancelled = "booking_cancelled"
+	TemplateFlightChanged    = "flight_changed"
+)
+
+// DefaultLocale is used for users without a locale, or one without templates
+const DefaultLocale = "tr"
+
+// Locales are the languages emails can be written in
+var Locales = []string{"tr", "en"}
+
+//go:embed templates
+var embeddedTemplates embed.FS
+
+// Templates renders the emails. Each email is a file <locale>/<name>.tmpl
+// defining a "subject", a "text" and an "html" template, and the html part
+// is wrapped in the "layout" template of <locale>/layout.tmpl.
+//
+// Files in Dir replace the built-in ones of the same path, so templates can
+// be changed without rebuilding. They are read on every render.
+type Templates struct {
+	Dir string
+}
+
+// NewTemplates returns the templates, overridden from cfg.TemplateDir when set
+func NewTemplates(cfg config.Mail) Templates {
+	return Templates{Dir: cfg.TemplateDir}
+}
+
+// NormalizeLocale turns a locale such as "en-US" into one emails can be
+// written in, or "" when there is none
+func NormalizeLocale(locale string) string {
+	locale = strings.ToLower(strings.TrimSpace(locale))
+	if i := strings.IndexAny(locale, "-_"); i >= 0 {
+		locale = locale[:i]
+	}
+	for _, supported := range Locales {
+		if locale == supported {
+			return locale
+		}
+	}
+	return ""
+}
+
+// Render builds the message of template name in locale, with data
+func (templates Templates) Render(name string, locale string, data interface{}) (Message, error) {
+	locale = NormalizeLocale(locale)
+	if locale == "" {
+		locale = DefaultLocale
+	}
+	source, err := templates.read(path.Join(locale, name+".tmpl"))
+	if err != nil {
+		return Message{}, err
+	}
+	layout, err := templates.read(path.Join(locale, "layout.tmpl"))
+	if err != nil {
+		return Message{}, err
+	}
+	funcs := templateFuncs(locale)
+
+	text, err := texttemplate.New(name).Funcs(funcs).Parse(source)
+	if err != nil {
+		return Message{}, fmt.Errorf("email template %s/%s: %w", locale, name, err)
+	}
+	var subject, body bytes.Buffer
+	if err := text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return Message{}, err
+	}
+	if err := text.ExecuteTemplate(&body, "text", data); err != nil {
+		return Message{}, err
+	}
+
+	html, err := htmltemplate.New(name).Funcs(htmltemplate.FuncMap(funcs)).Parse(layout)
+	if err == nil {
+		_, err = html.Parse(source)
+	}
+	if err != nil {
+		return Message{}, fmt.Errorf("email template %s/%s: %w", locale, name, err)
+	}
+	var htmlBody bytes.Buffer
+	if err := html.ExecuteTemplate(&htmlBody, "layout", data); err != nil {
+		return Message{}, err
+	}
+
+	return Message{
+		Subject: strings.TrimSpace(subject.String()),
+		Body:    strings.TrimSpace(body.String()) + "\n",
+		HTML:    htmlBody.String(),
+	}, nil
+}
+
+// read returns a template file from Dir, or the built-in one
+func (templates Templates) read(name string) (string, error) {
+	if templates.Dir != "" {
+		data, err := os.ReadFile(path.Join(templates.Dir, name))
+		if err == nil {
+			return string(data), nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+	}
+	data, err := embeddedTemplates.ReadFile(path.Join("templates", name))
+	if err != nil {
+		return "", fmt.Errorf("email template %s: %w", name, err)
+	}
+	return string(data), nil
+}
+
+// templateFuncs formats dates and amounts the way locale writes them
+func templateFuncs(locale string) texttemplate.FuncMap {
+	dateLayout, thousands, decimal := "02.01.2006 15:04", ".", ","
+	if locale == "en" {
+		dateLayout, thousands, decimal = "Jan 2, 2006 15:04", ",", "."
+	}
+	return texttemplate.FuncMap{
+		"date": func(t time.Time) string {
+			return t.Format(dateLayout)
+		},
+		// money formats an amount in minor units, e.g. 123456 TRY as 1.234,56 TRY
+		"money": func(amount int64, currency string) string {
+			sign := ""
+			if amount < 0 {
+				sign, amount = "-", -amount
+			}
+			whole := strconv.FormatInt(amount/100, 10)
+			for i := len(whole) - 3; i > 0; i -= 3 {
+				whole = whole[:i] + thousands + whole[i:]
+			}
+			return fmt.Sprintf("%s%s%s%02d %s", sign, whole, decimal, amount%100, currency)
+		},
+	}
+}
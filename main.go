@@ -1,68 +1,191 @@
 package main
 
 import (
+	"log"
 	"net/http"
+	"os"
+	"project/auth"
+	"project/config"
 	"project/controllers"
+	"project/database"
+	"project/mail"
+	"project/migrations"
+	"project/models"
+	"project/payments"
+	"project/store"
+	"time"
+	_ "time/tzdata" // the alpine image has no zoneinfo
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 func main() {
-	r := setupRouter()
-	_ = r.Run(":8080")
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		migrate(os.Args[2:])
+		return
+	}
+
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatalln(err)
+	}
+	db, err := database.Open(cfg.Database)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if err := migrations.CheckCurrent(db); err != nil {
+		log.Fatalf("%s, run \"%s migrate up\" first\n", err, os.Args[0])
+	}
+
+	keys, err := auth.LoadKeys(cfg.JWT)
+	if err != nil {
+		log.Fatalf("Invalid access token keys: %s\n", err)
+	}
+	gateway, err := payments.New(cfg.PaymentProvider)
+	if err != nil {
+		log.Fatalf("Invalid payment provider: %s\n", err)
+	}
+	services := controllers.Services{Keys: keys, Revocations: auth.NewRevocations(), Payments: gateway}
+
+	r := setupRouter(db, cfg, services)
+	repos := store.New(db)
+	controllers.StartHoldExpiryWorker(repos, time.Minute)
+	controllers.StartRevocationWorker(repos.Tokens, services.Revocations, cfg.Lifetimes.AccessToken, 10*time.Second)
+	controllers.StartRefundRetryWorker(repos.Bookings, services.Payments, time.Minute)
+
+	mailer, err := mail.New(cfg.Mail)
+	if err != nil {
+		log.Fatalf("Invalid mail settings: %s\n", err)
+	}
+	controllers.StartOutboxWorker(repos.Outbox, mailer, 10*time.Second)
+
+	_ = r.Run(cfg.Addr)
 }
 
-func setupRouter() *gin.Engine {
+// setupRouter builds the API on one shared database handle, MySQL in
+// production or the in-memory SQLite of package store/sqlite, and the
+// services built at startup.
+func setupRouter(db *gorm.DB, cfg config.Config, services controllers.Services) *gin.Engine {
 	r := gin.Default()
 
 	r.GET("ping", func(c *gin.Context) {
 		c.JSON(http.StatusOK, "pong")
 	})
 
-	tokenRepo := controllers.NewTokenController()
+	repos := store.New(db)
+	tokenRepo := controllers.NewTokenController(repos, cfg, services)
 	authMiddleware := controllers.AuthMiddleware(tokenRepo)
+	// Retried requests with the same Idempotency-Key get the first response
+	idempotency := controllers.IdempotencyMiddleware(controllers.NewIdempotencyController(repos, cfg))
+
+	userRepo := controllers.NewUserController(repos, cfg, services)
+	airportRepo := controllers.NewAirportController(repos)
+	ticketRepo := controllers.NewTicketController(repos, cfg)
+	bticketRepo := controllers.NewBTicketController(repos, cfg, services)
+	planeRepo := controllers.NewPlaneController(repos)
+	bookingRepo := controllers.NewBookingController(repos, cfg, services)
+
+	// Public routes
+	r.POST("/register", idempotency, userRepo.Register)
+	// Login and refresh are left out of idempotency so issued tokens are never stored
+	r.POST("/login", userRepo.Login)
+	r.POST("/token/refresh", tokenRepo.RefreshToken)
 
-	userRepo := controllers.NewUserController()
-
-	r.POST("/users", userRepo.CreateUser)
-	r.GET("/users", userRepo.GetUsers)
-	r.GET("/users/:id", userRepo.GetUser)
-	r.PUT("/users/:id", userRepo.UpdateUser)
-	r.DELETE("/users/:id", userRepo.DeleteUser)
+	r.GET("/activate", userRepo.Activate)
+	r.POST("/activate", idempotency, userRepo.Activate)
+	r.POST("/activate/resend", idempotency, userRepo.ResendActivation)
 
-	r.POST("/register", userRepo.Register)
-	r.POST("/login", userRepo.Login)
-	r.POST("/logout", userRepo.Logout)
+	r.POST("/password/forgot", idempotency, userRepo.ForgotPassword)
+	r.POST("/password/reset", idempotency, userRepo.ResetPassword)
 
-	ticketRepo := controllers.NewTicketController()
-	r.POST("/tickets", ticketRepo.CreateTicket)
 	r.GET("/tickets", ticketRepo.GetTickets)
 	r.GET("/filtertickets", ticketRepo.FilterTickets)
 	r.GET("/tickets/:id", ticketRepo.GetTicket)
-	r.PUT("/tickets/:id", ticketRepo.UpdateTicket)
-	r.DELETE("/tickets/:id", ticketRepo.DeleteTicket)
-
-	bticketRepo := controllers.NewBTicketController()
-	r.POST("/btickets", bticketRepo.CreateBTicket)
-	r.GET("/btickets", bticketRepo.GetBTickets)
-	r.GET("/btickets/:id", bticketRepo.GetBTicket)
-	r.PUT("/btickets/:id", bticketRepo.UpdateBTicket)
-	r.DELETE("/btickets/:id", bticketRepo.DeleteBTicket)
-
-	planeRepo := controllers.NewPlaneController()
-	r.POST("/planes", planeRepo.CreatePlane)
+	r.GET("/tickets/:id/seats", ticketRepo.GetTicketSeats)
+	r.GET("/routes", ticketRepo.SearchRoutes)
+
 	r.GET("/planes", planeRepo.GetPlanes)
 	r.GET("/planes/:id", planeRepo.GetPlane)
-	r.PUT("/planes/:id", planeRepo.UpdatePlane)
-	r.DELETE("/planes/:id", planeRepo.DeletePlane)
+	r.GET("/planes/:id/seats", planeRepo.GetSeats)
 
-	//r.POST("/tickets/:ticket_id/book", userRepo.BookTicket)
+	r.GET("/airports", airportRepo.GetAirports)
+	r.GET("/airports/search", airportRepo.SearchAirports)
+	r.GET("/airports/:id", airportRepo.GetAirport)
 
-	// Protected routes that require authentication
+	// Manage booking: find a booking by locator and passenger last name
+	r.GET("/bookings/:locator", bookingRepo.FindBooking)
+
+	// Protected routes that require authentication, open to every role.
+	// Handlers limit customers to their own user record and bookings.
 	protectedRoutes := r.Group("/")
-	protectedRoutes.Use(authMiddleware)
+	protectedRoutes.Use(authMiddleware, idempotency)
+	{
+		// Two-phase reservation: hold seats, then confirm the hold into a
+		// booking waiting for payment or release it
+		protectedRoutes.POST("/tickets/:ticket_id/hold", userRepo.HoldTicket)
+		protectedRoutes.GET("/holds/:id", userRepo.GetHold)
+		protectedRoutes.POST("/holds/:id/confirm", userRepo.ConfirmHold)
+		protectedRoutes.POST("/holds/:id/release", userRepo.ReleaseHold)
+		// One step booking of a single ticket, paid like any other booking
+		protectedRoutes.POST("/tickets/:ticket_id/book", bookingRepo.BookTicket)
+
+		protectedRoutes.POST("/logout", userRepo.Logout)
+		protectedRoutes.POST("/logout/all", userRepo.LogoutAll)
+
+		protectedRoutes.GET("/users/:id", userRepo.GetUser)
+		protectedRoutes.PUT("/users/:id", userRepo.UpdateUser)
+		protectedRoutes.PATCH("/users/:id", userRepo.UpdateUser)
+
+		protectedRoutes.POST("/bookings", bookingRepo.CreateBooking)
+		protectedRoutes.GET("/bookings", bookingRepo.GetBookings)
+		protectedRoutes.POST("/bookings/:locator/cancel", bookingRepo.CancelBooking)
+		protectedRoutes.POST("/bookings/:locator/pay", bookingRepo.PayBooking)
+		protectedRoutes.GET("/bookings/:locator/payments", bookingRepo.GetPayments)
+		protectedRoutes.POST("/bookings/:locator/payments/:id/challenge", bookingRepo.CompletePaymentChallenge)
+
+		protectedRoutes.GET("/btickets", bticketRepo.GetBTickets)
+		protectedRoutes.GET("/btickets/:id", bticketRepo.GetBTicket)
+		protectedRoutes.POST("/btickets/:id/cancel", bticketRepo.CancelBTicket)
+	}
+
+	// Changing the password answers with a new access token, it is left out of
+	// idempotency so the token is never stored
+	r.POST("/users/:id/password", authMiddleware, userRepo.ChangePassword)
+
+	// Routes for agents and admins managing the flight inventory
+	agentRoutes := r.Group("/")
+	agentRoutes.Use(authMiddleware, controllers.RequireRoles(models.RoleAgent, models.RoleAdmin), idempotency)
+	{
+		agentRoutes.POST("/tickets", ticketRepo.CreateTicket)
+		agentRoutes.PUT("/tickets/:id", ticketRepo.UpdateTicket)
+		agentRoutes.DELETE("/tickets/:id", ticketRepo.DeleteTicket)
+
+		agentRoutes.POST("/btickets", bticketRepo.CreateBTicket)
+		agentRoutes.PUT("/btickets/:id", bticketRepo.UpdateBTicket)
+		agentRoutes.DELETE("/btickets/:id", bticketRepo.DeleteBTicket)
+
+		agentRoutes.POST("/planes", planeRepo.CreatePlane)
+		agentRoutes.PUT("/planes/:id", planeRepo.UpdatePlane)
+		agentRoutes.DELETE("/planes/:id", planeRepo.DeletePlane)
+		agentRoutes.PUT("/planes/:id/seats", planeRepo.UpdateSeats)
+
+		agentRoutes.POST("/airports", airportRepo.CreateAirport)
+		agentRoutes.PUT("/airports/:id", airportRepo.UpdateAirport)
+		agentRoutes.DELETE("/airports/:id", airportRepo.DeleteAirport)
+	}
+
+	// Routes for admins only
+	adminRoutes := r.Group("/")
+	adminRoutes.Use(authMiddleware, controllers.RequireRoles(models.RoleAdmin), idempotency)
 	{
-		protectedRoutes.POST("/tickets/:ticket_id/book", userRepo.BookTicket)
+		adminRoutes.POST("/users", userRepo.CreateUser)
+		adminRoutes.GET("/users", userRepo.GetUsers)
+		adminRoutes.DELETE("/users/:id", userRepo.DeleteUser)
+		adminRoutes.DELETE("/users/:id/sessions", tokenRepo.RevokeUserSessions)
+
+		adminRoutes.GET("/refunds", bticketRepo.GetRefunds)
+		adminRoutes.GET("/refunds/summary", bticketRepo.GetRefundSummary)
 	}
 
 	return r
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"project/auth"
+	"project/config"
+	"project/controllers"
+	"project/models"
+	"project/payments"
+	"project/store/sqlite"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const testPassword = "Secret123!"
+
+// testJWTSecret signs the access tokens of the test API
+const testJWTSecret = "a test secret of at least 32 bytes"
+
+// rawJSON is a request body sent as it is, e.g. to send malformed JSON
+type rawJSON string
+
+// testAPI is the router over a fresh in-memory database
+type testAPI struct {
+	t      *testing.T
+	db     *gorm.DB
+	router *gin.Engine
+}
+
+func newTestAPI(t *testing.T) *testAPI {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	db, err := sqlite.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newTestAPIOver(t, db, config.Default())
+}
+
+// newTestAPIOver is the router over db, configured by cfg with the test
+// secret and an in-memory mailer
+func newTestAPIOver(t *testing.T, db *gorm.DB, cfg config.Config) *testAPI {
+	return newTestAPIWithGateway(t, db, cfg, payments.NewMockGateway())
+}
+
+// newTestAPIWithGateway is newTestAPIOver taking payments through gateway
+func newTestAPIWithGateway(t *testing.T, db *gorm.DB, cfg config.Config, gateway payments.Gateway) *testAPI {
+	db.Logger = logger.Default.LogMode(logger.Silent)
+	cfg.JWT.Secret = testJWTSecret
+	cfg.Mail.Mailer = "memory"
+	keys, err := auth.NewHMACKeys([]byte(testJWTSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	services := controllers.Services{Keys: keys, Revocations: auth.NewRevocations(), Payments: gateway}
+	return &testAPI{t: t, db: db, router: setupRouter(db, cfg, services)}
+}
+
+// request sends a JSON request, with the access token when it is not empty
+func (api *testAPI) request(method string, path string, accessToken string, body interface{}) *httptest.ResponseRecorder {
+	api.t.Helper()
+	return api.requestWithHeaders(method, path, accessToken, nil, body)
+}
+
+// requestWithHeaders sends a JSON request with more headers
+func (api *testAPI) requestWithHeaders(method string, path string, accessToken string, headers map[string]string, body interface{}) *httptest.ResponseRecorder {
+	api.t.Helper()
+	var buf bytes.Buffer
+	if raw, ok := body.(rawJSON); ok {
+		buf.WriteString(string(raw))
+	} else if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			api.t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	recorder := httptest.NewRecorder()
+	api.router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+// expect checks the status of a response and decodes its body into out,
+// unless out is nil
+func (api *testAPI) expect(recorder *httptest.ResponseRecorder, status int, out interface{}) {
+	api.t.Helper()
+	if recorder.Code != status {
+		api.t.Fatalf("status %d, want %d: %s", recorder.Code, status, recorder.Body)
+	}
+	if out != nil {
+		if err := json.Unmarshal(recorder.Body.Bytes(), out); err != nil {
+			api.t.Fatalf("%s: %s", err, recorder.Body)
+		}
+	}
+}
+
+// tokens is the body of a login or refresh response
+type tokens struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// createUser stores an active user with testPassword
+func (api *testAPI) createUser(username string, role string) models.User {
+	api.t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	if err != nil {
+		api.t.Fatal(err)
+	}
+	user := models.User{Username: username, Email: username + "@example.com", Password: string(hash), Role: role, Active: true}
+	if err := api.db.Create(&user).Error; err != nil {
+		api.t.Fatal(err)
+	}
+	return user
+}
+
+// login logs in as user and returns its tokens
+func (api *testAPI) login(user models.User) tokens {
+	api.t.Helper()
+	var body tokens
+	api.expect(api.request(http.MethodPost, "/login", "", map[string]string{"email": user.Email, "password": testPassword}), http.StatusOK, &body)
+	return body
+}
+
+// createTicket stores a ticket between the first two seeded airports,
+// departing in a week
+func (api *testAPI) createTicket(seats int, price int64) models.Ticket {
+	api.t.Helper()
+	var airports []models.Airport
+	if err := api.db.Order("id").Limit(2).Find(&airports).Error; err != nil || len(airports) < 2 {
+		api.t.Fatalf("no seeded airports: %v", err)
+	}
+	plane := models.Plane{FirmName: "Test Air", SeatNumber: "180"}
+	if err := api.db.Create(&plane).Error; err != nil {
+		api.t.Fatal(err)
+	}
+	departureAt := time.Now().Add(7 * 24 * time.Hour).UTC().Truncate(time.Minute)
+	ticket := models.Ticket{
+		PlaneID:        plane.ID,
+		FromAirportID:  airports[0].ID,
+		ToAirportID:    airports[1].ID,
+		DepartureAt:    departureAt,
+		ArrivalAt:      departureAt.Add(90 * time.Minute),
+		SeatCapacity:   seats,
+		AvailableSeats: seats,
+		PriceAmount:    price,
+		Currency:       "TRY",
+	}
+	if err := api.db.Create(&ticket).Error; err != nil {
+		api.t.Fatal(err)
+	}
+	return ticket
+}
+
+// adult is a passenger of a booking request
+var adult = map[string]string{
+	"first_name":      "Ayse",
+	"last_name":       "Yilmaz",
+	"date_of_birth":   "1990-04-12",
+	"document_number": "U12345678",
+	"type":            "ADT",
+}
+
+// card is a card the mock payment gateway approves
+var card = map[string]interface{}{
+	"card": map[string]interface{}{"number": "4242424242424242", "holder": "AYSE YILMAZ", "exp_month": 12, "exp_year": 2040, "cvc": "123"},
+}
+
+// booking is the part of a booking response the tests look at
+type booking struct {
+	Locator  string `json:"locator"`
+	Status   string `json:"status"`
+	BTickets []struct {
+		ID int `json:"id"`
+	} `json:"btickets"`
+}
+
+// book creates a booking for one adult on ticket
+func (api *testAPI) book(accessToken string, ticket models.Ticket) booking {
+	api.t.Helper()
+	var body booking
+	api.expect(api.request(http.MethodPost, "/bookings", accessToken, map[string]interface{}{
+		"ticket_ids": []int{ticket.ID},
+		"passengers": []interface{}{adult},
+	}), http.StatusOK, &body)
+	return body
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"project/config"
+	"project/database"
+	"project/migrations"
+	"strconv"
+	"time"
+)
+
+const migrateUsage = "usage: migrate up|down [steps]|status [flags]"
+
+// migrate runs the migrate subcommand:
+//
+//	migrate up          apply every pending migration
+//	migrate down [n]    roll back the last n migrations, 1 by default
+//	migrate status      list migrations and when they were applied
+//
+// The flags after it are the ones of the server, such as -config.
+func migrate(args []string) {
+	if len(args) == 0 {
+		log.Fatalln(migrateUsage)
+	}
+	command, args := args[0], args[1:]
+	steps := 1
+	if command == "down" && len(args) > 0 {
+		if n, err := strconv.Atoi(args[0]); err == nil {
+			if n < 1 {
+				log.Fatalln("the number of migrations to roll back must be positive")
+			}
+			steps, args = n, args[1:]
+		}
+	}
+
+	cfg, err := config.Load(args)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	db, err := database.Open(cfg.Database)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	switch command {
+	case "up":
+		loc, _ := time.LoadLocation(cfg.LegacyTicketTimezone) // checked by config.Load
+		done, err := migrations.Up(db, migrations.Settings{LegacyTicketTimezone: loc, DefaultCurrency: cfg.DefaultCurrency})
+		for _, migration := range done {
+			fmt.Printf("applied %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			log.Fatalln(err)
+		}
+		if len(done) == 0 {
+			fmt.Println("schema is up to date")
+		}
+	case "down":
+		done, err := migrations.Down(db, steps)
+		for _, migration := range done {
+			fmt.Printf("rolled back %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			log.Fatalln(err)
+		}
+		if len(done) == 0 {
+			fmt.Println("no migration to roll back")
+		}
+	case "status":
+		statuses, err := migrations.GetStatus(db)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		for _, status := range statuses {
+			state := "pending"
+			if status.AppliedAt != nil {
+				state = "applied " + status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%s\t%s\n", status.Version, status.Name, state)
+		}
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		os.Exit(2)
+	}
+}
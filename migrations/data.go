@@ -0,0 +1,47 @@
+package migrations
+
+import (
+	"log"
+	"project/models"
+
+	"gorm.io/gorm"
+)
+
+// dataMigrations are the migrations written in Go, numbered among the SQL ones
+var dataMigrations = []Migration{
+	{Version: 4, Name: "seed_airports", Data: seedAirports},
+	{Version: 5, Name: "convert_legacy_tickets", Data: convertLegacyTickets},
+}
+
+// seedAirports adds the bundled airports that are missing
+func seedAirports(tx *gorm.DB, settings Settings) error {
+	return models.SeedAirports(tx)
+}
+
+// convertLegacyTickets fills the typed columns of tickets stored with string
+// dates, seats and prices and links them to airports. Rows that can't be
+// converted are logged and keep their legacy columns to be fixed by hand.
+func convertLegacyTickets(tx *gorm.DB, settings Settings) error {
+	migrated, issues, err := models.MigrateLegacyTickets(tx, settings.LegacyTicketTimezone, settings.DefaultCurrency)
+	if err != nil {
+		return err
+	}
+	if migrated > 0 {
+		log.Printf("Converted %d legacy tickets\n", migrated)
+	}
+	for _, issue := range issues {
+		log.Printf("Legacy ticket not converted, %s\n", issue)
+	}
+
+	migrated, issues, err = models.MigrateLegacyTicketAirports(tx)
+	if err != nil {
+		return err
+	}
+	if migrated > 0 {
+		log.Printf("Linked %d legacy tickets to airports\n", migrated)
+	}
+	for _, issue := range issues {
+		log.Printf("Legacy ticket not linked to airports, %s\n", issue)
+	}
+	return nil
+}
@@ -0,0 +1,280 @@
+// Package migrations keeps the database schema up to date with ordered SQL
+// migrations embedded in the binary.
+//
+// Each migration is a pair of files in sql/<dialect>/, NNNN_name.up.sql and
+// NNNN_name.down.sql, where NNNN is its version and dialect is mysql or
+// sqlite. Both dialects have the same versions. Statements end with a
+// semicolon at the end of a line. A down file without statements marks a
+// migration that can't be rolled back. Migrations that change rows rather
+// than the schema are written in Go, see data.go. Applied versions are
+// recorded in the schema_migrations table.
+package migrations
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+//go:embed sql/mysql/*.sql sql/sqlite/*.sql
+var files embed.FS
+
+var ErrSchemaBehind = errors.New("database schema is behind")
+var ErrIrreversible = errors.New("migration can't be rolled back")
+
+// Migration is one version of the schema.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+	// Data changes rows after the statements of Up have run. Rolling back
+	// a data migration only forgets that it was applied.
+	Data func(tx *gorm.DB, settings Settings) error
+}
+
+// Settings are what data migrations need to know about the deployment.
+type Settings struct {
+	// LegacyTicketTimezone is the timezone of the dates and hours of
+	// tickets stored as text
+	LegacyTicketTimezone *time.Location
+	// DefaultCurrency is given to legacy prices without a currency
+	DefaultCurrency string
+}
+
+// Status tells whether a migration is applied, AppliedAt is nil when it is not.
+type Status struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+type schemaMigration struct {
+	Version   int
+	Name      string
+	AppliedAt time.Time
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+var fileNamePattern = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// All returns the migrations of dialect ordered by version
+func All(dialect string) ([]Migration, error) {
+	dir := path.Join("sql", dialect)
+	entries, err := fs.ReadDir(files, dir)
+	if err != nil {
+		return nil, fmt.Errorf("no migrations for the %s dialect", dialect)
+	}
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		match := fileNamePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("migration file %s is not named NNNN_name.up.sql or NNNN_name.down.sql", entry.Name())
+		}
+		version, _ := strconv.Atoi(match[1])
+		content, err := fs.ReadFile(files, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names, %s and %s", version, migration.Name, match[2])
+		}
+		if match[3] == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	var migrations []Migration
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d needs both an up and a down file", migration.Version)
+		}
+		migrations = append(migrations, *migration)
+	}
+	for _, migration := range dataMigrations {
+		if _, ok := byVersion[migration.Version]; ok {
+			return nil, fmt.Errorf("migration %d is both a data migration and an SQL file", migration.Version)
+		}
+		migrations = append(migrations, migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// applied returns when each applied version was applied, creating the
+// schema_migrations table when needed
+func applied(db *gorm.DB) (map[int]time.Time, error) {
+	err := db.Exec("CREATE TABLE IF NOT EXISTS `schema_migrations` (`version` bigint NOT NULL, `name` varchar(255) NOT NULL, `applied_at` datetime NOT NULL, PRIMARY KEY (`version`))").Error
+	if err != nil {
+		return nil, err
+	}
+	var rows []schemaMigration
+	if err := db.Order("version").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	versions := map[int]time.Time{}
+	for _, row := range rows {
+		versions[row.Version] = row.AppliedAt
+	}
+	return versions, nil
+}
+
+// GetStatus lists every migration with the time it was applied
+func GetStatus(db *gorm.DB) ([]Status, error) {
+	migrations, err := All(db.Dialector.Name())
+	if err != nil {
+		return nil, err
+	}
+	versions, err := applied(db)
+	if err != nil {
+		return nil, err
+	}
+	var statuses []Status
+	for _, migration := range migrations {
+		status := Status{Migration: migration}
+		if appliedAt, ok := versions[migration.Version]; ok {
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// Pending returns the migrations that are not applied yet, in order
+func Pending(db *gorm.DB) ([]Migration, error) {
+	statuses, err := GetStatus(db)
+	if err != nil {
+		return nil, err
+	}
+	var pending []Migration
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			pending = append(pending, status.Migration)
+		}
+	}
+	return pending, nil
+}
+
+// CheckCurrent returns ErrSchemaBehind when migrations are pending
+func CheckCurrent(db *gorm.DB) error {
+	pending, err := Pending(db)
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		var versions []string
+		for _, migration := range pending {
+			versions = append(versions, fmt.Sprintf("%04d_%s", migration.Version, migration.Name))
+		}
+		return fmt.Errorf("%w, pending migrations: %s", ErrSchemaBehind, strings.Join(versions, ", "))
+	}
+	return nil
+}
+
+// Up applies the pending migrations in order and returns them
+func Up(db *gorm.DB, settings Settings) ([]Migration, error) {
+	pending, err := Pending(db)
+	if err != nil {
+		return nil, err
+	}
+	var done []Migration
+	for _, migration := range pending {
+		migration := migration
+		err := run(db, migration.Up, func(tx *gorm.DB) error {
+			if migration.Data != nil {
+				if err := migration.Data(tx, settings); err != nil {
+					return err
+				}
+			}
+			return tx.Create(&schemaMigration{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("migration %04d_%s: %w", migration.Version, migration.Name, err)
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+// Down rolls back the last steps applied migrations and returns them
+func Down(db *gorm.DB, steps int) ([]Migration, error) {
+	statuses, err := GetStatus(db)
+	if err != nil {
+		return nil, err
+	}
+	var done []Migration
+	for i := len(statuses) - 1; i >= 0 && len(done) < steps; i-- {
+		migration := statuses[i].Migration
+		if statuses[i].AppliedAt == nil {
+			continue
+		}
+		if migration.Data == nil && len(statements(migration.Down)) == 0 {
+			return done, fmt.Errorf("rolling back migration %04d_%s: %w", migration.Version, migration.Name, ErrIrreversible)
+		}
+		err := run(db, migration.Down, func(tx *gorm.DB) error {
+			return tx.Where("version = ?", migration.Version).Delete(&schemaMigration{}).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("rolling back migration %04d_%s: %w", migration.Version, migration.Name, err)
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+// run executes the statements of a migration, then record, which also runs
+// the data changes of the migration. MySQL commits schema changes right away,
+// so only the bookkeeping and data changes are really transactional there.
+func run(db *gorm.DB, sql string, record func(tx *gorm.DB) error) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, statement := range statements(sql) {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		return record(tx)
+	})
+}
+
+// statements splits a migration into its statements, skipping comment lines
+func statements(sql string) []string {
+	var statements []string
+	var current strings.Builder
+	for _, line := range strings.Split(sql, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		current.WriteString(line)
+		current.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			statements = append(statements, strings.TrimSuffix(strings.TrimSpace(current.String()), ";"))
+			current.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(current.String()); rest != "" {
+		statements = append(statements, rest)
+	}
+	return statements
+}
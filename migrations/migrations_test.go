@@ -0,0 +1,167 @@
+package migrations
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var testSettings = Settings{LegacyTicketTimezone: time.UTC, DefaultCurrency: "TRY"}
+
+func openSQLite(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:?_pragma=foreign_keys(1)"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	return db
+}
+
+func TestDialectsHaveTheSameMigrations(t *testing.T) {
+	mysql, err := All("mysql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlite, err := All("sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mysql) != len(sqlite) {
+		t.Fatalf("mysql has %d migrations, sqlite %d", len(mysql), len(sqlite))
+	}
+	for i := range mysql {
+		if mysql[i].Version != sqlite[i].Version || mysql[i].Name != sqlite[i].Name {
+			t.Errorf("migration %d is %04d_%s on mysql and %04d_%s on sqlite", i, mysql[i].Version, mysql[i].Name, sqlite[i].Version, sqlite[i].Name)
+		}
+		if i > 0 && mysql[i].Version == mysql[i-1].Version {
+			t.Errorf("version %d is used twice", mysql[i].Version)
+		}
+	}
+}
+
+func TestUpDownUp(t *testing.T) {
+	db := openSQLite(t)
+
+	done, err := Up(db, testSettings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	all, _ := All("sqlite")
+	if len(done) != len(all) {
+		t.Fatalf("applied %d migrations, want %d", len(done), len(all))
+	}
+	if err := CheckCurrent(db); err != nil {
+		t.Fatal(err)
+	}
+
+	rolledBack, err := Down(db, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rolledBack) != 2 || rolledBack[0].Version != all[len(all)-1].Version {
+		t.Fatalf("rolled back %+v", rolledBack)
+	}
+	if err := CheckCurrent(db); !errors.Is(err, ErrSchemaBehind) {
+		t.Fatalf("CheckCurrent = %v, want ErrSchemaBehind", err)
+	}
+
+	done, err = Up(db, testSettings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != 2 {
+		t.Fatalf("applied %d migrations again, want 2", len(done))
+	}
+}
+
+func TestIrreversibleMigration(t *testing.T) {
+	db := openSQLite(t)
+	if _, err := Up(db, testSettings); err != nil {
+		t.Fatal(err)
+	}
+	// 0007_bookings adds foreign key columns, which SQLite can't drop
+	_, err := Down(db, 100)
+	if !errors.Is(err, ErrIrreversible) {
+		t.Fatalf("Down = %v, want ErrIrreversible", err)
+	}
+}
+
+// A database created before migrations existed only has the baseline tables
+// and tickets with text columns, which the migrations convert.
+func TestConvertLegacyDatabase(t *testing.T) {
+	db := openSQLite(t)
+	all, err := All("sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, statement := range statements(all[0].Up) {
+		if err := db.Exec(statement).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	legacy := []string{
+		"INSERT INTO planes (id, firm_name, seat_number) VALUES (1, 'Anadolu', '120')",
+		"INSERT INTO users (id, username, email, password, active) VALUES (1, 'ayse', 'ayse@example.com', 'x', 1)",
+		"INSERT INTO tickets (id, plane_id, `from`, `to`, departure_date, return_date, d_hour, r_hour, nof_seats, price) VALUES (1, 1, 'IST', 'Ankara', '2024-05-01', '2024-05-01', '09:00', '10:15', '99', '1250,50')",
+		"INSERT INTO tickets (id, plane_id, `from`, `to`, departure_date, return_date, d_hour, r_hour, nof_seats, price) VALUES (2, 1, 'IST', 'ESB', 'soon', '2024-05-01', '09:00', '10:15', '10', '100')",
+		"INSERT INTO b_tickets (ticket_id, user_id) VALUES (1, 1)",
+	}
+	for _, statement := range legacy {
+		if err := db.Exec(statement).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := Up(db, testSettings); err != nil {
+		t.Fatal(err)
+	}
+
+	var converted struct {
+		DepartureAt    time.Time
+		SeatCapacity   int
+		AvailableSeats int
+		PriceAmount    int64
+		Currency       string
+		FromAirportID  int
+		ToAirportID    int
+	}
+	err = db.Table("tickets").Where("id = 1").Take(&converted).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !converted.DepartureAt.Equal(time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)) {
+		t.Errorf("departure_at = %s", converted.DepartureAt)
+	}
+	if converted.SeatCapacity != 100 || converted.AvailableSeats != 99 {
+		t.Errorf("seat_capacity = %d, available_seats = %d, want 100 and 99", converted.SeatCapacity, converted.AvailableSeats)
+	}
+	if converted.PriceAmount != 125050 || converted.Currency != "TRY" {
+		t.Errorf("price = %d %s, want 125050 TRY", converted.PriceAmount, converted.Currency)
+	}
+	if converted.FromAirportID == 0 || converted.ToAirportID == 0 {
+		t.Errorf("airports not linked: from %d, to %d", converted.FromAirportID, converted.ToAirportID)
+	}
+
+	// the row with an unreadable date keeps its legacy columns
+	var skipped struct {
+		DepartureDate string
+		Currency      *string
+	}
+	err = db.Table("tickets").Where("id = 2").Take(&skipped).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if skipped.DepartureDate != "soon" || skipped.Currency != nil {
+		t.Errorf("unconvertible ticket was changed: %+v", skipped)
+	}
+}
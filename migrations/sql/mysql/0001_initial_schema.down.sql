@@ -0,0 +1,2 @@
+-- The baseline can't be rolled back: its tables may hold the data of a
+-- database adopted from before migrations, which dropping them would lose.
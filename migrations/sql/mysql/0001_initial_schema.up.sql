@@ -0,0 +1,78 @@
+-- The schema from before migrations, when the controllers ran AutoMigrate
+-- on the user, token, plane, ticket and booked ticket models. Tables are
+-- only created when missing, so databases from that time are adopted as
+-- they are and the following migrations bring them up to date.
+
+CREATE TABLE IF NOT EXISTS `users` (
+  `id` bigint AUTO_INCREMENT,
+  `created_at` datetime(3) NULL,
+  `updated_at` datetime(3) NULL,
+  `deleted_at` datetime(3) NULL,
+  `username` varchar(191) UNIQUE,
+  `email` varchar(191) UNIQUE,
+  `password` longtext,
+  `activation_code` longtext,
+  `active` boolean,
+  `last_login` datetime(3) NULL,
+  `ip_address` longtext,
+  PRIMARY KEY (`id`),
+  INDEX `idx_users_deleted_at` (`deleted_at`)
+);
+
+CREATE TABLE IF NOT EXISTS `tokens` (
+  `id` bigint unsigned AUTO_INCREMENT,
+  `created_at` datetime(3) NULL,
+  `updated_at` datetime(3) NULL,
+  `deleted_at` datetime(3) NULL,
+  `user_id` bigint,
+  `token` longtext,
+  `starting_date` datetime(3) NULL,
+  `ending_date` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  INDEX `idx_tokens_deleted_at` (`deleted_at`)
+);
+
+CREATE TABLE IF NOT EXISTS `planes` (
+  `id` bigint AUTO_INCREMENT,
+  `created_at` datetime(3) NULL,
+  `updated_at` datetime(3) NULL,
+  `deleted_at` datetime(3) NULL,
+  `firm_name` longtext,
+  `seat_number` longtext,
+  PRIMARY KEY (`id`),
+  INDEX `idx_planes_deleted_at` (`deleted_at`)
+);
+
+-- Dates, hours, seats and price were strings and the airports free text,
+-- 0005_convert_legacy_tickets converts them
+CREATE TABLE IF NOT EXISTS `tickets` (
+  `id` bigint AUTO_INCREMENT,
+  `created_at` datetime(3) NULL,
+  `updated_at` datetime(3) NULL,
+  `deleted_at` datetime(3) NULL,
+  `plane_id` bigint,
+  `from` longtext,
+  `to` longtext,
+  `departure_date` longtext,
+  `return_date` longtext,
+  `d_hour` longtext,
+  `r_hour` longtext,
+  `nof_seats` longtext,
+  `price` longtext,
+  PRIMARY KEY (`id`),
+  INDEX `idx_tickets_deleted_at` (`deleted_at`),
+  CONSTRAINT `fk_tickets_plane` FOREIGN KEY (`plane_id`) REFERENCES `planes`(`id`)
+);
+
+CREATE TABLE IF NOT EXISTS `b_tickets` (
+  `id` bigint AUTO_INCREMENT,
+  `created_at` datetime(3) NULL,
+  `updated_at` datetime(3) NULL,
+  `deleted_at` datetime(3) NULL,
+  `ticket_id` bigint,
+  `user_id` bigint,
+  PRIMARY KEY (`id`),
+  INDEX `idx_b_tickets_deleted_at` (`deleted_at`),
+  CONSTRAINT `fk_b_tickets_ticket` FOREIGN KEY (`ticket_id`) REFERENCES `tickets`(`id`),
+  CONSTRAINT `fk_b_tickets_user` FOREIGN KEY (`user_id`) REFERENCES `users`(`id`)
+);
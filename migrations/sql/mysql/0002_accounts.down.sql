@@ -0,0 +1,16 @@
+DROP TABLE `password_resets`;
+
+DROP INDEX `idx_tokens_session_id` ON `tokens`;
+DROP INDEX `idx_tokens_token_hash` ON `tokens`;
+DROP INDEX `idx_tokens_user_id` ON `tokens`;
+ALTER TABLE `tokens` DROP COLUMN `revoked_at`;
+ALTER TABLE `tokens` DROP COLUMN `rotated_at`;
+ALTER TABLE `tokens` DROP COLUMN `session_id`;
+ALTER TABLE `tokens` DROP COLUMN `token_hash`;
+-- the sessions started since can't be turned back into plain text tokens
+DELETE FROM `tokens`;
+ALTER TABLE `tokens` ADD COLUMN `token` longtext;
+
+ALTER TABLE `users` DROP COLUMN `activation_expires_at`;
+ALTER TABLE `users` DROP COLUMN `locale`;
+ALTER TABLE `users` DROP COLUMN `role`;
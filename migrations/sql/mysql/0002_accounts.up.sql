@@ -0,0 +1,29 @@
+-- User roles and email locales, expiring activation codes, refresh tokens
+-- stored as hashes and rotated within sessions, and password resets.
+
+ALTER TABLE `users` ADD COLUMN `role` varchar(191) DEFAULT 'customer';
+ALTER TABLE `users` ADD COLUMN `locale` varchar(5);
+ALTER TABLE `users` ADD COLUMN `activation_expires_at` datetime(3) NULL;
+
+-- Tokens used to be stored in plain text, those sessions are ended
+DELETE FROM `tokens`;
+ALTER TABLE `tokens` DROP COLUMN `token`;
+ALTER TABLE `tokens` ADD COLUMN `token_hash` varchar(64);
+ALTER TABLE `tokens` ADD COLUMN `session_id` varchar(36);
+ALTER TABLE `tokens` ADD COLUMN `rotated_at` datetime(3) NULL;
+ALTER TABLE `tokens` ADD COLUMN `revoked_at` datetime(3) NULL;
+CREATE INDEX `idx_tokens_user_id` ON `tokens` (`user_id`);
+CREATE INDEX `idx_tokens_token_hash` ON `tokens` (`token_hash`);
+CREATE INDEX `idx_tokens_session_id` ON `tokens` (`session_id`);
+
+CREATE TABLE `password_resets` (
+  `id` bigint AUTO_INCREMENT,
+  `user_id` bigint,
+  `token_hash` varchar(64),
+  `expires_at` datetime(3) NULL,
+  `used_at` datetime(3) NULL,
+  `created_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `idx_password_resets_token_hash` (`token_hash`),
+  INDEX `idx_password_resets_user_id` (`user_id`)
+);
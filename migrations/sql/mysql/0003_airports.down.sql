@@ -0,0 +1,12 @@
+ALTER TABLE `tickets` DROP FOREIGN KEY `fk_tickets_to_airport`;
+ALTER TABLE `tickets` DROP FOREIGN KEY `fk_tickets_from_airport`;
+ALTER TABLE `tickets` DROP COLUMN `currency`;
+ALTER TABLE `tickets` DROP COLUMN `price_amount`;
+ALTER TABLE `tickets` DROP COLUMN `available_seats`;
+ALTER TABLE `tickets` DROP COLUMN `seat_capacity`;
+ALTER TABLE `tickets` DROP COLUMN `arrival_at`;
+ALTER TABLE `tickets` DROP COLUMN `departure_at`;
+ALTER TABLE `tickets` DROP COLUMN `to_airport_id`;
+ALTER TABLE `tickets` DROP COLUMN `from_airport_id`;
+
+DROP TABLE `airports`;
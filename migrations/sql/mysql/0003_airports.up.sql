@@ -0,0 +1,34 @@
+-- The airports registry, and typed dates, seats and prices on tickets that
+-- link them to airports. The legacy columns stay until every row is
+-- converted.
+
+CREATE TABLE `airports` (
+  `id` bigint AUTO_INCREMENT,
+  `created_at` datetime(3) NULL,
+  `updated_at` datetime(3) NULL,
+  `deleted_at` datetime(3) NULL,
+  `iata` varchar(3),
+  `icao` varchar(4),
+  `name` longtext,
+  `city` varchar(100),
+  `country` longtext,
+  `latitude` double,
+  `longitude` double,
+  `timezone` longtext,
+  PRIMARY KEY (`id`),
+  INDEX `idx_airports_deleted_at` (`deleted_at`),
+  UNIQUE INDEX `idx_airports_iata` (`iata`),
+  INDEX `idx_airports_icao` (`icao`),
+  INDEX `idx_airports_city` (`city`)
+);
+
+ALTER TABLE `tickets` ADD COLUMN `from_airport_id` bigint;
+ALTER TABLE `tickets` ADD COLUMN `to_airport_id` bigint;
+ALTER TABLE `tickets` ADD COLUMN `departure_at` datetime(3) NULL;
+ALTER TABLE `tickets` ADD COLUMN `arrival_at` datetime(3) NULL;
+ALTER TABLE `tickets` ADD COLUMN `seat_capacity` bigint;
+ALTER TABLE `tickets` ADD COLUMN `available_seats` bigint;
+ALTER TABLE `tickets` ADD COLUMN `price_amount` bigint;
+ALTER TABLE `tickets` ADD COLUMN `currency` varchar(3);
+ALTER TABLE `tickets` ADD CONSTRAINT `fk_tickets_from_airport` FOREIGN KEY (`from_airport_id`) REFERENCES `airports`(`id`);
+ALTER TABLE `tickets` ADD CONSTRAINT `fk_tickets_to_airport` FOREIGN KEY (`to_airport_id`) REFERENCES `airports`(`id`);
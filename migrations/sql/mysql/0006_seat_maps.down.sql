@@ -0,0 +1,3 @@
+DROP TABLE `seat_holds`;
+DROP TABLE `seat_assignments`;
+DROP TABLE `seats`;
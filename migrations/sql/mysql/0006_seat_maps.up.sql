@@ -0,0 +1,47 @@
+-- Seat maps of planes, seats assigned to booked tickets and seat holds.
+
+CREATE TABLE `seats` (
+  `id` bigint AUTO_INCREMENT,
+  `created_at` datetime(3) NULL,
+  `updated_at` datetime(3) NULL,
+  `deleted_at` datetime(3) NULL,
+  `plane_id` bigint,
+  `row` bigint,
+  `letter` varchar(1),
+  `cabin` longtext,
+  `exit_row` boolean,
+  `blocked` boolean,
+  PRIMARY KEY (`id`),
+  INDEX `idx_seats_deleted_at` (`deleted_at`),
+  UNIQUE INDEX `idx_plane_seat` (`plane_id`,`row`,`letter`)
+);
+
+CREATE TABLE `seat_assignments` (
+  `id` bigint AUTO_INCREMENT,
+  `ticket_id` bigint,
+  `seat_id` bigint,
+  `b_ticket_id` bigint,
+  `created_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `idx_ticket_seat` (`ticket_id`,`seat_id`),
+  UNIQUE INDEX `idx_seat_assignments_b_ticket_id` (`b_ticket_id`),
+  CONSTRAINT `fk_seat_assignments_seat` FOREIGN KEY (`seat_id`) REFERENCES `seats`(`id`),
+  CONSTRAINT `fk_b_tickets_seat_assignment` FOREIGN KEY (`b_ticket_id`) REFERENCES `b_tickets`(`id`)
+);
+
+CREATE TABLE `seat_holds` (
+  `id` bigint AUTO_INCREMENT,
+  `created_at` datetime(3) NULL,
+  `updated_at` datetime(3) NULL,
+  `deleted_at` datetime(3) NULL,
+  `ticket_id` bigint,
+  `user_id` bigint,
+  `quantity` bigint,
+  `status` varchar(20),
+  `expires_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  INDEX `idx_seat_holds_deleted_at` (`deleted_at`),
+  INDEX `idx_seat_holds_status` (`status`),
+  INDEX `idx_seat_holds_expires_at` (`expires_at`),
+  CONSTRAINT `fk_seat_holds_ticket` FOREIGN KEY (`ticket_id`) REFERENCES `tickets`(`id`)
+);
@@ -0,0 +1,15 @@
+DROP TABLE `refunds`;
+
+ALTER TABLE `b_tickets` DROP FOREIGN KEY `fk_bookings_b_tickets`;
+DROP INDEX `idx_b_tickets_cancelled_at` ON `b_tickets`;
+ALTER TABLE `b_tickets` DROP COLUMN `cancel_reason`;
+ALTER TABLE `b_tickets` DROP COLUMN `cancelled_by`;
+ALTER TABLE `b_tickets` DROP COLUMN `cancelled_at`;
+ALTER TABLE `b_tickets` DROP COLUMN `currency`;
+ALTER TABLE `b_tickets` DROP COLUMN `fare_amount`;
+ALTER TABLE `b_tickets` DROP COLUMN `passenger_id`;
+ALTER TABLE `b_tickets` DROP COLUMN `booking_id`;
+
+DROP TABLE `booking_segments`;
+DROP TABLE `passengers`;
+DROP TABLE `bookings`;
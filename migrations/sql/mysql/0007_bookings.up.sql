@@ -0,0 +1,80 @@
+-- Bookings with passengers and segments, the fare and cancellation of
+-- booked tickets, and the refunds of cancellations.
+
+CREATE TABLE `bookings` (
+  `id` bigint AUTO_INCREMENT,
+  `created_at` datetime(3) NULL,
+  `updated_at` datetime(3) NULL,
+  `deleted_at` datetime(3) NULL,
+  `locator` varchar(6),
+  `user_id` bigint,
+  `status` varchar(20),
+  `payment_due_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `idx_bookings_locator` (`locator`),
+  INDEX `idx_bookings_payment_due_at` (`payment_due_at`),
+  INDEX `idx_bookings_deleted_at` (`deleted_at`)
+);
+
+CREATE TABLE `passengers` (
+  `id` bigint AUTO_INCREMENT,
+  `created_at` datetime(3) NULL,
+  `updated_at` datetime(3) NULL,
+  `deleted_at` datetime(3) NULL,
+  `booking_id` bigint,
+  `first_name` longtext,
+  `last_name` varchar(100),
+  `date_of_birth` datetime(3) NULL,
+  `document_number` longtext,
+  `type` varchar(3),
+  PRIMARY KEY (`id`),
+  INDEX `idx_passengers_deleted_at` (`deleted_at`),
+  INDEX `idx_passengers_last_name` (`last_name`),
+  CONSTRAINT `fk_bookings_passengers` FOREIGN KEY (`booking_id`) REFERENCES `bookings`(`id`)
+);
+
+CREATE TABLE `booking_segments` (
+  `id` bigint AUTO_INCREMENT,
+  `created_at` datetime(3) NULL,
+  `updated_at` datetime(3) NULL,
+  `deleted_at` datetime(3) NULL,
+  `booking_id` bigint,
+  `ticket_id` bigint,
+  PRIMARY KEY (`id`),
+  INDEX `idx_booking_segments_deleted_at` (`deleted_at`),
+  CONSTRAINT `fk_bookings_segments` FOREIGN KEY (`booking_id`) REFERENCES `bookings`(`id`),
+  CONSTRAINT `fk_booking_segments_ticket` FOREIGN KEY (`ticket_id`) REFERENCES `tickets`(`id`)
+);
+
+ALTER TABLE `b_tickets` ADD COLUMN `booking_id` bigint;
+ALTER TABLE `b_tickets` ADD COLUMN `passenger_id` bigint;
+ALTER TABLE `b_tickets` ADD COLUMN `fare_amount` bigint;
+ALTER TABLE `b_tickets` ADD COLUMN `currency` varchar(3);
+ALTER TABLE `b_tickets` ADD COLUMN `cancelled_at` datetime(3) NULL;
+ALTER TABLE `b_tickets` ADD COLUMN `cancelled_by` bigint;
+ALTER TABLE `b_tickets` ADD COLUMN `cancel_reason` longtext;
+CREATE INDEX `idx_b_tickets_cancelled_at` ON `b_tickets` (`cancelled_at`);
+ALTER TABLE `b_tickets` ADD CONSTRAINT `fk_bookings_b_tickets` FOREIGN KEY (`booking_id`) REFERENCES `bookings`(`id`);
+
+CREATE TABLE `refunds` (
+  `id` bigint AUTO_INCREMENT,
+  `created_at` datetime(3) NULL,
+  `updated_at` datetime(3) NULL,
+  `deleted_at` datetime(3) NULL,
+  `b_ticket_id` bigint,
+  `booking_id` bigint,
+  `user_id` bigint,
+  `ticket_id` bigint,
+  `fare_amount` bigint,
+  `amount` bigint,
+  `currency` varchar(3),
+  `percent` bigint,
+  `rule` longtext,
+  `cancelled_by` bigint,
+  `reason` longtext,
+  PRIMARY KEY (`id`),
+  INDEX `idx_refunds_deleted_at` (`deleted_at`),
+  UNIQUE INDEX `idx_refunds_b_ticket_id` (`b_ticket_id`),
+  INDEX `idx_refunds_booking_id` (`booking_id`),
+  INDEX `idx_refunds_user_id` (`user_id`)
+);
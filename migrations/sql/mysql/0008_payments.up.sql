@@ -0,0 +1,36 @@
+-- Payments of bookings and what happened to them at the provider.
+
+CREATE TABLE `payments` (
+  `id` bigint AUTO_INCREMENT,
+  `created_at` datetime(3) NULL,
+  `updated_at` datetime(3) NULL,
+  `deleted_at` datetime(3) NULL,
+  `booking_id` bigint,
+  `provider` longtext,
+  `reference` varchar(191),
+  `amount` bigint,
+  `currency` varchar(3),
+  `refunded_amount` bigint,
+  `status` varchar(20),
+  `card_last4` varchar(4),
+  `challenge_url` longtext,
+  `failure_reason` longtext,
+  PRIMARY KEY (`id`),
+  INDEX `idx_payments_deleted_at` (`deleted_at`),
+  INDEX `idx_payments_booking_id` (`booking_id`),
+  INDEX `idx_payments_reference` (`reference`),
+  CONSTRAINT `fk_bookings_payments` FOREIGN KEY (`booking_id`) REFERENCES `bookings`(`id`)
+);
+
+CREATE TABLE `payment_events` (
+  `id` bigint AUTO_INCREMENT,
+  `payment_id` bigint,
+  `operation` longtext,
+  `amount` bigint,
+  `status` longtext,
+  `error` longtext,
+  `created_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  INDEX `idx_payment_events_payment_id` (`payment_id`),
+  CONSTRAINT `fk_payments_events` FOREIGN KEY (`payment_id`) REFERENCES `payments`(`id`)
+);
@@ -0,0 +1,36 @@
+-- Responses kept for retried requests, and emails waiting to be sent.
+
+CREATE TABLE `idempotency_keys` (
+  `id` bigint AUTO_INCREMENT,
+  `key` varchar(255),
+  `user_id` bigint,
+  `method` varchar(10),
+  `path` longtext,
+  `fingerprint` varchar(64),
+  `status` varchar(20),
+  `response_status` bigint,
+  `content_type` longtext,
+  `response_body` longblob,
+  `created_at` datetime(3) NULL,
+  `expires_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `idx_idempotency_user_key` (`key`,`user_id`),
+  INDEX `idx_idempotency_keys_expires_at` (`expires_at`)
+);
+
+CREATE TABLE `outbox_emails` (
+  `id` bigint AUTO_INCREMENT,
+  `from` longtext,
+  `to` longtext,
+  `subject` longtext,
+  `body` text,
+  `html` mediumtext,
+  `status` varchar(20),
+  `attempts` bigint,
+  `next_attempt_at` datetime(3) NULL,
+  `last_error` longtext,
+  `sent_at` datetime(3) NULL,
+  `created_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  INDEX `idx_outbox_due` (`status`,`next_attempt_at`)
+);
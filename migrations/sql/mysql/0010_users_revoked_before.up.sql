@@ -0,0 +1,4 @@
+-- Access tokens issued before revoked_before are rejected, so logging out
+-- everywhere and password changes end them without waiting for expiry.
+
+ALTER TABLE `users` ADD COLUMN `revoked_before` datetime(3) NULL;
@@ -0,0 +1 @@
+ALTER TABLE `users` ADD COLUMN `revoked_before` datetime(3) NULL;
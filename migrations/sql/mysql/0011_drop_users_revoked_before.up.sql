@@ -0,0 +1,4 @@
+-- Access tokens are rejected by the session they were issued for, see
+-- auth.Revocations.
+
+ALTER TABLE `users` DROP COLUMN `revoked_before`;
@@ -0,0 +1,7 @@
+-- Refunds record whether the payment provider refunded them, failed ones are
+-- retried. Earlier refunds were sent when they were made.
+
+ALTER TABLE `refunds` ADD COLUMN `status` varchar(20) NOT NULL DEFAULT 'succeeded';
+ALTER TABLE `refunds` ADD COLUMN `attempts` bigint NOT NULL DEFAULT 0;
+ALTER TABLE `refunds` ADD COLUMN `failure` longtext;
+CREATE INDEX `idx_refunds_status` ON `refunds` (`status`);
@@ -0,0 +1,74 @@
+-- The schema from before migrations, see the MySQL version. An integer
+-- primary key is the rowid in SQLite, which numbers new rows.
+
+CREATE TABLE IF NOT EXISTS `users` (
+  `id` integer,
+  `created_at` datetime,
+  `updated_at` datetime,
+  `deleted_at` datetime,
+  `username` text UNIQUE,
+  `email` text UNIQUE,
+  `password` text,
+  `activation_code` text,
+  `active` numeric,
+  `last_login` datetime,
+  `ip_address` text,
+  PRIMARY KEY (`id`)
+);
+CREATE INDEX IF NOT EXISTS `idx_users_deleted_at` ON `users` (`deleted_at`);
+
+CREATE TABLE IF NOT EXISTS `tokens` (
+  `id` integer,
+  `created_at` datetime,
+  `updated_at` datetime,
+  `deleted_at` datetime,
+  `user_id` integer,
+  `token` text,
+  `starting_date` datetime,
+  `ending_date` datetime,
+  PRIMARY KEY (`id`)
+);
+CREATE INDEX IF NOT EXISTS `idx_tokens_deleted_at` ON `tokens` (`deleted_at`);
+
+CREATE TABLE IF NOT EXISTS `planes` (
+  `id` integer,
+  `created_at` datetime,
+  `updated_at` datetime,
+  `deleted_at` datetime,
+  `firm_name` text,
+  `seat_number` text,
+  PRIMARY KEY (`id`)
+);
+CREATE INDEX IF NOT EXISTS `idx_planes_deleted_at` ON `planes` (`deleted_at`);
+
+CREATE TABLE IF NOT EXISTS `tickets` (
+  `id` integer,
+  `created_at` datetime,
+  `updated_at` datetime,
+  `deleted_at` datetime,
+  `plane_id` integer,
+  `from` text,
+  `to` text,
+  `departure_date` text,
+  `return_date` text,
+  `d_hour` text,
+  `r_hour` text,
+  `nof_seats` text,
+  `price` text,
+  PRIMARY KEY (`id`),
+  CONSTRAINT `fk_tickets_plane` FOREIGN KEY (`plane_id`) REFERENCES `planes`(`id`)
+);
+CREATE INDEX IF NOT EXISTS `idx_tickets_deleted_at` ON `tickets` (`deleted_at`);
+
+CREATE TABLE IF NOT EXISTS `b_tickets` (
+  `id` integer,
+  `created_at` datetime,
+  `updated_at` datetime,
+  `deleted_at` datetime,
+  `ticket_id` integer,
+  `user_id` integer,
+  PRIMARY KEY (`id`),
+  CONSTRAINT `fk_b_tickets_ticket` FOREIGN KEY (`ticket_id`) REFERENCES `tickets`(`id`),
+  CONSTRAINT `fk_b_tickets_user` FOREIGN KEY (`user_id`) REFERENCES `users`(`id`)
+);
+CREATE INDEX IF NOT EXISTS `idx_b_tickets_deleted_at` ON `b_tickets` (`deleted_at`);
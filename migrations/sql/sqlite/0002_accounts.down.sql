@@ -0,0 +1,15 @@
+DROP TABLE `password_resets`;
+
+DROP INDEX `idx_tokens_session_id`;
+DROP INDEX `idx_tokens_token_hash`;
+DROP INDEX `idx_tokens_user_id`;
+ALTER TABLE `tokens` DROP COLUMN `revoked_at`;
+ALTER TABLE `tokens` DROP COLUMN `rotated_at`;
+ALTER TABLE `tokens` DROP COLUMN `session_id`;
+ALTER TABLE `tokens` DROP COLUMN `token_hash`;
+DELETE FROM `tokens`;
+ALTER TABLE `tokens` ADD COLUMN `token` text;
+
+ALTER TABLE `users` DROP COLUMN `activation_expires_at`;
+ALTER TABLE `users` DROP COLUMN `locale`;
+ALTER TABLE `users` DROP COLUMN `role`;
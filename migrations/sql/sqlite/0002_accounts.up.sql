@@ -0,0 +1,25 @@
+ALTER TABLE `users` ADD COLUMN `role` text DEFAULT 'customer';
+ALTER TABLE `users` ADD COLUMN `locale` text;
+ALTER TABLE `users` ADD COLUMN `activation_expires_at` datetime;
+
+DELETE FROM `tokens`;
+ALTER TABLE `tokens` DROP COLUMN `token`;
+ALTER TABLE `tokens` ADD COLUMN `token_hash` text;
+ALTER TABLE `tokens` ADD COLUMN `session_id` text;
+ALTER TABLE `tokens` ADD COLUMN `rotated_at` datetime;
+ALTER TABLE `tokens` ADD COLUMN `revoked_at` datetime;
+CREATE INDEX `idx_tokens_user_id` ON `tokens` (`user_id`);
+CREATE INDEX `idx_tokens_token_hash` ON `tokens` (`token_hash`);
+CREATE INDEX `idx_tokens_session_id` ON `tokens` (`session_id`);
+
+CREATE TABLE `password_resets` (
+  `id` integer,
+  `user_id` integer,
+  `token_hash` text,
+  `expires_at` datetime,
+  `used_at` datetime,
+  `created_at` datetime,
+  PRIMARY KEY (`id`)
+);
+CREATE UNIQUE INDEX `idx_password_resets_token_hash` ON `password_resets` (`token_hash`);
+CREATE INDEX `idx_password_resets_user_id` ON `password_resets` (`user_id`);
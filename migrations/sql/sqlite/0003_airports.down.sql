@@ -0,0 +1,2 @@
+-- SQLite can't drop columns that are foreign keys, so this migration can
+-- only be rolled back on MySQL.
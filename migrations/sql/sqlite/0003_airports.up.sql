@@ -0,0 +1,30 @@
+CREATE TABLE `airports` (
+  `id` integer,
+  `created_at` datetime,
+  `updated_at` datetime,
+  `deleted_at` datetime,
+  `iata` text,
+  `icao` text,
+  `name` text,
+  `city` text,
+  `country` text,
+  `latitude` real,
+  `longitude` real,
+  `timezone` text,
+  PRIMARY KEY (`id`)
+);
+CREATE INDEX `idx_airports_deleted_at` ON `airports` (`deleted_at`);
+CREATE UNIQUE INDEX `idx_airports_iata` ON `airports` (`iata`);
+CREATE INDEX `idx_airports_icao` ON `airports` (`icao`);
+CREATE INDEX `idx_airports_city` ON `airports` (`city`);
+
+-- SQLite can't add a constraint to a table, the foreign keys are declared
+-- with the columns instead
+ALTER TABLE `tickets` ADD COLUMN `from_airport_id` integer CONSTRAINT `fk_tickets_from_airport` REFERENCES `airports`(`id`);
+ALTER TABLE `tickets` ADD COLUMN `to_airport_id` integer CONSTRAINT `fk_tickets_to_airport` REFERENCES `airports`(`id`);
+ALTER TABLE `tickets` ADD COLUMN `departure_at` datetime;
+ALTER TABLE `tickets` ADD COLUMN `arrival_at` datetime;
+ALTER TABLE `tickets` ADD COLUMN `seat_capacity` integer;
+ALTER TABLE `tickets` ADD COLUMN `available_seats` integer;
+ALTER TABLE `tickets` ADD COLUMN `price_amount` integer;
+ALTER TABLE `tickets` ADD COLUMN `currency` text;
@@ -0,0 +1,45 @@
+CREATE TABLE `seats` (
+  `id` integer,
+  `created_at` datetime,
+  `updated_at` datetime,
+  `deleted_at` datetime,
+  `plane_id` integer,
+  `row` integer,
+  `letter` text,
+  `cabin` text,
+  `exit_row` numeric,
+  `blocked` numeric,
+  PRIMARY KEY (`id`)
+);
+CREATE INDEX `idx_seats_deleted_at` ON `seats` (`deleted_at`);
+CREATE UNIQUE INDEX `idx_plane_seat` ON `seats` (`plane_id`,`row`,`letter`);
+
+CREATE TABLE `seat_assignments` (
+  `id` integer,
+  `ticket_id` integer,
+  `seat_id` integer,
+  `b_ticket_id` integer,
+  `created_at` datetime,
+  PRIMARY KEY (`id`),
+  CONSTRAINT `fk_seat_assignments_seat` FOREIGN KEY (`seat_id`) REFERENCES `seats`(`id`),
+  CONSTRAINT `fk_b_tickets_seat_assignment` FOREIGN KEY (`b_ticket_id`) REFERENCES `b_tickets`(`id`)
+);
+CREATE UNIQUE INDEX `idx_ticket_seat` ON `seat_assignments` (`ticket_id`,`seat_id`);
+CREATE UNIQUE INDEX `idx_seat_assignments_b_ticket_id` ON `seat_assignments` (`b_ticket_id`);
+
+CREATE TABLE `seat_holds` (
+  `id` integer,
+  `created_at` datetime,
+  `updated_at` datetime,
+  `deleted_at` datetime,
+  `ticket_id` integer,
+  `user_id` integer,
+  `quantity` integer,
+  `status` text,
+  `expires_at` datetime,
+  PRIMARY KEY (`id`),
+  CONSTRAINT `fk_seat_holds_ticket` FOREIGN KEY (`ticket_id`) REFERENCES `tickets`(`id`)
+);
+CREATE INDEX `idx_seat_holds_deleted_at` ON `seat_holds` (`deleted_at`);
+CREATE INDEX `idx_seat_holds_status` ON `seat_holds` (`status`);
+CREATE INDEX `idx_seat_holds_expires_at` ON `seat_holds` (`expires_at`);
@@ -0,0 +1,76 @@
+CREATE TABLE `bookings` (
+  `id` integer,
+  `created_at` datetime,
+  `updated_at` datetime,
+  `deleted_at` datetime,
+  `locator` text,
+  `user_id` integer,
+  `status` text,
+  `payment_due_at` datetime,
+  PRIMARY KEY (`id`)
+);
+CREATE UNIQUE INDEX `idx_bookings_locator` ON `bookings` (`locator`);
+CREATE INDEX `idx_bookings_payment_due_at` ON `bookings` (`payment_due_at`);
+CREATE INDEX `idx_bookings_deleted_at` ON `bookings` (`deleted_at`);
+
+CREATE TABLE `passengers` (
+  `id` integer,
+  `created_at` datetime,
+  `updated_at` datetime,
+  `deleted_at` datetime,
+  `booking_id` integer,
+  `first_name` text,
+  `last_name` text,
+  `date_of_birth` datetime,
+  `document_number` text,
+  `type` text,
+  PRIMARY KEY (`id`),
+  CONSTRAINT `fk_bookings_passengers` FOREIGN KEY (`booking_id`) REFERENCES `bookings`(`id`)
+);
+CREATE INDEX `idx_passengers_deleted_at` ON `passengers` (`deleted_at`);
+CREATE INDEX `idx_passengers_last_name` ON `passengers` (`last_name`);
+
+CREATE TABLE `booking_segments` (
+  `id` integer,
+  `created_at` datetime,
+  `updated_at` datetime,
+  `deleted_at` datetime,
+  `booking_id` integer,
+  `ticket_id` integer,
+  PRIMARY KEY (`id`),
+  CONSTRAINT `fk_bookings_segments` FOREIGN KEY (`booking_id`) REFERENCES `bookings`(`id`),
+  CONSTRAINT `fk_booking_segments_ticket` FOREIGN KEY (`ticket_id`) REFERENCES `tickets`(`id`)
+);
+CREATE INDEX `idx_booking_segments_deleted_at` ON `booking_segments` (`deleted_at`);
+
+ALTER TABLE `b_tickets` ADD COLUMN `booking_id` integer CONSTRAINT `fk_bookings_b_tickets` REFERENCES `bookings`(`id`);
+ALTER TABLE `b_tickets` ADD COLUMN `passenger_id` integer;
+ALTER TABLE `b_tickets` ADD COLUMN `fare_amount` integer;
+ALTER TABLE `b_tickets` ADD COLUMN `currency` text;
+ALTER TABLE `b_tickets` ADD COLUMN `cancelled_at` datetime;
+ALTER TABLE `b_tickets` ADD COLUMN `cancelled_by` integer;
+ALTER TABLE `b_tickets` ADD COLUMN `cancel_reason` text;
+CREATE INDEX `idx_b_tickets_cancelled_at` ON `b_tickets` (`cancelled_at`);
+
+CREATE TABLE `refunds` (
+  `id` integer,
+  `created_at` datetime,
+  `updated_at` datetime,
+  `deleted_at` datetime,
+  `b_ticket_id` integer,
+  `booking_id` integer,
+  `user_id` integer,
+  `ticket_id` integer,
+  `fare_amount` integer,
+  `amount` integer,
+  `currency` text,
+  `percent` integer,
+  `rule` text,
+  `cancelled_by` integer,
+  `reason` text,
+  PRIMARY KEY (`id`)
+);
+CREATE INDEX `idx_refunds_deleted_at` ON `refunds` (`deleted_at`);
+CREATE UNIQUE INDEX `idx_refunds_b_ticket_id` ON `refunds` (`b_ticket_id`);
+CREATE INDEX `idx_refunds_booking_id` ON `refunds` (`booking_id`);
+CREATE INDEX `idx_refunds_user_id` ON `refunds` (`user_id`);
@@ -0,0 +1,34 @@
+CREATE TABLE `payments` (
+  `id` integer,
+  `created_at` datetime,
+  `updated_at` datetime,
+  `deleted_at` datetime,
+  `booking_id` integer,
+  `provider` text,
+  `reference` text,
+  `amount` integer,
+  `currency` text,
+  `refunded_amount` integer,
+  `status` text,
+  `card_last4` text,
+  `challenge_url` text,
+  `failure_reason` text,
+  PRIMARY KEY (`id`),
+  CONSTRAINT `fk_bookings_payments` FOREIGN KEY (`booking_id`) REFERENCES `bookings`(`id`)
+);
+CREATE INDEX `idx_payments_deleted_at` ON `payments` (`deleted_at`);
+CREATE INDEX `idx_payments_booking_id` ON `payments` (`booking_id`);
+CREATE INDEX `idx_payments_reference` ON `payments` (`reference`);
+
+CREATE TABLE `payment_events` (
+  `id` integer,
+  `payment_id` integer,
+  `operation` text,
+  `amount` integer,
+  `status` text,
+  `error` text,
+  `created_at` datetime,
+  PRIMARY KEY (`id`),
+  CONSTRAINT `fk_payments_events` FOREIGN KEY (`payment_id`) REFERENCES `payments`(`id`)
+);
+CREATE INDEX `idx_payment_events_payment_id` ON `payment_events` (`payment_id`);
@@ -0,0 +1,2 @@
+DROP TABLE `outbox_emails`;
+DROP TABLE `idempotency_keys`;
@@ -0,0 +1,34 @@
+CREATE TABLE `idempotency_keys` (
+  `id` integer,
+  `key` text,
+  `user_id` integer,
+  `method` text,
+  `path` text,
+  `fingerprint` text,
+  `status` text,
+  `response_status` integer,
+  `content_type` text,
+  `response_body` blob,
+  `created_at` datetime,
+  `expires_at` datetime,
+  PRIMARY KEY (`id`)
+);
+CREATE UNIQUE INDEX `idx_idempotency_user_key` ON `idempotency_keys` (`key`,`user_id`);
+CREATE INDEX `idx_idempotency_keys_expires_at` ON `idempotency_keys` (`expires_at`);
+
+CREATE TABLE `outbox_emails` (
+  `id` integer,
+  `from` text,
+  `to` text,
+  `subject` text,
+  `body` text,
+  `html` text,
+  `status` text,
+  `attempts` integer,
+  `next_attempt_at` datetime,
+  `last_error` text,
+  `sent_at` datetime,
+  `created_at` datetime,
+  PRIMARY KEY (`id`)
+);
+CREATE INDEX `idx_outbox_due` ON `outbox_emails` (`status`,`next_attempt_at`);
@@ -0,0 +1,4 @@
+DROP INDEX `idx_refunds_status`;
+ALTER TABLE `refunds` DROP COLUMN `failure`;
+ALTER TABLE `refunds` DROP COLUMN `attempts`;
+ALTER TABLE `refunds` DROP COLUMN `status`;
@@ -0,0 +1,4 @@
+ALTER TABLE `refunds` ADD COLUMN `status` text NOT NULL DEFAULT 'succeeded';
+ALTER TABLE `refunds` ADD COLUMN `attempts` integer NOT NULL DEFAULT 0;
+ALTER TABLE `refunds` ADD COLUMN `failure` text;
+CREATE INDEX `idx_refunds_status` ON `refunds` (`status`);
@@ -0,0 +1,225 @@
+package models
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type Airport struct {
+	gorm.Model
+	ID        int
+	IATA      string `gorm:"size:3;uniqueIndex"`
+	ICAO      string `gorm:"size:4;index"`
+	Name      string
+	City      string `gorm:"size:100;index"`
+	Country   string
+	Latitude  float64
+	Longitude float64
+	Timezone  string // IANA timezone such as Europe/Istanbul
+}
+
+//go:embed seed/airports.csv
+var airportsCSV string
+
+var iataPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+var icaoPattern = regexp.MustCompile(`^[A-Z]{4}$`)
+
+// check that an Airport can be stored
+func (airport *Airport) Validate() error {
+	airport.IATA = strings.ToUpper(strings.TrimSpace(airport.IATA))
+	airport.ICAO = strings.ToUpper(strings.TrimSpace(airport.ICAO))
+	if !iataPattern.MatchString(airport.IATA) {
+		return errors.New("IATA code must be 3 letters")
+	}
+	if airport.ICAO != "" && !icaoPattern.MatchString(airport.ICAO) {
+		return errors.New("ICAO code must be 4 letters")
+	}
+	if airport.Name == "" || airport.City == "" || airport.Country == "" {
+		return errors.New("name, city and country are required")
+	}
+	if airport.Latitude < -90 || airport.Latitude > 90 || airport.Longitude < -180 || airport.Longitude > 180 {
+		return errors.New("coordinates are out of range")
+	}
+	if _, err := time.LoadLocation(airport.Timezone); err != nil || airport.Timezone == "" {
+		return errors.New("timezone must be an IANA timezone name")
+	}
+	return nil
+}
+
+// Location returns the timezone of the Airport.
+func (airport *Airport) Location() *time.Location {
+	loc, err := time.LoadLocation(airport.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// create an Airport
+func CreateAirport(db *gorm.DB, Airport *Airport) (err error) {
+	err = db.Create(Airport).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// get Airports
+func GetAirports(db *gorm.DB, Airport *[]Airport) (err error) {
+	err = db.Find(Airport).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// get Airport by id
+func GetAirport(db *gorm.DB, Airport *Airport, id string) (err error) {
+	err = db.Where("id = ?", id).First(Airport).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// search Airports for autocomplete, by code prefix, city or name
+//
+// Exact code matches come first, then code prefixes, then the rest.
+func SearchAirports(db *gorm.DB, Airport *[]Airport, text string, limit int) (err error) {
+	text = strings.TrimSpace(text)
+	code := strings.ToUpper(text)
+	prefix := code + "%"
+	contains := "%" + strings.ToLower(text) + "%"
+	err = db.Where("iata LIKE ? OR icao LIKE ? OR LOWER(city) LIKE ? OR LOWER(name) LIKE ?", prefix, prefix, contains, contains).
+		Order(clause.Expr{SQL: "CASE WHEN iata = ? OR icao = ? THEN 0 WHEN iata LIKE ? OR icao LIKE ? THEN 1 ELSE 2 END, iata", Vars: []interface{}{code, code, prefix, prefix}}).
+		Limit(limit).
+		Find(Airport).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// AirportIDs returns a subquery selecting the ids of the airports that match
+// the given IATA code, ICAO code or city, ignoring case. "IST", "ltfm" and
+// "istanbul" all match Istanbul Airport.
+func AirportIDs(db *gorm.DB, text string) *gorm.DB {
+	text = strings.TrimSpace(text)
+	return db.Model(&Airport{}).Select("id").Where("iata = ? OR icao = ? OR LOWER(city) = ?", strings.ToUpper(text), strings.ToUpper(text), strings.ToLower(text))
+}
+
+// get the timezone of the airports matching a code or city, like AirportIDs
+//
+// The airports of a city share a timezone, the first one is used. Without
+// a match it is UTC.
+func GetAirportLocation(db *gorm.DB, text string) (loc *time.Location, err error) {
+	var airports []Airport
+	err = db.Where("id IN (?)", AirportIDs(db, text)).Order("id").Limit(1).Find(&airports).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(airports) == 0 {
+		return time.UTC, nil
+	}
+	return airports[0].Location(), nil
+}
+
+// find the Airport matching a code, city or name
+//
+// Codes win over cities so that a city with several airports is only
+// resolved when it is the only match.
+func ResolveAirport(db *gorm.DB, Airport *Airport, text string) (err error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return gorm.ErrRecordNotFound
+	}
+	err = db.Where("iata = ? OR icao = ?", strings.ToUpper(text), strings.ToUpper(text)).First(Airport).Error
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	var count int64
+	err = db.Model(Airport).Where("LOWER(city) = ? OR LOWER(name) = ?", strings.ToLower(text), strings.ToLower(text)).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count != 1 {
+		return gorm.ErrRecordNotFound
+	}
+	return db.Where("LOWER(city) = ? OR LOWER(name) = ?", strings.ToLower(text), strings.ToLower(text)).First(Airport).Error
+}
+
+// update an Airport, Airport is left holding the updated row
+func UpdateAirport(db *gorm.DB, Airport *Airport, id string) (err error) {
+	values := map[string]interface{}{"iata": Airport.IATA, "icao": Airport.ICAO, "name": Airport.Name, "city": Airport.City, "country": Airport.Country, "latitude": Airport.Latitude, "longitude": Airport.Longitude, "timezone": Airport.Timezone}
+	err = db.Where("id = ?", id).First(Airport).Error
+	if err != nil {
+		return err
+	}
+	err = db.Model(Airport).Updates(values).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// delete Airport
+func DeleteAirport(db *gorm.DB, Airport *Airport, id string) (err error) {
+	err = db.Where("id = ?", id).Delete(Airport).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// seed the airports registry from the bundled CSV
+//
+// Airports that already exist, by IATA code, are left as they are so local
+// edits survive.
+func SeedAirports(db *gorm.DB) (err error) {
+	return SeedAirportsFromCSV(db, strings.NewReader(airportsCSV))
+}
+
+// seed the airports registry from a CSV with the columns
+// iata,icao,name,city,country,latitude,longitude,timezone
+func SeedAirportsFromCSV(db *gorm.DB, r io.Reader) (err error) {
+	reader := csv.NewReader(r)
+	records, err := reader.ReadAll()
+	if err != nil {
+		return err
+	}
+	if len(records) < 2 {
+		return nil
+	}
+
+	var airports []Airport
+	for i, record := range records[1:] {
+		if len(record) != 8 {
+			return fmt.Errorf("airports csv line %d: expected 8 columns, got %d", i+2, len(record))
+		}
+		latitude, err := strconv.ParseFloat(record[5], 64)
+		if err != nil {
+			return fmt.Errorf("airports csv line %d: invalid latitude %q", i+2, record[5])
+		}
+		longitude, err := strconv.ParseFloat(record[6], 64)
+		if err != nil {
+			return fmt.Errorf("airports csv line %d: invalid longitude %q", i+2, record[6])
+		}
+		airport := Airport{IATA: record[0], ICAO: record[1], Name: record[2], City: record[3], Country: record[4], Latitude: latitude, Longitude: longitude, Timezone: record[7]}
+		if err := airport.Validate(); err != nil {
+			return fmt.Errorf("airports csv line %d: %w", i+2, err)
+		}
+		airports = append(airports, airport)
+	}
+
+	return db.Clauses(clause.OnConflict{DoNothing: true}).Create(&airports).Error
+}
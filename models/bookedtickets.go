@@ -1,9 +1,18 @@
 package models
 
 import (
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+var ErrTicketSoldOut = errors.New("ticket is not available")
+var ErrAlreadyCancelled = errors.New("booking is already cancelled")
+
 type BTicket struct {
 	gorm.Model
 	ID       int `gorm:"primaryKey"`
@@ -11,20 +20,50 @@ type BTicket struct {
 	Ticket   Ticket `gorm:"foreignKey:TicketID"`
 	UserID   int
 	User     User `gorm:"foreignKey:UserID"`
+	// BookingID and PassengerID are set for tickets booked as part of a Booking
+	BookingID   *int
+	PassengerID *int
+	// SeatAssignment is only set for planes with a seat map
+	SeatAssignment *SeatAssignment `gorm:"foreignKey:BTicketID"`
+	// FareAmount and Currency are the ticket price when it was booked
+	FareAmount int64
+	Currency   string `gorm:"size:3"`
+	// CancelledAt is set once the ticket is cancelled, the row is kept for reports
+	CancelledAt  *time.Time `gorm:"index"`
+	CancelledBy  *int
+	CancelReason string
 }
 
-// create a Plane
+// create a BTicket of a single ticket for a user
+//
+// The ticket is locked and loses a seat, like in the booking flow, and the
+// booked ticket gets a seat on planes with a seat map. BTicket is reloaded
+// as stored.
 func CreateBTicket(db *gorm.DB, BTicket *BTicket) (err error) {
-	err = db.Create(BTicket).Error
+	err = db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Select("id").Where("id = ?", BTicket.UserID).First(&User{}).Error
+		if err != nil {
+			return err
+		}
+		ticket, err := lockTicket(tx, strconv.Itoa(BTicket.TicketID))
+		if err != nil {
+			return err
+		}
+		err = moveBTicket(tx, BTicket, ticket)
+		if err != nil {
+			return err
+		}
+		return updateAvailability(tx, ticket, -1)
+	})
 	if err != nil {
 		return err
 	}
-	return nil
+	return GetBTicket(db, BTicket, strconv.Itoa(BTicket.ID))
 }
 
 // get Planes
 func GetBTickets(db *gorm.DB, BTicket *[]BTicket) (err error) {
-	err = db.Find(BTicket).Error
+	err = db.Preload("SeatAssignment.Seat").Find(BTicket).Error
 	if err != nil {
 		return err
 	}
@@ -33,20 +72,112 @@ func GetBTickets(db *gorm.DB, BTicket *[]BTicket) (err error) {
 
 // get Plane by id
 func GetBTicket(db *gorm.DB, BTicket *BTicket, id string) (err error) {
-	err = db.Where("id = ?", id).First(BTicket).Error
+	err = db.Preload("SeatAssignment.Seat").Where("id = ?", id).First(BTicket).Error
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-// update a Plane
+// update the user and ticket of a BTicket
+//
+// Moving it to another ticket gives the seat back to the old ticket and
+// takes one of the new ticket, both locked in id order like the booking
+// flow. Tickets of a Booking are changed through the booking instead.
+// BTicket is reloaded as stored.
 func UpdateBTicket(db *gorm.DB, BTicket *BTicket, id string) (err error) {
-	err = db.Model(BTicket).Where("id = ?", id).Updates(map[string]interface{}{"user_id": BTicket.UserID, "ticket_id": BTicket.TicketID}).Error
+	for attempt := 0; ; attempt++ {
+		err = db.Transaction(func(tx *gorm.DB) error {
+			return updateBTicket(tx, BTicket, id)
+		})
+		// another update moved the booked ticket before it was locked
+		if !errors.Is(err, errBTicketMoved) || attempt == 2 {
+			break
+		}
+	}
 	if err != nil {
 		return err
 	}
-	return nil
+	return GetBTicket(db, BTicket, id)
+}
+
+var ErrBTicketOfBooking = errors.New("ticket belongs to a booking, change the booking instead")
+var errBTicketMoved = errors.New("booked ticket was moved to another ticket")
+
+func updateBTicket(tx *gorm.DB, update *BTicket, id string) error {
+	var bTicket BTicket
+	err := tx.Where("id = ?", id).First(&bTicket).Error
+	if err != nil {
+		return err
+	}
+	err = tx.Select("id").Where("id = ?", update.UserID).First(&User{}).Error
+	if err != nil {
+		return err
+	}
+	ticketIDs := []int{bTicket.TicketID, update.TicketID}
+	sort.Ints(ticketIDs)
+	tickets := map[int]Ticket{}
+	for _, ticketID := range ticketIDs {
+		if _, ok := tickets[ticketID]; ok {
+			continue
+		}
+		tickets[ticketID], err = lockTicket(tx, strconv.Itoa(ticketID))
+		if err != nil {
+			return err
+		}
+	}
+	oldTicketID := bTicket.TicketID
+	err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).First(&bTicket).Error
+	if err != nil {
+		return err
+	}
+	if bTicket.TicketID != oldTicketID {
+		return errBTicketMoved
+	}
+	if bTicket.CancelledAt != nil {
+		return ErrAlreadyCancelled
+	}
+	if bTicket.BookingID != nil {
+		return ErrBTicketOfBooking
+	}
+
+	if update.TicketID == bTicket.TicketID {
+		return tx.Model(&bTicket).Update("user_id", update.UserID).Error
+	}
+	err = tx.Where("b_ticket_id = ?", bTicket.ID).Delete(&SeatAssignment{}).Error
+	if err != nil {
+		return err
+	}
+	bTicket.UserID = update.UserID
+	err = moveBTicket(tx, &bTicket, tickets[update.TicketID])
+	if err != nil {
+		return err
+	}
+	err = updateAvailability(tx, tickets[oldTicketID], 1)
+	if err != nil {
+		return err
+	}
+	return updateAvailability(tx, tickets[update.TicketID], -1)
+}
+
+// moveBTicket stores a booked ticket, new or not, on a locked ticket with
+// its fare and a seat on planes with a seat map. The availability of the
+// ticket is left to the caller.
+func moveBTicket(tx *gorm.DB, bTicket *BTicket, ticket Ticket) error {
+	if ticket.AvailableSeats < 1 {
+		return ErrTicketSoldOut
+	}
+	bTicket.TicketID, bTicket.FareAmount, bTicket.Currency = ticket.ID, ticket.PriceAmount, ticket.Currency
+	err := tx.Omit("Ticket", "User", "SeatAssignment").Save(bTicket).Error
+	if err != nil {
+		return err
+	}
+	_, hasSeatMap, err := countBookableSeats(tx, ticket.PlaneID)
+	if err != nil || !hasSeatMap {
+		return err
+	}
+	_, err = assignSeat(tx, ticket, bTicket.ID, "")
+	return err
 }
 
 // delete Plane
@@ -57,3 +188,143 @@ func DeleteBTicket(db *gorm.DB, BTicket *BTicket, id string) (err error) {
 	}
 	return nil
 }
+
+// cancel a booked ticket
+//
+// The seat goes back to the ticket. When the booking of the ticket was paid,
+// a Refund is stored, its amount given by policy and the time left before
+// departure. Tickets without a captured payment get no refund, Refund is
+// left empty.
+func CancelBTicket(db *gorm.DB, BTicket *BTicket, id string, cancelledBy int, reason string, policy RefundPolicy, Refund *Refund) (err error) {
+	return db.Transaction(func(tx *gorm.DB) error {
+		bTicket, ticket, err := lockBTicket(tx, id)
+		if err != nil {
+			return err
+		}
+		if bTicket.CancelledAt != nil {
+			return ErrAlreadyCancelled
+		}
+
+		paid, err := paidBooking(tx, bTicket.BookingID)
+		if err != nil {
+			return err
+		}
+		refundPolicy := &policy
+		if !paid {
+			refundPolicy = nil
+		}
+		refund, err := cancelBTicket(tx, &bTicket, ticket, cancelledBy, reason, refundPolicy, time.Now())
+		if err != nil {
+			return err
+		}
+		if refund != nil {
+			*Refund = *refund
+		}
+		*BTicket = bTicket
+		return nil
+	})
+}
+
+// lockBTicket locks a booked ticket and its ticket, ticket first like the
+// booking flow.
+func lockBTicket(tx *gorm.DB, id string) (bTicket BTicket, ticket Ticket, err error) {
+	err = tx.Where("id = ?", id).First(&bTicket).Error
+	if err != nil {
+		return bTicket, ticket, err
+	}
+	ticket, err = lockTicket(tx, strconv.Itoa(bTicket.TicketID))
+	if err != nil {
+		return bTicket, ticket, err
+	}
+	err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).First(&bTicket).Error
+	return bTicket, ticket, err
+}
+
+// cancelBTicket cancels a booked ticket of a locked ticket and records its
+// refund, unless policy is nil
+func cancelBTicket(tx *gorm.DB, bTicket *BTicket, ticket Ticket, cancelledBy int, reason string, policy *RefundPolicy, now time.Time) (refund *Refund, err error) {
+	err = tx.Where("b_ticket_id = ?", bTicket.ID).Delete(&SeatAssignment{}).Error
+	if err != nil {
+		return refund, err
+	}
+	err = tx.Model(&BTicket{}).Where("id = ?", bTicket.ID).Updates(map[string]interface{}{
+		"cancelled_at":  now,
+		"cancelled_by":  cancelledBy,
+		"cancel_reason": reason,
+	}).Error
+	if err != nil {
+		return refund, err
+	}
+	bTicket.CancelledAt, bTicket.CancelledBy, bTicket.CancelReason = &now, &cancelledBy, reason
+	bTicket.SeatAssignment = nil
+	if policy == nil {
+		return nil, updateAvailability(tx, ticket, 1)
+	}
+
+	fare, currency := bTicket.FareAmount, bTicket.Currency
+	if currency == "" {
+		// booked before fares were recorded
+		fare, currency = ticket.PriceAmount, ticket.Currency
+	}
+	amount, percent, rule := policy.Refund(fare, ticket.DepartureAt, now)
+	refund = &Refund{
+		BTicketID:   bTicket.ID,
+		BookingID:   bTicket.BookingID,
+		UserID:      bTicket.UserID,
+		TicketID:    ticket.ID,
+		FareAmount:  fare,
+		Amount:      amount,
+		Currency:    currency,
+		Percent:     percent,
+		Rule:        rule,
+		CancelledBy: cancelledBy,
+		Reason:      reason,
+		Status:      RefundPending,
+	}
+	if amount == 0 {
+		// nothing to send to the payment provider
+		refund.Status = RefundSucceeded
+	}
+	err = tx.Create(refund).Error
+	if err != nil {
+		return refund, err
+	}
+	return refund, updateAvailability(tx, ticket, 1)
+}
+
+// cancelBTickets cancels the booked tickets that are not cancelled yet among
+// bTicketIDs, locking their tickets in id order like the booking flow.
+func cancelBTickets(tx *gorm.DB, bTicketIDs []int, cancelledBy int, reason string, policy *RefundPolicy, Refunds *[]Refund) error {
+	var bTickets []BTicket
+	err := tx.Where("id IN ? AND cancelled_at IS NULL", bTicketIDs).Find(&bTickets).Error
+	if err != nil {
+		return err
+	}
+	sort.Slice(bTickets, func(i, j int) bool {
+		if bTickets[i].TicketID != bTickets[j].TicketID {
+			return bTickets[i].TicketID < bTickets[j].TicketID
+		}
+		return bTickets[i].ID < bTickets[j].ID
+	})
+
+	now := time.Now()
+	tickets := map[int]Ticket{}
+	for i := range bTickets {
+		ticket, ok := tickets[bTickets[i].TicketID]
+		if !ok {
+			ticket, err = lockTicket(tx, strconv.Itoa(bTickets[i].TicketID))
+			if err != nil {
+				return err
+			}
+			tickets[ticket.ID] = ticket
+		}
+		refund, err := cancelBTicket(tx, &bTickets[i], ticket, cancelledBy, reason, policy, now)
+		if err != nil {
+			return err
+		}
+		if refund != nil {
+			*Refunds = append(*Refunds, *refund)
+		}
+	}
+	return nil
+}
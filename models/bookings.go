@@ -0,0 +1,401 @@
+package models
+
+import (
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// booking statuses
+const (
+	BookingPending   = "pending_payment"
+	BookingConfirmed = "confirmed" // paid
+	BookingCancelled = "cancelled"
+	BookingExpired   = "expired" // not paid in time
+)
+
+// passenger types
+const (
+	PassengerAdult  = "ADT"
+	PassengerChild  = "CHD"
+	PassengerInfant = "INF" // travels on an adult's lap, without a seat
+)
+
+// Booking groups the passengers travelling together and the tickets
+// (segments) they travel on, under a PNR-style locator.
+type Booking struct {
+	gorm.Model
+	ID         int
+	Locator    string `gorm:"size:6;uniqueIndex"`
+	UserID     int
+	Status     string           `gorm:"size:20"`
+	Passengers []Passenger      `gorm:"foreignKey:BookingID"`
+	Segments   []BookingSegment `gorm:"foreignKey:BookingID"`
+	// BTickets holds one booked ticket per seated passenger and segment
+	BTickets []BTicket `gorm:"foreignKey:BookingID"`
+	// PaymentDueAt is when an unpaid booking expires and its seats are released
+	PaymentDueAt *time.Time `gorm:"index"`
+	Payments     []Payment  `gorm:"foreignKey:BookingID"`
+}
+
+type Passenger struct {
+	gorm.Model
+	ID             int
+	BookingID      int
+	FirstName      string
+	LastName       string `gorm:"size:100;index"`
+	DateOfBirth    time.Time
+	DocumentNumber string
+	Type           string `gorm:"size:3"`
+}
+
+type BookingSegment struct {
+	gorm.Model
+	ID        int
+	BookingID int
+	TicketID  int
+	Ticket    Ticket `gorm:"foreignKey:TicketID"`
+}
+
+// locator characters, without the easily confused 0/O and 1/I
+const locatorAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+const locatorLength = 6
+
+var ErrInvalidPassengers = errors.New("a booking needs at least one adult and no more infants than adults")
+var ErrNoSegments = errors.New("a booking needs at least one ticket")
+var ErrDuplicateSegment = errors.New("a ticket can only be once in a booking")
+var ErrMixedCurrency = errors.New("all tickets of a booking must be priced in the same currency")
+var ErrSegmentSeatCount = errors.New("seats must give one list per ticket with a seat for every passenger but infants")
+
+// check that a Passenger can be stored
+func (passenger *Passenger) Validate() error {
+	passenger.FirstName = strings.TrimSpace(passenger.FirstName)
+	passenger.LastName = strings.TrimSpace(passenger.LastName)
+	if passenger.FirstName == "" || passenger.LastName == "" {
+		return errors.New("passenger first and last names are required")
+	}
+	if passenger.DateOfBirth.IsZero() || passenger.DateOfBirth.After(time.Now()) {
+		return errors.New("passenger date of birth must be in the past")
+	}
+	if strings.TrimSpace(passenger.DocumentNumber) == "" {
+		return errors.New("passenger document number is required")
+	}
+	if passenger.Type != PassengerAdult && passenger.Type != PassengerChild && passenger.Type != PassengerInfant {
+		return errors.New("passenger type must be ADT, CHD or INF")
+	}
+	return nil
+}
+
+// generate a random booking locator such as "K7QX2M"
+func NewLocator() (string, error) {
+	locator := make([]byte, locatorLength)
+	max := big.NewInt(int64(len(locatorAlphabet)))
+	for i := range locator {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		locator[i] = locatorAlphabet[n.Int64()]
+	}
+	return string(locator), nil
+}
+
+// create a Booking for its passengers on the given tickets
+//
+// Every passenger except infants gets a booked ticket, with a seat on planes
+// that have a seat map, on every segment. seats is empty or has the seats of
+// each ticket, in the order of ticketIDs; an empty list of a ticket assigns
+// its seats. All of it is stored or none of it. The booking waits for payment
+// until PaymentDueAt, see PayBooking.
+func CreateBooking(db *gorm.DB, Booking *Booking, ticketIDs []int, seats [][]string) (err error) {
+	if len(ticketIDs) == 0 {
+		return ErrNoSegments
+	}
+	seated, err := checkPassengers(Booking.Passengers)
+	if err != nil {
+		return err
+	}
+	if len(seats) > 0 && len(seats) != len(ticketIDs) {
+		return ErrSegmentSeatCount
+	}
+	for _, segmentSeats := range seats {
+		if len(segmentSeats) > 0 && len(segmentSeats) != seated {
+			return ErrSegmentSeatCount
+		}
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		// Lock the tickets in id order so concurrent bookings can't deadlock
+		sortedIDs := append([]int(nil), ticketIDs...)
+		sort.Ints(sortedIDs)
+		tickets := map[int]Ticket{}
+		for _, id := range sortedIDs {
+			if _, ok := tickets[id]; ok {
+				return ErrDuplicateSegment
+			}
+			ticket, err := lockTicket(tx, strconv.Itoa(id))
+			if err != nil {
+				return err
+			}
+			if first, ok := tickets[sortedIDs[0]]; ok && ticket.Currency != first.Currency {
+				return ErrMixedCurrency
+			}
+			tickets[id] = ticket
+		}
+
+		err = insertBooking(tx, Booking)
+		if err != nil {
+			return err
+		}
+		for i, id := range ticketIDs {
+			ticket := tickets[id]
+			if ticket.AvailableSeats < seated {
+				return ErrTicketSoldOut
+			}
+			var segmentSeats []string
+			if len(seats) > 0 {
+				segmentSeats = seats[i]
+			}
+			err = bookSegment(tx, Booking, ticket, segmentSeats)
+			if err != nil {
+				return err
+			}
+			err = updateAvailability(tx, ticket, -seated)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// checkPassengers validates the passengers of a booking and returns how many
+// of them need a seat
+func checkPassengers(passengers []Passenger) (seated int, err error) {
+	adults, infants := 0, 0
+	for i := range passengers {
+		if err := passengers[i].Validate(); err != nil {
+			return 0, err
+		}
+		switch passengers[i].Type {
+		case PassengerAdult:
+			adults++
+		case PassengerInfant:
+			infants++
+		}
+	}
+	if adults == 0 || infants > adults {
+		return 0, ErrInvalidPassengers
+	}
+	return len(passengers) - infants, nil
+}
+
+// insertBooking stores a new pending booking with its passengers under a
+// locator that is not taken yet
+func insertBooking(tx *gorm.DB, Booking *Booking) (err error) {
+	Booking.Status = BookingPending
+	for {
+		Booking.Locator, err = NewLocator()
+		if err != nil {
+			return err
+		}
+		var taken int64
+		err = tx.Model(Booking).Where("locator = ?", Booking.Locator).Count(&taken).Error
+		if err != nil {
+			return err
+		}
+		if taken == 0 {
+			break
+		}
+	}
+	return tx.Create(Booking).Error
+}
+
+// bookSegment adds a locked ticket to a booking with a booked ticket for
+// every seated passenger. seats are the seat labels of the passengers in
+// order on planes with a seat map; when empty, seats are assigned
+// automatically. The availability of the ticket is left to the caller.
+func bookSegment(tx *gorm.DB, Booking *Booking, ticket Ticket, seats []string) error {
+	_, hasSeatMap, err := countBookableSeats(tx, ticket.PlaneID)
+	if err != nil {
+		return err
+	}
+	if len(seats) > 0 && !hasSeatMap {
+		return ErrNoSeatMap
+	}
+
+	segment := BookingSegment{BookingID: Booking.ID, TicketID: ticket.ID}
+	err = tx.Omit("Ticket").Create(&segment).Error
+	if err != nil {
+		return err
+	}
+	segment.Ticket = ticket
+	Booking.Segments = append(Booking.Segments, segment)
+
+	for _, passenger := range Booking.Passengers {
+		if passenger.Type == PassengerInfant {
+			continue
+		}
+		bookingID, passengerID := Booking.ID, passenger.ID
+		bTicket := BTicket{
+			TicketID:    ticket.ID,
+			UserID:      Booking.UserID,
+			BookingID:   &bookingID,
+			PassengerID: &passengerID,
+			FareAmount:  ticket.PriceAmount,
+			Currency:    ticket.Currency,
+		}
+		err = tx.Create(&bTicket).Error
+		if err != nil {
+			return err
+		}
+		if hasSeatMap {
+			seat := ""
+			if len(seats) > 0 {
+				seat = seats[0]
+				seats = seats[1:]
+			}
+			bTicket.SeatAssignment, err = assignSeat(tx, ticket, bTicket.ID, seat)
+			if err != nil {
+				return err
+			}
+		}
+		Booking.BTickets = append(Booking.BTickets, bTicket)
+	}
+	return nil
+}
+
+// cancel a Booking and all of its booked tickets
+//
+// Every seat goes back to its ticket. When the booking was paid, each booked
+// ticket gets a Refund, returned in Refunds.
+func CancelBooking(db *gorm.DB, Booking *Booking, locator string, cancelledBy int, reason string, policy RefundPolicy, Refunds *[]Refund) (err error) {
+	err = db.Transaction(func(tx *gorm.DB) error {
+		booking, err := lockBooking(tx, locator)
+		if err != nil {
+			return err
+		}
+		if booking.Status == BookingCancelled || booking.Status == BookingExpired {
+			return ErrAlreadyCancelled
+		}
+		*Refunds = nil
+		// without a captured payment there is nothing to refund
+		paid, err := paidBooking(tx, &booking.ID)
+		if err != nil {
+			return err
+		}
+		refundPolicy := &policy
+		if !paid {
+			refundPolicy = nil
+		}
+		return closeBooking(tx, booking, BookingCancelled, cancelledBy, reason, refundPolicy, Refunds)
+	})
+	if err != nil {
+		return err
+	}
+	return GetBooking(db, Booking, locator)
+}
+
+// cancel the pending bookings that were not paid in time and return how
+// many were cancelled
+func ExpireUnpaidBookings(db *gorm.DB) (expired int, err error) {
+	var locators []string
+	err = db.Model(&Booking{}).Where("status = ? AND payment_due_at < ?", BookingPending, time.Now()).Pluck("locator", &locators).Error
+	if err != nil {
+		return 0, err
+	}
+	for _, locator := range locators {
+		err = db.Transaction(func(tx *gorm.DB) error {
+			booking, err := lockBooking(tx, locator)
+			if err != nil {
+				return err
+			}
+			if booking.Status != BookingPending {
+				// paid or cancelled since it was listed
+				return nil
+			}
+			var refunds []Refund
+			err = closeBooking(tx, booking, BookingExpired, booking.UserID, "not paid in time", nil, &refunds)
+			if err == nil {
+				expired++
+			}
+			return err
+		})
+		if err != nil {
+			return expired, err
+		}
+	}
+	return expired, nil
+}
+
+// closeBooking cancels the booked tickets of a locked booking and gives it
+// status. Refunds are only recorded when policy is set.
+func closeBooking(tx *gorm.DB, booking Booking, status string, cancelledBy int, reason string, policy *RefundPolicy, Refunds *[]Refund) error {
+	var bTicketIDs []int
+	err := tx.Model(&BTicket{}).Where("booking_id = ?", booking.ID).Pluck("id", &bTicketIDs).Error
+	if err != nil {
+		return err
+	}
+	err = cancelBTickets(tx, bTicketIDs, cancelledBy, reason, policy, Refunds)
+	if err != nil {
+		return err
+	}
+	return tx.Model(&booking).Where("id = ?", booking.ID).Update("status", status).Error
+}
+
+// lockBooking locks a booking by locator
+func lockBooking(tx *gorm.DB, locator string) (booking Booking, err error) {
+	err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("locator = ?", strings.ToUpper(strings.TrimSpace(locator))).First(&booking).Error
+	return booking, err
+}
+
+// preloadBooking loads everything a booking is shown with
+func preloadBooking(db *gorm.DB) *gorm.DB {
+	return db.Preload("Passengers").
+		Preload("Segments.Ticket.FromAirport").
+		Preload("Segments.Ticket.ToAirport").
+		Preload("BTickets.SeatAssignment.Seat").
+		Preload("Payments")
+}
+
+// get Bookings
+func GetBookings(db *gorm.DB, Booking *[]Booking) (err error) {
+	err = preloadBooking(db).Find(Booking).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// get Booking by locator
+func GetBooking(db *gorm.DB, Booking *Booking, locator string) (err error) {
+	err = preloadBooking(db).Where("locator = ?", strings.ToUpper(locator)).First(Booking).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// get Booking by locator and the last name of one of its passengers, the
+// way a "manage booking" page finds it without logging in
+func FindBooking(db *gorm.DB, Booking *Booking, locator string, lastName string) (err error) {
+	lastName = strings.TrimSpace(lastName)
+	if lastName == "" {
+		return gorm.ErrRecordNotFound
+	}
+	err = preloadBooking(db).
+		Where("locator = ?", strings.ToUpper(strings.TrimSpace(locator))).
+		Where("id IN (?)", db.Model(&Passenger{}).Select("booking_id").Where("LOWER(last_name) = ?", strings.ToLower(lastName))).
+		First(Booking).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package models
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// hold statuses
+const (
+	HoldHeld      = "held"
+	HoldConfirmed = "confirmed"
+	HoldReleased  = "released"
+	HoldExpired   = "expired"
+)
+
+// SeatHold keeps seats of a Ticket aside for a user until ExpiresAt, so the
+// passengers can be entered before they are booked. Held seats are not
+// available to others.
+type SeatHold struct {
+	gorm.Model
+	ID        int
+	TicketID  int
+	Ticket    Ticket `gorm:"foreignKey:TicketID"`
+	UserID    int
+	Quantity  int
+	Status    string    `gorm:"size:20;index"`
+	ExpiresAt time.Time `gorm:"index"`
+}
+
+var ErrHoldNotActive = errors.New("hold is no longer active")
+var ErrHoldExpired = errors.New("hold has expired")
+var ErrHoldSeatCount = errors.New("number of seats does not match the hold")
+var ErrHoldPassengerCount = errors.New("number of seated passengers does not match the hold")
+
+// hold seats of a Ticket
+func CreateSeatHold(db *gorm.DB, SeatHold *SeatHold, ticketID string, ttl time.Duration) (err error) {
+	return db.Transaction(func(tx *gorm.DB) error {
+		ticket, err := lockTicket(tx, ticketID)
+		if err != nil {
+			return err
+		}
+		if ticket.AvailableSeats < SeatHold.Quantity {
+			return ErrTicketSoldOut
+		}
+
+		SeatHold.TicketID = ticket.ID
+		SeatHold.Status = HoldHeld
+		SeatHold.ExpiresAt = time.Now().Add(ttl)
+		err = tx.Create(SeatHold).Error
+		if err != nil {
+			return err
+		}
+		return updateAvailability(tx, ticket, -SeatHold.Quantity)
+	})
+}
+
+// get SeatHold by id
+func GetSeatHold(db *gorm.DB, SeatHold *SeatHold, id string) (err error) {
+	err = db.Where("id = ?", id).First(SeatHold).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// turn a hold into a Booking for its passengers, waiting for payment
+//
+// A hold of Quantity seats takes as many seated passengers. seats are the
+// seat labels to book on planes with a seat map; when empty, seats are
+// assigned automatically. The booking belongs to the user of the hold and is
+// confirmed once it is paid, see PayBooking.
+func ConfirmSeatHold(db *gorm.DB, SeatHold *SeatHold, id string, Booking *Booking, seats []string) (err error) {
+	seated, err := checkPassengers(Booking.Passengers)
+	if err != nil {
+		return err
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		hold, ticket, err := lockSeatHold(tx, id)
+		if err != nil {
+			return err
+		}
+		if hold.Status != HoldHeld {
+			return ErrHoldNotActive
+		}
+		if time.Now().After(hold.ExpiresAt) {
+			return ErrHoldExpired
+		}
+		if seated != hold.Quantity {
+			return ErrHoldPassengerCount
+		}
+		if len(seats) > 0 && len(seats) != hold.Quantity {
+			return ErrHoldSeatCount
+		}
+
+		// The held seats stop counting as held before they are assigned
+		err = tx.Model(&hold).Where("id = ?", hold.ID).Update("status", HoldConfirmed).Error
+		if err != nil {
+			return err
+		}
+
+		Booking.UserID = hold.UserID
+		err = insertBooking(tx, Booking)
+		if err != nil {
+			return err
+		}
+		err = bookSegment(tx, Booking, ticket, seats)
+		if err != nil {
+			return err
+		}
+
+		hold.Status = HoldConfirmed
+		*SeatHold = hold
+		// Held seats became booked seats, the count doesn't change
+		return updateAvailability(tx, ticket, 0)
+	})
+}
+
+// give the seats of a hold back to the ticket
+func ReleaseSeatHold(db *gorm.DB, SeatHold *SeatHold, id string) (err error) {
+	return releaseSeatHold(db, SeatHold, id, HoldReleased)
+}
+
+// release the holds that have expired and return how many were released
+func ExpireSeatHolds(db *gorm.DB) (expired int, err error) {
+	var ids []string
+	err = db.Model(&SeatHold{}).Where("status = ? AND expires_at < ?", HoldHeld, time.Now()).Pluck("id", &ids).Error
+	if err != nil {
+		return 0, err
+	}
+	for _, id := range ids {
+		var hold SeatHold
+		err = releaseSeatHold(db, &hold, id, HoldExpired)
+		if errors.Is(err, ErrHoldNotActive) {
+			// confirmed or released since it was listed
+			continue
+		}
+		if err != nil {
+			return expired, err
+		}
+		expired++
+	}
+	return expired, nil
+}
+
+func releaseSeatHold(db *gorm.DB, SeatHold *SeatHold, id string, status string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		hold, ticket, err := lockSeatHold(tx, id)
+		if err != nil {
+			return err
+		}
+		if hold.Status != HoldHeld {
+			return ErrHoldNotActive
+		}
+		err = tx.Model(&hold).Where("id = ?", hold.ID).Update("status", status).Error
+		if err != nil {
+			return err
+		}
+		hold.Status = status
+		*SeatHold = hold
+		return updateAvailability(tx, ticket, hold.Quantity)
+	})
+}
+
+// lockSeatHold locks a hold and its ticket, always ticket first like the
+// booking flow, so the two can't deadlock.
+func lockSeatHold(tx *gorm.DB, id string) (hold SeatHold, ticket Ticket, err error) {
+	err = tx.Where("id = ?", id).First(&hold).Error
+	if err != nil {
+		return hold, ticket, err
+	}
+	ticket, err = lockTicket(tx, strconv.Itoa(hold.TicketID))
+	if err != nil {
+		return hold, ticket, err
+	}
+	err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).First(&hold).Error
+	return hold, ticket, err
+}
+
+// updateAvailability applies a change of delta free seats to a locked
+// ticket. Tickets of planes with a seat map recompute it from the map instead.
+func updateAvailability(tx *gorm.DB, ticket Ticket, delta int) error {
+	bookable, hasSeatMap, err := countBookableSeats(tx, ticket.PlaneID)
+	if err != nil {
+		return err
+	}
+	if !hasSeatMap {
+		return tx.Model(&Ticket{}).Where("id = ?", ticket.ID).Update("available_seats", gorm.Expr("available_seats + ?", delta)).Error
+	}
+	return refreshAvailability(tx, ticket, bookable)
+}
@@ -0,0 +1,80 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// idempotency key statuses
+const (
+	IdempotencyInProgress = "in_progress"
+	IdempotencyCompleted  = "completed"
+)
+
+// IdempotencyKey remembers a request sent with an Idempotency-Key header and
+// the response it got, so a retry of the same request gets the same response
+// instead of being run again. Keys are scoped to the user sending them.
+type IdempotencyKey struct {
+	ID     int
+	Key    string `gorm:"size:255;uniqueIndex:idx_idempotency_user_key"`
+	UserID int    `gorm:"uniqueIndex:idx_idempotency_user_key"` // 0 for requests without a user
+	Method string `gorm:"size:10"`
+	Path   string
+	// Fingerprint is a hash of the method, path and body of the request
+	Fingerprint    string `gorm:"size:64"`
+	Status         string `gorm:"size:20"`
+	ResponseStatus int
+	ContentType    string
+	ResponseBody   []byte
+	CreatedAt      time.Time
+	ExpiresAt      time.Time `gorm:"index"`
+}
+
+// store a new IdempotencyKey, created is false when the user already used the key
+func CreateIdempotencyKey(db *gorm.DB, IdempotencyKey *IdempotencyKey) (created bool, err error) {
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(IdempotencyKey)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// get IdempotencyKey of a user
+func GetIdempotencyKey(db *gorm.DB, IdempotencyKey *IdempotencyKey, userID int, key string) (err error) {
+	err = db.Where("user_id = ? AND `key` = ?", userID, key).First(IdempotencyKey).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// store the response of an IdempotencyKey
+func CompleteIdempotencyKey(db *gorm.DB, IdempotencyKey *IdempotencyKey) (err error) {
+	err = db.Model(IdempotencyKey).Where("id = ?", IdempotencyKey.ID).Updates(map[string]interface{}{
+		"status":          IdempotencyCompleted,
+		"response_status": IdempotencyKey.ResponseStatus,
+		"content_type":    IdempotencyKey.ContentType,
+		"response_body":   IdempotencyKey.ResponseBody,
+	}).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// delete IdempotencyKey by id
+func DeleteIdempotencyKey(db *gorm.DB, IdempotencyKey *IdempotencyKey, id int) (err error) {
+	err = db.Where("id = ?", id).Delete(IdempotencyKey).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// delete the keys that have expired and return how many were deleted
+func DeleteExpiredIdempotencyKeys(db *gorm.DB) (deleted int64, err error) {
+	result := db.Where("expires_at < ?", time.Now()).Delete(&IdempotencyKey{})
+	return result.RowsAffected, result.Error
+}
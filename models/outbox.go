@@ -0,0 +1,98 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// outbox email statuses
+const (
+	EmailPending = "pending"
+	EmailSent    = "sent"
+	EmailFailed  = "failed" // gave up after too many attempts
+)
+
+// OutboxEmail is an email waiting to be sent. Emails are stored first and
+// sent in the background, so a request never fails because the mail server
+// is down, and failed deliveries are retried.
+type OutboxEmail struct {
+	ID            int
+	From          string
+	To            string
+	Subject       string
+	Body          string `gorm:"type:text"`
+	HTML          string `gorm:"type:mediumtext"`
+	Status        string `gorm:"size:20;index:idx_outbox_due"`
+	Attempts      int
+	NextAttemptAt time.Time `gorm:"index:idx_outbox_due"`
+	LastError     string
+	SentAt        *time.Time
+	CreatedAt     time.Time
+}
+
+// queue an email
+func QueueEmail(db *gorm.DB, OutboxEmail *OutboxEmail) (err error) {
+	OutboxEmail.Status = EmailPending
+	OutboxEmail.NextAttemptAt = time.Now()
+	err = db.Create(OutboxEmail).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// get the pending emails due for an attempt, oldest first
+func GetDueEmails(db *gorm.DB, OutboxEmail *[]OutboxEmail, limit int) (err error) {
+	err = db.Where("status = ? AND next_attempt_at <= ?", EmailPending, time.Now()).Order("next_attempt_at").Limit(limit).Find(OutboxEmail).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// claim an email for sending until lockedUntil, so another worker doesn't
+// send it at the same time. claimed is false when someone else got it first.
+func ClaimEmail(db *gorm.DB, OutboxEmail *OutboxEmail, lockedUntil time.Time) (claimed bool, err error) {
+	result := db.Model(OutboxEmail).
+		Where("id = ? AND status = ? AND next_attempt_at = ?", OutboxEmail.ID, EmailPending, OutboxEmail.NextAttemptAt).
+		Update("next_attempt_at", lockedUntil)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// mark an email as sent
+func MarkEmailSent(db *gorm.DB, OutboxEmail *OutboxEmail) (err error) {
+	now := time.Now()
+	err = db.Model(OutboxEmail).Where("id = ?", OutboxEmail.ID).Updates(map[string]interface{}{
+		"status":     EmailSent,
+		"attempts":   gorm.Expr("attempts + 1"),
+		"sent_at":    now,
+		"last_error": "",
+	}).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// record a failed attempt, the email is retried at nextAttemptAt or given
+// up when nextAttemptAt is nil
+func MarkEmailFailed(db *gorm.DB, OutboxEmail *OutboxEmail, sendErr error, nextAttemptAt *time.Time) (err error) {
+	updates := map[string]interface{}{
+		"attempts":   gorm.Expr("attempts + 1"),
+		"last_error": sendErr.Error(),
+	}
+	if nextAttemptAt == nil {
+		updates["status"] = EmailFailed
+	} else {
+		updates["next_attempt_at"] = *nextAttemptAt
+	}
+	err = db.Model(OutboxEmail).Where("id = ?", OutboxEmail.ID).Updates(updates).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// PasswordReset lets a user set a new password with a token sent by email.
+// Only the SHA-256 hash of the token is stored, and it can be used once.
+type PasswordReset struct {
+	ID        int
+	UserID    int    `gorm:"index"`
+	TokenHash string `gorm:"size:64;uniqueIndex"`
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+// password policy
+const (
+	MinPasswordLength = 8
+	MaxPasswordBytes  = 72 // bcrypt ignores anything longer
+)
+
+var ErrResetTokenInvalid = errors.New("password reset token is invalid")
+var ErrResetTokenExpired = errors.New("password reset token has expired")
+
+// PasswordPolicyError lists the rules a password breaks
+type PasswordPolicyError struct {
+	Problems []string
+}
+
+func (err *PasswordPolicyError) Error() string {
+	return "password " + strings.Join(err.Problems, ", ")
+}
+
+// ValidatePassword checks a new password against the password policy: at
+// least MinPasswordLength characters, at most MaxPasswordBytes bytes, with
+// a letter and a digit, and different from the username and email.
+func ValidatePassword(password string, user User) error {
+	var problems []string
+	if utf8.RuneCountInString(password) < MinPasswordLength {
+		problems = append(problems, "must be at least 8 characters long")
+	}
+	if len(password) > MaxPasswordBytes {
+		problems = append(problems, "must be at most 72 bytes long")
+	}
+	hasLetter, hasDigit := false, false
+	for _, r := range password {
+		hasLetter = hasLetter || unicode.IsLetter(r)
+		hasDigit = hasDigit || unicode.IsDigit(r)
+	}
+	if !hasLetter || !hasDigit {
+		problems = append(problems, "must contain a letter and a digit")
+	}
+	lower := strings.ToLower(password)
+	if (user.Username != "" && lower == strings.ToLower(user.Username)) || (user.Email != "" && lower == strings.ToLower(user.Email)) {
+		problems = append(problems, "must not be the username or email")
+	}
+	if len(problems) > 0 {
+		return &PasswordPolicyError{Problems: problems}
+	}
+	return nil
+}
+
+// HashResetToken returns the hash a reset token is stored as
+func HashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// create a PasswordReset for a token, earlier unused resets of the user stop working
+func CreatePasswordReset(db *gorm.DB, PasswordReset *PasswordReset, token string) (err error) {
+	PasswordReset.TokenHash = HashResetToken(token)
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := usePasswordResets(tx, PasswordReset.UserID)
+		if err != nil {
+			return err
+		}
+		return tx.Create(PasswordReset).Error
+	})
+}
+
+// usePasswordResets marks the unused resets of a user as used
+func usePasswordResets(tx *gorm.DB, userID int) error {
+	return tx.Model(&PasswordReset{}).Where("user_id = ? AND used_at IS NULL", userID).Update("used_at", time.Now()).Error
+}
+
+// set a new password with a reset token
+//
+// hashedPassword is stored as the password of the user the token belongs
+// to, the token is used up and every session of the user is revoked.
+func ResetPassword(db *gorm.DB, user *User, token string, hashedPassword string) (err error) {
+	if token == "" {
+		return ErrResetTokenInvalid
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		var reset PasswordReset
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ? AND used_at IS NULL", HashResetToken(token)).
+			First(&reset).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrResetTokenInvalid
+		}
+		if err != nil {
+			return err
+		}
+		if time.Now().After(reset.ExpiresAt) {
+			return ErrResetTokenExpired
+		}
+
+		err = tx.Model(&reset).Where("id = ?", reset.ID).Update("used_at", time.Now()).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Where("id = ?", reset.UserID).First(user).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(user).Where("id = ?", reset.UserID).Update("password", hashedPassword).Error
+		if err != nil {
+			return err
+		}
+		_, err = RevokeUserTokens(tx, reset.UserID)
+		return err
+	})
+}
+
+// get the user of an unused, unexpired reset token
+func GetPasswordResetUser(db *gorm.DB, user *User, token string) (err error) {
+	var reset PasswordReset
+	err = db.Where("token_hash = ? AND used_at IS NULL", HashResetToken(token)).First(&reset).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrResetTokenInvalid
+	}
+	if err != nil {
+		return err
+	}
+	if time.Now().After(reset.ExpiresAt) {
+		return ErrResetTokenExpired
+	}
+	return GetUser(db, user, strconv.Itoa(reset.UserID))
+}
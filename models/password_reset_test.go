@@ -0,0 +1,43 @@
+package models
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidatePassword(t *testing.T) {
+	user := User{Username: "ayse2024", Email: "ayse2024@example.com"}
+	tests := []struct {
+		name     string
+		password string
+		problems []string
+	}{
+		{"valid", "Secret123!", nil},
+		{"8 characters of 2 bytes", "şifreş12", nil},
+		{"too short", "Ab1", []string{"must be at least 8 characters long"}},
+		{"too long", "a1" + strings.Repeat("x", 71), []string{"must be at most 72 bytes long"}},
+		{"no digit", "SecretSecret", []string{"must contain a letter and a digit"}},
+		{"no letter", "1234567890", []string{"must contain a letter and a digit"}},
+		{"username", "AYSE2024", []string{"must not be the username or email"}},
+		{"email", "Ayse2024@Example.com", []string{"must not be the username or email"}},
+		{"several problems", "abc", []string{"must be at least 8 characters long", "must contain a letter and a digit"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidatePassword(test.password, user)
+			var policyErr *PasswordPolicyError
+			if err != nil && !errors.As(err, &policyErr) {
+				t.Fatalf("ValidatePassword = %v, want a PasswordPolicyError", err)
+			}
+			var problems []string
+			if policyErr != nil {
+				problems = policyErr.Problems
+			}
+			if !reflect.DeepEqual(problems, test.problems) {
+				t.Errorf("problems = %q, want %q", problems, test.problems)
+			}
+		})
+	}
+}
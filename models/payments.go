@@ -0,0 +1,305 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"project/payments"
+
+	"gorm.io/gorm"
+)
+
+// payment statuses
+const (
+	PaymentPending        = "pending"
+	PaymentRequiresAction = payments.StatusRequiresAction
+	PaymentAuthorized     = payments.StatusAuthorized
+	PaymentCaptured       = payments.StatusCaptured
+	PaymentVoided         = payments.StatusVoided
+	PaymentRefunded       = payments.StatusRefunded
+	PaymentPartlyRefunded = payments.StatusPartlyRefunded
+	PaymentDeclined       = "declined"
+	PaymentFailed         = "failed"
+)
+
+// Payment is one attempt to pay for a Booking. A booking keeps all of its
+// attempts, with the gateway operations of each in Events.
+type Payment struct {
+	gorm.Model
+	ID             int
+	BookingID      int `gorm:"index"`
+	Provider       string
+	Reference      string `gorm:"index"`
+	Amount         int64  // in minor units
+	Currency       string `gorm:"size:3"`
+	RefundedAmount int64
+	Status         string `gorm:"size:20"`
+	CardLast4      string `gorm:"size:4"`
+	ChallengeURL   string
+	FailureReason  string
+	Events         []PaymentEvent `gorm:"foreignKey:PaymentID"`
+}
+
+// PaymentEvent records one gateway operation on a Payment.
+type PaymentEvent struct {
+	ID        int
+	PaymentID int `gorm:"index"`
+	Operation string
+	Amount    int64
+	Status    string
+	Error     string
+	CreatedAt time.Time
+}
+
+var ErrBookingNotPending = errors.New("booking is not waiting for payment")
+var ErrPaymentOverdue = errors.New("payment of the booking is overdue")
+var ErrPaymentNotPending = errors.New("payment is not waiting for a challenge")
+var ErrNothingToRefund = errors.New("booking has no captured payment to refund")
+
+// pay for a pending Booking by card
+//
+// The amount is authorized and captured right away, and the booking is
+// confirmed once it is captured. When the card asks for 3-D Secure, Payment
+// is returned with status requires_action and its ChallengeURL, and
+// CompletePaymentChallenge finishes it.
+func PayBooking(ctx context.Context, db *gorm.DB, gateway payments.Gateway, Payment *Payment, locator string, card payments.Card) (err error) {
+	var booking Booking
+	err = GetBooking(db, &booking, locator)
+	if err != nil {
+		return err
+	}
+	if booking.Status != BookingPending {
+		return ErrBookingNotPending
+	}
+	if booking.PaymentDueAt != nil && time.Now().After(*booking.PaymentDueAt) {
+		return ErrPaymentOverdue
+	}
+
+	amount, currency := bookingAmount(booking)
+	Payment.BookingID = booking.ID
+	Payment.Provider = gateway.Name()
+	Payment.Amount, Payment.Currency = amount, currency
+	Payment.Status = PaymentPending
+	Payment.CardLast4 = card.Last4()
+	err = db.Create(Payment).Error
+	if err != nil {
+		return err
+	}
+	if amount == 0 {
+		// nothing to charge, e.g. free tickets
+		Payment.Status = PaymentCaptured
+		err = savePayment(db, Payment, "capture", 0, nil)
+		if err != nil {
+			return err
+		}
+		return confirmPaidBooking(ctx, db, gateway, Payment)
+	}
+
+	result, err := gateway.Authorize(ctx, payments.AuthorizeRequest{Amount: amount, Currency: currency, Card: card, OrderID: booking.Locator})
+	Payment.Reference = result.Reference
+	if err != nil {
+		Payment.Status = failureStatus(err)
+		if saveErr := savePayment(db, Payment, "authorize", amount, err); saveErr != nil {
+			return saveErr
+		}
+		return err
+	}
+	Payment.Status = result.Status
+	Payment.ChallengeURL = result.ChallengeURL
+	err = savePayment(db, Payment, "authorize", amount, nil)
+	if err != nil || Payment.Status == PaymentRequiresAction {
+		return err
+	}
+	return capturePayment(ctx, db, gateway, Payment)
+}
+
+// finish the 3-D Secure challenge of a Payment and capture it
+func CompletePaymentChallenge(ctx context.Context, db *gorm.DB, gateway payments.Gateway, Payment *Payment, id string, response string) (err error) {
+	err = GetPayment(db, Payment, id)
+	if err != nil {
+		return err
+	}
+	if Payment.Status != PaymentRequiresAction {
+		return ErrPaymentNotPending
+	}
+
+	result, err := gateway.CompleteChallenge(ctx, Payment.Reference, response)
+	if err != nil {
+		Payment.Status = failureStatus(err)
+		if saveErr := savePayment(db, Payment, "challenge", 0, err); saveErr != nil {
+			return saveErr
+		}
+		return err
+	}
+	Payment.Status = result.Status
+	Payment.ChallengeURL = ""
+	err = savePayment(db, Payment, "challenge", 0, nil)
+	if err != nil {
+		return err
+	}
+	return capturePayment(ctx, db, gateway, Payment)
+}
+
+// refund amount of the captured payment of a booking
+func RefundPayment(ctx context.Context, db *gorm.DB, gateway payments.Gateway, Payment *Payment, bookingID int, amount int64) (err error) {
+	err = db.Where("booking_id = ? AND status IN ?", bookingID, []string{PaymentCaptured, PaymentPartlyRefunded}).
+		Order("id DESC").First(Payment).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNothingToRefund
+	}
+	if err != nil {
+		return err
+	}
+	if amount > Payment.Amount-Payment.RefundedAmount {
+		amount = Payment.Amount - Payment.RefundedAmount
+	}
+	if amount <= 0 {
+		return nil
+	}
+
+	result, err := gateway.Refund(ctx, Payment.Reference, amount)
+	if err != nil {
+		if saveErr := savePayment(db, Payment, "refund", amount, err); saveErr != nil {
+			return saveErr
+		}
+		return err
+	}
+	Payment.Status = result.Status
+	Payment.RefundedAmount += amount
+	return savePayment(db, Payment, "refund", amount, nil)
+}
+
+// paidBooking reports whether a booking has a captured payment that was not
+// refunded in full. Booked tickets without a booking were never paid.
+func paidBooking(db *gorm.DB, bookingID *int) (bool, error) {
+	if bookingID == nil {
+		return false, nil
+	}
+	var captured int64
+	err := db.Model(&Payment{}).Where("booking_id = ? AND status IN ?", *bookingID, []string{PaymentCaptured, PaymentPartlyRefunded}).Count(&captured).Error
+	return captured > 0, err
+}
+
+// get the Payments of a booking with their events, oldest first
+func GetPayments(db *gorm.DB, Payment *[]Payment, bookingID int) (err error) {
+	err = db.Preload("Events", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	}).Where("booking_id = ?", bookingID).Order("id").Find(Payment).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// get Payment by id
+func GetPayment(db *gorm.DB, Payment *Payment, id string) (err error) {
+	err = db.Where("id = ?", id).First(Payment).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// capturePayment captures an authorized payment and confirms its booking.
+// The authorization is voided when capturing fails.
+func capturePayment(ctx context.Context, db *gorm.DB, gateway payments.Gateway, payment *Payment) error {
+	var booking Booking
+	err := db.Where("id = ?", payment.BookingID).First(&booking).Error
+	if err != nil {
+		return err
+	}
+	if booking.Status != BookingPending {
+		// cancelled or expired while the customer was paying
+		voidPayment(ctx, db, gateway, payment)
+		return ErrBookingNotPending
+	}
+
+	result, err := gateway.Capture(ctx, payment.Reference, payment.Amount)
+	if err != nil {
+		payment.Status = PaymentFailed
+		if saveErr := savePayment(db, payment, "capture", payment.Amount, err); saveErr != nil {
+			return saveErr
+		}
+		voidPayment(ctx, db, gateway, payment)
+		return err
+	}
+	payment.Status = result.Status
+	err = savePayment(db, payment, "capture", payment.Amount, nil)
+	if err != nil {
+		return err
+	}
+	return confirmPaidBooking(ctx, db, gateway, payment)
+}
+
+// confirmPaidBooking confirms the booking of a captured payment, or refunds
+// the payment when the booking stopped waiting for it in the meantime.
+func confirmPaidBooking(ctx context.Context, db *gorm.DB, gateway payments.Gateway, payment *Payment) error {
+	result := db.Model(&Booking{}).Where("id = ? AND status = ?", payment.BookingID, BookingPending).Update("status", BookingConfirmed)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		if payment.Amount > 0 {
+			var refunded Payment
+			if err := RefundPayment(ctx, db, gateway, &refunded, payment.BookingID, payment.Amount); err != nil {
+				return fmt.Errorf("%w, and refunding the payment failed: %s", ErrBookingNotPending, err)
+			}
+			*payment = refunded
+		}
+		return ErrBookingNotPending
+	}
+	return nil
+}
+
+// voidPayment gives an authorization up, failures are only recorded
+func voidPayment(ctx context.Context, db *gorm.DB, gateway payments.Gateway, payment *Payment) {
+	result, err := gateway.Void(ctx, payment.Reference)
+	if err == nil {
+		payment.Status = result.Status
+	}
+	savePayment(db, payment, "void", 0, err)
+}
+
+// savePayment stores the state of a payment with an event for operation
+func savePayment(db *gorm.DB, payment *Payment, operation string, amount int64, opErr error) error {
+	event := PaymentEvent{PaymentID: payment.ID, Operation: operation, Amount: amount, Status: payment.Status}
+	if opErr != nil {
+		event.Error = opErr.Error()
+		payment.FailureReason = opErr.Error()
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&Payment{}).Where("id = ?", payment.ID).Updates(map[string]interface{}{
+			"reference":       payment.Reference,
+			"status":          payment.Status,
+			"refunded_amount": payment.RefundedAmount,
+			"challenge_url":   payment.ChallengeURL,
+			"failure_reason":  payment.FailureReason,
+		}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(&event).Error
+	})
+}
+
+// failureStatus is the status of a payment whose gateway operation failed
+func failureStatus(err error) string {
+	if errors.Is(err, payments.ErrDeclined) || errors.Is(err, payments.ErrInvalidCard) || errors.Is(err, payments.ErrChallengeFailed) {
+		return PaymentDeclined
+	}
+	return PaymentFailed
+}
+
+// bookingAmount is what the booked tickets of a booking cost
+func bookingAmount(booking Booking) (amount int64, currency string) {
+	for _, bTicket := range booking.BTickets {
+		if bTicket.CancelledAt != nil {
+			continue
+		}
+		amount += bTicket.FareAmount
+		currency = bTicket.Currency
+	}
+	return amount, currency
+}
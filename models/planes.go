@@ -38,9 +38,14 @@ func GetPlane(db *gorm.DB, Plane *Plane, id string) (err error) {
 	return nil
 }
 
-// update a Plane
+// update a Plane, Plane is left holding the updated row
 func UpdatePlane(db *gorm.DB, Plane *Plane, id string) (err error) {
-	err = db.Model(Plane).Where("id = ?", id).Updates(map[string]interface{}{"plane_name": Plane.FirmName, "seat_number": Plane.SeatNumber}).Error
+	firmName, seatNumber := Plane.FirmName, Plane.SeatNumber
+	err = db.Where("id = ?", id).First(Plane).Error
+	if err != nil {
+		return err
+	}
+	err = db.Model(Plane).Updates(map[string]interface{}{"firm_name": firmName, "seat_number": seatNumber}).Error
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,169 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Refund records the money given back for a cancelled booked ticket.
+type Refund struct {
+	gorm.Model
+	ID          int
+	BTicketID   int  `gorm:"uniqueIndex"`
+	BookingID   *int `gorm:"index"`
+	UserID      int  `gorm:"index"`
+	TicketID    int
+	FareAmount  int64  // what was paid, in minor units
+	Amount      int64  // what is refunded, in minor units
+	Currency    string `gorm:"size:3"`
+	Percent     int
+	Rule        string
+	CancelledBy int
+	Reason      string
+	// Status tells whether the payment provider refunded Amount
+	Status   string `gorm:"size:20;index"`
+	Attempts int
+	// Failure is why the last attempt failed
+	Failure string
+}
+
+// refund statuses
+const (
+	RefundPending   = "pending"
+	RefundFailed    = "failed"
+	RefundSucceeded = "succeeded"
+)
+
+// MaxRefundAttempts is how often a refund is sent to the payment provider
+// before it is left failed for someone to look at
+const MaxRefundAttempts = 5
+
+// FareRule refunds RefundPercent of the fare when the ticket is cancelled at
+// least MinHoursBeforeDeparture hours before departure.
+type FareRule struct {
+	MinHoursBeforeDeparture float64 `json:"min_hours_before_departure"`
+	RefundPercent           int     `json:"refund_percent"`
+}
+
+// RefundPolicy picks the refund of a cancellation from its fare rules.
+// Nothing is refunded after departure or when no rule applies.
+type RefundPolicy struct {
+	Rules []FareRule
+}
+
+// full refund more than 24 hours before departure, 25% fee after that
+var DefaultRefundPolicy = RefundPolicy{Rules: []FareRule{
+	{MinHoursBeforeDeparture: 24, RefundPercent: 100},
+	{MinHoursBeforeDeparture: 0, RefundPercent: 75},
+}}
+
+// ParseRefundPolicy reads fare rules from JSON such as
+// [{"min_hours_before_departure": 24, "refund_percent": 100}]
+func ParseRefundPolicy(text string) (RefundPolicy, error) {
+	var policy RefundPolicy
+	if err := json.Unmarshal([]byte(text), &policy.Rules); err != nil {
+		return policy, err
+	}
+	for _, rule := range policy.Rules {
+		if rule.MinHoursBeforeDeparture < 0 || rule.RefundPercent < 0 || rule.RefundPercent > 100 {
+			return policy, errors.New("fare rules need non-negative hours and a refund percent between 0 and 100")
+		}
+	}
+	return policy, nil
+}
+
+// Refund returns the amount refunded for a fare cancelled at cancelledAt,
+// the percentage applied and a description of the rule.
+func (policy RefundPolicy) Refund(fare int64, departureAt time.Time, cancelledAt time.Time) (amount int64, percent int, rule string) {
+	if !cancelledAt.Before(departureAt) {
+		return 0, 0, "cancelled after departure"
+	}
+	hoursLeft := departureAt.Sub(cancelledAt).Hours()
+
+	rules := append([]FareRule(nil), policy.Rules...)
+	sort.Slice(rules, func(i, j int) bool {
+		return rules[i].MinHoursBeforeDeparture > rules[j].MinHoursBeforeDeparture
+	})
+	for _, r := range rules {
+		if hoursLeft >= r.MinHoursBeforeDeparture {
+			// Round down to the minor unit, never refund more than the rule says
+			return fare * int64(r.RefundPercent) / 100, r.RefundPercent, fmt.Sprintf("%d%% refund at least %gh before departure", r.RefundPercent, r.MinHoursBeforeDeparture)
+		}
+	}
+	return 0, 0, "no fare rule applies"
+}
+
+// get Refunds
+func GetRefunds(db *gorm.DB, Refund *[]Refund) (err error) {
+	err = db.Find(Refund).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// record how sending Refunds to the payment provider went
+func SetRefundsStatus(db *gorm.DB, ids []int, status string, failure string) (err error) {
+	err = db.Model(&Refund{}).Where("id IN ?", ids).Updates(map[string]interface{}{
+		"status":   status,
+		"failure":  failure,
+		"attempts": gorm.Expr("attempts + 1"),
+	}).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// retryableRefunds selects the failed refunds with attempts left, and the
+// pending ones not updated since staleBefore, left behind by a request that
+// never got to send them
+func retryableRefunds(db *gorm.DB, staleBefore time.Time) *gorm.DB {
+	return db.Where("attempts < ? AND (status = ? OR (status = ? AND updated_at < ?))", MaxRefundAttempts, RefundFailed, RefundPending, staleBefore)
+}
+
+// get the Refunds to send to the payment provider again
+func GetRetryableRefunds(db *gorm.DB, Refund *[]Refund, staleBefore time.Time) (err error) {
+	err = retryableRefunds(db, staleBefore).Order("id").Find(Refund).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// claim retryable Refunds for sending them again, claimed is false when
+// another worker got to one of them first
+func ClaimRefunds(db *gorm.DB, ids []int, staleBefore time.Time) (claimed bool, err error) {
+	result := retryableRefunds(db.Model(&Refund{}).Where("id IN ?", ids), staleBefore).Update("status", RefundPending)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == int64(len(ids)), nil
+}
+
+// RefundTotal is the sum of refunds in one currency.
+type RefundTotal struct {
+	Currency   string
+	Count      int64
+	FareAmount int64
+	Amount     int64
+	Withheld   int64
+}
+
+// sum Refunds by currency
+func SumRefunds(db *gorm.DB, RefundTotal *[]RefundTotal) (err error) {
+	err = db.Model(&Refund{}).
+		Select("currency, COUNT(*) AS count, SUM(fare_amount) AS fare_amount, SUM(amount) AS amount, SUM(fare_amount) - SUM(amount) AS withheld").
+		Group("currency").
+		Order("currency").
+		Scan(RefundTotal).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRefundPolicyRefund(t *testing.T) {
+	departureAt := time.Date(2030, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		policy      RefundPolicy
+		fare        int64
+		hoursBefore float64
+		amount      int64
+		percent     int
+	}{
+		{"full refund two days before", DefaultRefundPolicy, 10000, 48, 10000, 100},
+		{"full refund exactly a day before", DefaultRefundPolicy, 10000, 24, 10000, 100},
+		{"fee within a day", DefaultRefundPolicy, 10000, 23, 7500, 75},
+		{"rounded down to the minor unit", DefaultRefundPolicy, 999, 1, 749, 75},
+		{"nothing at departure", DefaultRefundPolicy, 10000, 0, 0, 0},
+		{"nothing after departure", DefaultRefundPolicy, 10000, -1, 0, 0},
+		{"unsorted rules", RefundPolicy{Rules: []FareRule{{MinHoursBeforeDeparture: 0, RefundPercent: 10}, {MinHoursBeforeDeparture: 72, RefundPercent: 90}, {MinHoursBeforeDeparture: 24, RefundPercent: 50}}}, 10000, 30, 5000, 50},
+		{"no rule applies", RefundPolicy{Rules: []FareRule{{MinHoursBeforeDeparture: 48, RefundPercent: 50}}}, 10000, 24, 0, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cancelledAt := departureAt.Add(-time.Duration(test.hoursBefore * float64(time.Hour)))
+			amount, percent, rule := test.policy.Refund(test.fare, departureAt, cancelledAt)
+			if amount != test.amount || percent != test.percent {
+				t.Errorf("Refund = %d, %d%% (%s), want %d, %d%%", amount, percent, rule, test.amount, test.percent)
+			}
+			if rule == "" {
+				t.Error("the rule is not described")
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package models
+
+import (
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ConnectionOptions limits which itineraries FindConnections builds.
+type ConnectionOptions struct {
+	MinLayover time.Duration
+	MaxLayover time.Duration
+	MaxStops   int
+	SortBy     string // "duration" or "price"
+	Limit      int
+}
+
+// Itinerary is a sequence of tickets that gets a passenger from the origin
+// to the destination, changing planes at each stop.
+type Itinerary struct {
+	Legs            []Ticket
+	Stops           int
+	DepartureAt     time.Time
+	ArrivalAt       time.Time
+	DurationMinutes int
+	PriceAmount     int64
+	Currency        string
+}
+
+// search itineraries from one place to another leaving on a given day
+//
+// from and to can be IATA or ICAO codes or cities, like in FilterTickets.
+// The first leg departs between dayStart and dayEnd, the later legs can
+// depart up to MaxLayover after the previous leg lands.
+func SearchConnections(db *gorm.DB, Itinerary *[]Itinerary, from string, to string, dayStart time.Time, dayEnd time.Time, opts ConnectionOptions) (err error) {
+	var origins, destinations []int
+	err = AirportIDs(db, from).Scan(&origins).Error
+	if err != nil {
+		return err
+	}
+	err = AirportIDs(db, to).Scan(&destinations).Error
+	if err != nil {
+		return err
+	}
+	if len(origins) == 0 || len(destinations) == 0 {
+		*Itinerary = nil
+		return nil
+	}
+
+	// A leg can't depart later than this and still be part of an itinerary.
+	// Flights are assumed to be shorter than a day.
+	latestDeparture := dayEnd.Add(time.Duration(opts.MaxStops) * (opts.MaxLayover + 24*time.Hour))
+
+	var tickets []Ticket
+	err = db.Preload("FromAirport").Preload("ToAirport").
+		Where("departure_at >= ? AND departure_at < ? AND available_seats > 0", dayStart, latestDeparture).
+		Order("departure_at").
+		Find(&tickets).Error
+	if err != nil {
+		return err
+	}
+
+	*Itinerary = FindConnections(tickets, origins, destinations, dayStart, dayEnd, opts)
+	return nil
+}
+
+// FindConnections builds the itineraries from any of the origin airports to
+// any of the destination airports out of the given tickets, with the first
+// leg departing between dayStart and dayEnd.
+func FindConnections(tickets []Ticket, origins []int, destinations []int, dayStart time.Time, dayEnd time.Time, opts ConnectionOptions) []Itinerary {
+	isDestination := map[int]bool{}
+	for _, id := range destinations {
+		isDestination[id] = true
+	}
+	departuresFrom := map[int][]Ticket{}
+	for _, ticket := range tickets {
+		departuresFrom[ticket.FromAirportID] = append(departuresFrom[ticket.FromAirportID], ticket)
+	}
+
+	var itineraries []Itinerary
+	var legs []Ticket
+	visited := map[int]bool{}
+
+	var extend func(airportID int, earliest time.Time, latest time.Time)
+	extend = func(airportID int, earliest time.Time, latest time.Time) {
+		visited[airportID] = true
+		defer delete(visited, airportID)
+
+		for _, ticket := range departuresFrom[airportID] {
+			if ticket.DepartureAt.Before(earliest) || !ticket.DepartureAt.Before(latest) {
+				continue
+			}
+			if visited[ticket.ToAirportID] {
+				continue
+			}
+			if len(legs) > 0 && ticket.Currency != legs[0].Currency {
+				continue
+			}
+
+			legs = append(legs, ticket)
+			if isDestination[ticket.ToAirportID] {
+				itineraries = append(itineraries, newItinerary(legs))
+			} else if len(legs) <= opts.MaxStops {
+				extend(ticket.ToAirportID, ticket.ArrivalAt.Add(opts.MinLayover), ticket.ArrivalAt.Add(opts.MaxLayover).Add(time.Nanosecond))
+			}
+			legs = legs[:len(legs)-1]
+		}
+	}
+
+	for _, origin := range origins {
+		if isDestination[origin] {
+			continue
+		}
+		extend(origin, dayStart, dayEnd)
+	}
+
+	sort.SliceStable(itineraries, func(i, j int) bool {
+		a, b := itineraries[i], itineraries[j]
+		if opts.SortBy == "price" && a.PriceAmount != b.PriceAmount {
+			return a.PriceAmount < b.PriceAmount
+		}
+		if a.DurationMinutes != b.DurationMinutes {
+			return a.DurationMinutes < b.DurationMinutes
+		}
+		if a.PriceAmount != b.PriceAmount {
+			return a.PriceAmount < b.PriceAmount
+		}
+		return a.DepartureAt.Before(b.DepartureAt)
+	})
+
+	if opts.Limit > 0 && len(itineraries) > opts.Limit {
+		itineraries = itineraries[:opts.Limit]
+	}
+	return itineraries
+}
+
+func newItinerary(legs []Ticket) Itinerary {
+	itinerary := Itinerary{
+		Legs:        append([]Ticket(nil), legs...),
+		Stops:       len(legs) - 1,
+		DepartureAt: legs[0].DepartureAt,
+		ArrivalAt:   legs[len(legs)-1].ArrivalAt,
+		Currency:    legs[0].Currency,
+	}
+	itinerary.DurationMinutes = int(itinerary.ArrivalAt.Sub(itinerary.DepartureAt) / time.Minute)
+	for _, leg := range legs {
+		itinerary.PriceAmount += leg.PriceAmount
+	}
+	return itinerary
+}
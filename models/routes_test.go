@@ -0,0 +1,60 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFindConnections(t *testing.T) {
+	day := time.Date(2030, 6, 1, 0, 0, 0, 0, time.UTC)
+	at := func(hour, minute int) time.Time {
+		return day.Add(time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute)
+	}
+	// airports 1 to 4, with a direct flight from 1 to 3 and connections at 2 and 3
+	tickets := []Ticket{
+		{ID: 1, FromAirportID: 1, ToAirportID: 2, DepartureAt: at(8, 0), ArrivalAt: at(9, 0), PriceAmount: 100, Currency: "TRY"},
+		{ID: 2, FromAirportID: 2, ToAirportID: 3, DepartureAt: at(10, 0), ArrivalAt: at(11, 0), PriceAmount: 100, Currency: "TRY"},
+		{ID: 3, FromAirportID: 2, ToAirportID: 3, DepartureAt: at(9, 30), ArrivalAt: at(10, 30), PriceAmount: 100, Currency: "TRY"},
+		{ID: 4, FromAirportID: 3, ToAirportID: 4, DepartureAt: at(12, 0), ArrivalAt: at(13, 0), PriceAmount: 100, Currency: "TRY"},
+		{ID: 5, FromAirportID: 1, ToAirportID: 3, DepartureAt: at(8, 30), ArrivalAt: at(11, 30), PriceAmount: 500, Currency: "TRY"},
+	}
+	opts := ConnectionOptions{MinLayover: 45 * time.Minute, MaxLayover: 12 * time.Hour, MaxStops: 1, SortBy: "duration"}
+
+	tests := []struct {
+		name     string
+		from, to int
+		change   func(opts *ConnectionOptions)
+		want     [][]int // the ticket ids of each itinerary
+	}{
+		{"direct and one stop", 1, 3, nil, [][]int{{1, 2}, {5}}},
+		{"layover shorter than the minimum", 1, 3, func(opts *ConnectionOptions) { opts.MinLayover = 90 * time.Minute }, [][]int{{5}}},
+		{"layover longer than the maximum", 1, 3, func(opts *ConnectionOptions) { opts.MinLayover, opts.MaxLayover = 0, 45*time.Minute }, [][]int{{1, 3}, {5}}},
+		{"sorted by price", 1, 3, func(opts *ConnectionOptions) { opts.SortBy = "price"; opts.MinLayover = 0 }, [][]int{{1, 3}, {1, 2}, {5}}},
+		{"too many stops", 1, 4, nil, [][]int{}},
+		{"two stops", 1, 4, func(opts *ConnectionOptions) { opts.MaxStops = 2 }, [][]int{{1, 2, 4}}},
+		{"no stops", 1, 3, func(opts *ConnectionOptions) { opts.MaxStops = 0 }, [][]int{{5}}},
+		{"no route", 4, 1, nil, [][]int{}},
+		{"limited", 1, 3, func(opts *ConnectionOptions) { opts.Limit = 1 }, [][]int{{1, 2}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opts := opts
+			if test.change != nil {
+				test.change(&opts)
+			}
+			itineraries := FindConnections(tickets, []int{test.from}, []int{test.to}, day, day.AddDate(0, 0, 1), opts)
+			got := [][]int{}
+			for _, itinerary := range itineraries {
+				var ids []int
+				for _, leg := range itinerary.Legs {
+					ids = append(ids, leg.ID)
+				}
+				got = append(got, ids)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("itineraries = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,281 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// cabin classes
+const (
+	CabinEconomy  = "economy"
+	CabinPremium  = "premium"
+	CabinBusiness = "business"
+	CabinFirst    = "first"
+)
+
+// Seat is one physical seat of a Plane.
+type Seat struct {
+	gorm.Model
+	ID      int
+	PlaneID int    `gorm:"uniqueIndex:idx_plane_seat"`
+	Row     int    `gorm:"uniqueIndex:idx_plane_seat"`
+	Letter  string `gorm:"size:1;uniqueIndex:idx_plane_seat"`
+	Cabin   string
+	ExitRow bool
+	Blocked bool // blocked seats are never sold
+}
+
+// SeatAssignment gives a Seat of the plane to a booked ticket. There is at
+// most one assignment per seat and ticket, which is what keeps two
+// passengers from getting the same seat on a flight.
+type SeatAssignment struct {
+	ID        int
+	TicketID  int  `gorm:"uniqueIndex:idx_ticket_seat"`
+	SeatID    int  `gorm:"uniqueIndex:idx_ticket_seat"`
+	Seat      Seat `gorm:"foreignKey:SeatID"`
+	BTicketID int  `gorm:"uniqueIndex"`
+	CreatedAt time.Time
+}
+
+// SeatLayout describes a seat map the way it is entered, one block of rows per cabin.
+type SeatLayout struct {
+	Cabins   []CabinLayout
+	ExitRows []int
+	Blocked  []string // seat labels such as "1A"
+}
+
+type CabinLayout struct {
+	Class    string
+	FirstRow int
+	LastRow  int
+	Letters  string // seat letters of each row, e.g. "ABCDEF"
+}
+
+// SeatStatus is a Seat of a flight with its availability.
+type SeatStatus struct {
+	Seat
+	Label     string
+	Available bool
+}
+
+var ErrSeatNotFound = errors.New("seat does not exist on this plane")
+var ErrSeatUnavailable = errors.New("seat is not available")
+var ErrNoSeatMap = errors.New("plane has no seat map")
+var ErrSeatMapInUse = errors.New("plane already has booked tickets")
+var ErrNoSeats = errors.New("ticket has no seats to sell")
+
+var seatLabelPattern = regexp.MustCompile(`^([0-9]{1,3})([A-Z])$`)
+var seatLettersPattern = regexp.MustCompile(`^[A-Z]+$`)
+
+// Label returns the seat label, row then letter, e.g. "12C".
+func (seat Seat) Label() string {
+	return strconv.Itoa(seat.Row) + seat.Letter
+}
+
+// ParseSeatLabel splits a label such as "12C" into its row and letter.
+func ParseSeatLabel(label string) (row int, letter string, err error) {
+	match := seatLabelPattern.FindStringSubmatch(strings.ToUpper(strings.TrimSpace(label)))
+	if match == nil {
+		return 0, "", fmt.Errorf("invalid seat %q", label)
+	}
+	row, _ = strconv.Atoi(match[1])
+	return row, match[2], nil
+}
+
+// build the seats of a layout
+func (layout SeatLayout) Seats(planeID int) ([]Seat, error) {
+	exitRows := map[int]bool{}
+	for _, row := range layout.ExitRows {
+		exitRows[row] = true
+	}
+	blocked := map[string]bool{}
+	for _, label := range layout.Blocked {
+		row, letter, err := ParseSeatLabel(label)
+		if err != nil {
+			return nil, err
+		}
+		blocked[strconv.Itoa(row)+letter] = true
+	}
+
+	var seats []Seat
+	rows := map[int]bool{}
+	for _, cabin := range layout.Cabins {
+		if cabin.Class != CabinEconomy && cabin.Class != CabinPremium && cabin.Class != CabinBusiness && cabin.Class != CabinFirst {
+			return nil, fmt.Errorf("invalid cabin class %q", cabin.Class)
+		}
+		if cabin.FirstRow < 1 || cabin.LastRow < cabin.FirstRow {
+			return nil, fmt.Errorf("invalid rows %d-%d", cabin.FirstRow, cabin.LastRow)
+		}
+		letters := strings.ToUpper(cabin.Letters)
+		if letters == "" || !seatLettersPattern.MatchString(letters) {
+			return nil, fmt.Errorf("invalid seat letters %q", cabin.Letters)
+		}
+		for row := cabin.FirstRow; row <= cabin.LastRow; row++ {
+			if rows[row] {
+				return nil, fmt.Errorf("row %d is in more than one cabin", row)
+			}
+			rows[row] = true
+			for _, letter := range letters {
+				seat := Seat{PlaneID: planeID, Row: row, Letter: string(letter), Cabin: cabin.Class, ExitRow: exitRows[row]}
+				seat.Blocked = blocked[seat.Label()]
+				seats = append(seats, seat)
+			}
+		}
+	}
+	if len(seats) == 0 {
+		return nil, errors.New("seat map has no seats")
+	}
+	return seats, nil
+}
+
+// get the seats of a Plane
+func GetSeats(db *gorm.DB, Seat *[]Seat, planeID string) (err error) {
+	err = db.Where("plane_id = ?", planeID).Order("`row`, letter").Find(Seat).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// replace the seat map of a Plane
+//
+// Tickets of the plane get their capacity from the new seat map. This is
+// refused once any ticket of the plane has been booked.
+func ReplaceSeats(db *gorm.DB, seats *[]Seat, planeID string) (err error) {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var booked int64
+		err := tx.Model(&BTicket{}).Where("cancelled_at IS NULL AND ticket_id IN (?)", tx.Model(&Ticket{}).Select("id").Where("plane_id = ?", planeID)).Count(&booked).Error
+		if err != nil {
+			return err
+		}
+		if booked > 0 {
+			return ErrSeatMapInUse
+		}
+
+		err = tx.Unscoped().Where("plane_id = ?", planeID).Delete(&Seat{}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Create(seats).Error
+		if err != nil {
+			return err
+		}
+
+		var bookable int64
+		err = tx.Model(&Seat{}).Where("plane_id = ? AND blocked = ?", planeID, false).Count(&bookable).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&Ticket{}).Where("plane_id = ?", planeID).Updates(map[string]interface{}{"seat_capacity": bookable, "available_seats": bookable}).Error
+	})
+}
+
+// get the seat map of a Ticket with the availability of each seat
+func GetTicketSeats(db *gorm.DB, SeatStatus *[]SeatStatus, ticket Ticket) (err error) {
+	var seats []Seat
+	err = GetSeats(db, &seats, strconv.Itoa(ticket.PlaneID))
+	if err != nil {
+		return err
+	}
+	var taken []int
+	err = db.Model(&SeatAssignment{}).Where("ticket_id = ?", ticket.ID).Pluck("seat_id", &taken).Error
+	if err != nil {
+		return err
+	}
+	isTaken := map[int]bool{}
+	for _, id := range taken {
+		isTaken[id] = true
+	}
+
+	*SeatStatus = nil
+	for _, seat := range seats {
+		*SeatStatus = append(*SeatStatus, SeatStatusOf(seat, !seat.Blocked && !isTaken[seat.ID]))
+	}
+	return nil
+}
+
+func SeatStatusOf(seat Seat, available bool) SeatStatus {
+	return SeatStatus{Seat: seat, Label: seat.Label(), Available: available}
+}
+
+// countBookableSeats returns how many seats of the plane can be sold,
+// and whether the plane has a seat map at all.
+func countBookableSeats(tx *gorm.DB, planeID int) (bookable int64, hasSeatMap bool, err error) {
+	var total int64
+	err = tx.Model(&Seat{}).Where("plane_id = ?", planeID).Count(&total).Error
+	if err != nil || total == 0 {
+		return 0, false, err
+	}
+	err = tx.Model(&Seat{}).Where("plane_id = ? AND blocked = ?", planeID, false).Count(&bookable).Error
+	return bookable, true, err
+}
+
+// assignSeat picks the requested seat, or the first free one when label is
+// empty, and assigns it to the booked ticket. The ticket row must be locked.
+func assignSeat(tx *gorm.DB, ticket Ticket, bTicketID int, label string) (*SeatAssignment, error) {
+	var seat Seat
+	if label != "" {
+		row, letter, err := ParseSeatLabel(label)
+		if err != nil {
+			return nil, ErrSeatNotFound
+		}
+		err = tx.Where("plane_id = ? AND `row` = ? AND letter = ?", ticket.PlaneID, row, letter).First(&seat).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSeatNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		if seat.Blocked {
+			return nil, ErrSeatUnavailable
+		}
+		var taken int64
+		err = tx.Model(&SeatAssignment{}).Where("ticket_id = ? AND seat_id = ?", ticket.ID, seat.ID).Count(&taken).Error
+		if err != nil {
+			return nil, err
+		}
+		if taken > 0 {
+			return nil, ErrSeatUnavailable
+		}
+	} else {
+		err := tx.Where("plane_id = ? AND blocked = ?", ticket.PlaneID, false).
+			Where("id NOT IN (?)", tx.Model(&SeatAssignment{}).Select("seat_id").Where("ticket_id = ?", ticket.ID)).
+			Order("`row`, letter").
+			First(&seat).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTicketSoldOut
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	assignment := SeatAssignment{TicketID: ticket.ID, SeatID: seat.ID, Seat: seat, BTicketID: bTicketID}
+	err := tx.Omit("Seat").Create(&assignment).Error
+	if err != nil {
+		return nil, err
+	}
+	return &assignment, nil
+}
+
+// refreshAvailability recomputes the available seats of a seat-mapped
+// ticket from its seat map, seat assignments and active holds.
+func refreshAvailability(tx *gorm.DB, ticket Ticket, bookable int64) error {
+	var assigned int64
+	err := tx.Model(&SeatAssignment{}).Where("ticket_id = ?", ticket.ID).Count(&assigned).Error
+	if err != nil {
+		return err
+	}
+	var held int64
+	err = tx.Model(&SeatHold{}).Where("ticket_id = ? AND status = ?", ticket.ID, HoldHeld).Select("COALESCE(SUM(quantity), 0)").Scan(&held).Error
+	if err != nil {
+		return err
+	}
+	return tx.Model(&Ticket{}).Where("id = ?", ticket.ID).Updates(map[string]interface{}{"seat_capacity": bookable, "available_seats": bookable - assigned - held}).Error
+}
@@ -0,0 +1,219 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Tickets used to keep dates, hours, seats and price as strings in the
+// departure_date, return_date, d_hour, r_hour, nof_seats and price columns,
+// and the airports as free text in the from and to columns.
+// MigrateLegacyTickets and MigrateLegacyTicketAirports convert those rows to
+// the typed columns, once, from the convert_legacy_tickets migration. The
+// legacy columns are never dropped, so rows that could not be converted keep
+// them and can be fixed by hand.
+
+// TicketMigrationIssue describes a legacy ticket row that could not be converted.
+type TicketMigrationIssue struct {
+	TicketID int
+	Reason   string
+}
+
+func (issue TicketMigrationIssue) String() string {
+	return fmt.Sprintf("ticket %d: %s", issue.TicketID, issue.Reason)
+}
+
+type legacyTicket struct {
+	ID            int
+	DepartureDate sql.NullString
+	ReturnDate    sql.NullString
+	DHour         sql.NullString
+	RHour         sql.NullString
+	NofSeats      sql.NullString
+	Price         sql.NullString
+}
+
+// convert legacy string columns of tickets into the typed columns
+//
+// Dates and hours have no timezone, so they are read in loc. Prices without a
+// currency get defaultCurrency. Rows that can't be parsed are left untouched
+// and returned as issues.
+func MigrateLegacyTickets(db *gorm.DB, loc *time.Location, defaultCurrency string) (migrated int, issues []TicketMigrationIssue, err error) {
+	if !db.Migrator().HasColumn(&Ticket{}, "nof_seats") {
+		return 0, nil, nil
+	}
+
+	var rows []legacyTicket
+	err = db.Table("tickets").
+		Select("id, departure_date, return_date, d_hour, r_hour, nof_seats, price").
+		Where("(currency IS NULL OR currency = '') AND deleted_at IS NULL").
+		Scan(&rows).Error
+	if err != nil {
+		return 0, nil, err
+	}
+
+	for _, row := range rows {
+		updates, reason := convertLegacyTicket(db, row, loc, defaultCurrency)
+		if reason != "" {
+			issues = append(issues, TicketMigrationIssue{TicketID: row.ID, Reason: reason})
+			continue
+		}
+		err = db.Model(&Ticket{}).Where("id = ?", row.ID).Updates(updates).Error
+		if err != nil {
+			return migrated, issues, err
+		}
+		migrated++
+	}
+	return migrated, issues, nil
+}
+
+type legacyTicketAirports struct {
+	ID   int
+	From sql.NullString
+	To   sql.NullString
+}
+
+// link tickets that have free text from and to columns to airports
+func MigrateLegacyTicketAirports(db *gorm.DB) (migrated int, issues []TicketMigrationIssue, err error) {
+	if !db.Migrator().HasColumn(&Ticket{}, "from") {
+		return 0, nil, nil
+	}
+
+	var rows []legacyTicketAirports
+	err = db.Table("tickets").
+		Select("id, `from`, `to`").
+		Where("(from_airport_id IS NULL OR from_airport_id = 0) AND deleted_at IS NULL").
+		Scan(&rows).Error
+	if err != nil {
+		return 0, nil, err
+	}
+
+	for _, row := range rows {
+		var from, to Airport
+		err = ResolveAirport(db, &from, row.From.String)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			issues = append(issues, TicketMigrationIssue{TicketID: row.ID, Reason: fmt.Sprintf("no single airport matches %q", row.From.String)})
+			continue
+		}
+		if err != nil {
+			return migrated, issues, err
+		}
+		err = ResolveAirport(db, &to, row.To.String)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			issues = append(issues, TicketMigrationIssue{TicketID: row.ID, Reason: fmt.Sprintf("no single airport matches %q", row.To.String)})
+			continue
+		}
+		if err != nil {
+			return migrated, issues, err
+		}
+
+		err = db.Model(&Ticket{}).Where("id = ?", row.ID).Updates(map[string]interface{}{"from_airport_id": from.ID, "to_airport_id": to.ID}).Error
+		if err != nil {
+			return migrated, issues, err
+		}
+		migrated++
+	}
+	return migrated, issues, nil
+}
+
+func convertLegacyTicket(db *gorm.DB, row legacyTicket, loc *time.Location, defaultCurrency string) (map[string]interface{}, string) {
+	departureAt, err := parseLegacyDateTime(row.DepartureDate.String, row.DHour.String, loc)
+	if err != nil {
+		return nil, "departure: " + err.Error()
+	}
+	arrivalAt, err := parseLegacyDateTime(row.ReturnDate.String, row.RHour.String, loc)
+	if err != nil {
+		return nil, "arrival: " + err.Error()
+	}
+	if !arrivalAt.After(departureAt) {
+		return nil, "arrival is not after departure"
+	}
+
+	availableSeats, err := strconv.Atoi(strings.TrimSpace(row.NofSeats.String))
+	if err != nil || availableSeats < 0 {
+		return nil, fmt.Sprintf("invalid number of seats %q", row.NofSeats.String)
+	}
+	// nof_seats was decremented on every booking, so the capacity is what
+	// is left plus what was booked
+	var booked int64
+	err = db.Model(&BTicket{}).Where("ticket_id = ?", row.ID).Count(&booked).Error
+	if err != nil {
+		return nil, err.Error()
+	}
+
+	priceAmount, currency, err := ParsePrice(row.Price.String)
+	if err != nil {
+		return nil, err.Error()
+	}
+	if currency == "" {
+		currency = defaultCurrency
+	}
+
+	return map[string]interface{}{
+		"departure_at":    departureAt,
+		"arrival_at":      arrivalAt,
+		"seat_capacity":   availableSeats + int(booked),
+		"available_seats": availableSeats,
+		"price_amount":    priceAmount,
+		"currency":        currency,
+	}, ""
+}
+
+var legacyDateLayouts = []string{"2006-01-02", "02.01.2006", "02/01/2006"}
+var legacyHourLayouts = []string{"15:04", "15:04:05", "15.04"}
+
+func parseLegacyDateTime(date string, hour string, loc *time.Location) (time.Time, error) {
+	date = strings.TrimSpace(date)
+	hour = strings.TrimSpace(hour)
+	if date == "" {
+		return time.Time{}, errors.New("missing date")
+	}
+	if hour == "" {
+		hour = "00:00"
+	}
+	for _, dateLayout := range legacyDateLayouts {
+		for _, hourLayout := range legacyHourLayouts {
+			t, err := time.ParseInLocation(dateLayout+" "+hourLayout, date+" "+hour, loc)
+			if err == nil {
+				return t, nil
+			}
+		}
+	}
+	return time.Time{}, fmt.Errorf("can't parse date %q and hour %q", date, hour)
+}
+
+var pricePattern = regexp.MustCompile(`^([0-9]+)(?:[.,]([0-9]{1,2}))?\s*(TL|[A-Za-z]{3})?$`)
+
+// ParsePrice parses a decimal price such as "1250", "99.9" or "1250,50 TRY"
+// into minor units without going through floating point. The currency is
+// empty when the text doesn't contain one.
+func ParsePrice(text string) (amount int64, currency string, err error) {
+	match := pricePattern.FindStringSubmatch(strings.TrimSpace(text))
+	if match == nil {
+		return 0, "", fmt.Errorf("invalid price %q", text)
+	}
+	major, err := strconv.ParseInt(match[1], 10, 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid price %q", text)
+	}
+	minorText := match[2]
+	if len(minorText) == 1 {
+		minorText += "0"
+	}
+	var minor int64
+	if minorText != "" {
+		minor, _ = strconv.ParseInt(minorText, 10, 64)
+	}
+	currency = strings.ToUpper(match[3])
+	if currency == "TL" {
+		currency = "TRY"
+	}
+	return major*100 + minor, currency, nil
+}
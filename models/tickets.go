@@ -1,26 +1,77 @@
 package models
 
 import (
+	"errors"
+	"regexp"
+	"time"
+
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type Ticket struct {
 	gorm.Model
-	ID            int
-	PlaneID       int   // Foreign key referencing Plane ID
-	Plane         Plane `gorm:"foreignKey:PlaneID"` // Relationship with Plane model
-	From          string
-	To            string
-	DepartureDate string
-	ReturnDate    string
-	DHour         string
-	RHour         string
-	NofSeats      string
-	Price         string
+	ID             int
+	PlaneID        int   // Foreign key referencing Plane ID
+	Plane          Plane `gorm:"foreignKey:PlaneID"` // Relationship with Plane model
+	FromAirportID  int
+	FromAirport    Airport `gorm:"foreignKey:FromAirportID"`
+	ToAirportID    int
+	ToAirport      Airport   `gorm:"foreignKey:ToAirportID"`
+	DepartureAt    time.Time // Departure time, with its timezone offset on input
+	ArrivalAt      time.Time // Arrival time, with its timezone offset on input
+	SeatCapacity   int
+	AvailableSeats int
+	PriceAmount    int64  // Price in minor units of Currency (kuruş, cents, ...)
+	Currency       string `gorm:"size:3"` // ISO 4217 code such as TRY or EUR
+}
+
+var ErrCapacityBelowBooked = errors.New("seat capacity is lower than the number of booked seats")
+var ErrPlaneChangeBooked = errors.New("can't change the plane of a ticket that has bookings")
+
+var currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// check that a Ticket can be stored
+func (ticket *Ticket) Validate() error {
+	if ticket.FromAirportID == 0 || ticket.ToAirportID == 0 {
+		return errors.New("departure and arrival airports are required")
+	}
+	if ticket.FromAirportID == ticket.ToAirportID {
+		return errors.New("departure and arrival airports must be different")
+	}
+	if ticket.DepartureAt.IsZero() || ticket.ArrivalAt.IsZero() {
+		return errors.New("departure and arrival times are required")
+	}
+	if !ticket.ArrivalAt.After(ticket.DepartureAt) {
+		return errors.New("arrival must be after departure")
+	}
+	if ticket.SeatCapacity < 0 {
+		return errors.New("seat capacity can't be negative")
+	}
+	if ticket.PriceAmount < 0 {
+		return errors.New("price can't be negative")
+	}
+	if !currencyPattern.MatchString(ticket.Currency) {
+		return errors.New("currency must be a 3 letter ISO 4217 code")
+	}
+	return nil
 }
 
 // create a Plane
+//
+// Tickets of planes with a seat map take their capacity from it.
 func CreateTicket(db *gorm.DB, Ticket *Ticket) (err error) {
+	bookable, hasSeatMap, err := countBookableSeats(db, Ticket.PlaneID)
+	if err != nil {
+		return err
+	}
+	if hasSeatMap {
+		Ticket.SeatCapacity = int(bookable)
+	}
+	if Ticket.SeatCapacity <= 0 {
+		return ErrNoSeats
+	}
+	Ticket.AvailableSeats = Ticket.SeatCapacity
 	err = db.Create(Ticket).Error
 	if err != nil {
 		return err
@@ -30,7 +81,7 @@ func CreateTicket(db *gorm.DB, Ticket *Ticket) (err error) {
 
 // get Planes
 func GetTickets(db *gorm.DB, Ticket *[]Ticket) (err error) {
-	err = db.Find(Ticket).Error
+	err = db.Preload("FromAirport").Preload("ToAirport").Find(Ticket).Error
 	if err != nil {
 		return err
 	}
@@ -39,7 +90,7 @@ func GetTickets(db *gorm.DB, Ticket *[]Ticket) (err error) {
 
 // get Planes
 func FilterTickets(db *gorm.DB, Ticket *[]Ticket) (err error) {
-	err = db.Find(Ticket).Error
+	err = db.Preload("FromAirport").Preload("ToAirport").Find(Ticket).Error
 	if err != nil {
 		return err
 	}
@@ -48,7 +99,7 @@ func FilterTickets(db *gorm.DB, Ticket *[]Ticket) (err error) {
 
 // get Plane by id
 func GetTicket(db *gorm.DB, Ticket *Ticket, id string) (err error) {
-	err = db.Where("id = ?", id).First(Ticket).Error
+	err = db.Preload("FromAirport").Preload("ToAirport").Where("id = ?", id).First(Ticket).Error
 	if err != nil {
 		return err
 	}
@@ -56,12 +107,43 @@ func GetTicket(db *gorm.DB, Ticket *Ticket, id string) (err error) {
 }
 
 // update a Plane
+//
+// Changing the seat capacity moves the available seats by the same amount,
+// so seats that are already booked stay booked. Tickets of planes with a
+// seat map take their capacity from it.
 func UpdateTicket(db *gorm.DB, Ticket *Ticket, id string) (err error) {
-	err = db.Model(Ticket).Where("id = ?", id).Updates(map[string]interface{}{"plane_ID": Ticket.PlaneID, "From": Ticket.From, "To": Ticket.To, "departure_date": Ticket.DepartureDate, "return_date": Ticket.ReturnDate, "d_Hour": Ticket.DHour, "r_Hour": Ticket.RHour, "nof_Seats": Ticket.NofSeats, "price": Ticket.Price}).Error
-	if err != nil {
-		return err
-	}
-	return nil
+	return db.Transaction(func(tx *gorm.DB) error {
+		current, err := lockTicket(tx, id)
+		if err != nil {
+			return err
+		}
+		booked := current.SeatCapacity - current.AvailableSeats
+		if Ticket.PlaneID != current.PlaneID && booked > 0 {
+			return ErrPlaneChangeBooked
+		}
+		bookable, hasSeatMap, err := countBookableSeats(tx, Ticket.PlaneID)
+		if err != nil {
+			return err
+		}
+		if hasSeatMap {
+			Ticket.SeatCapacity = int(bookable)
+		}
+		if Ticket.SeatCapacity <= 0 {
+			return ErrNoSeats
+		}
+		if Ticket.SeatCapacity < booked {
+			return ErrCapacityBelowBooked
+		}
+		Ticket.AvailableSeats = Ticket.SeatCapacity - booked
+
+		return tx.Model(Ticket).Where("id = ?", id).Updates(map[string]interface{}{"plane_ID": Ticket.PlaneID, "from_airport_id": Ticket.FromAirportID, "to_airport_id": Ticket.ToAirportID, "departure_at": Ticket.DepartureAt, "arrival_at": Ticket.ArrivalAt, "seat_capacity": Ticket.SeatCapacity, "available_seats": Ticket.AvailableSeats, "price_amount": Ticket.PriceAmount, "currency": Ticket.Currency}).Error
+	})
+}
+
+// lock a Ticket row until the end of the transaction
+func lockTicket(tx *gorm.DB, id string) (ticket Ticket, err error) {
+	err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).First(&ticket).Error
+	return ticket, err
 }
 
 // delete Plane
@@ -1,35 +1,135 @@
 package models
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"time"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// Token is a refresh token. Access tokens are signed and never stored, a
+// session is the chain of refresh tokens rotated from one login.
 type Token struct {
 	gorm.Model
-	UserID       int
-	Token        string
+	UserID int `gorm:"index"`
+	// TokenHash is the sha256 of the refresh token, only the client knows the token
+	TokenHash string `gorm:"size:64;index"`
+	// SessionID is shared by every refresh token rotated from the same login
+	SessionID    string `gorm:"size:36;index"`
 	StartingDate *time.Time
 	EndingDate   *time.Time
+	// RotatedAt is set once the token was exchanged for a new one
+	RotatedAt *time.Time
+	RevokedAt *time.Time
 }
 
-// create a Token
-func CreateToken(db *gorm.DB, user User) (Token, error) {
-	var token Token
+var ErrRefreshTokenInvalid = errors.New("refresh token is invalid")
+var ErrRefreshTokenExpired = errors.New("refresh token has expired")
+var ErrRefreshTokenReused = errors.New("refresh token was already used, the session has been revoked")
 
-	token.Token = uuid.New().String()
-	token.UserID = user.ID
-	startingDate := time.Now()
-	token.StartingDate = &startingDate
-	endDate := startingDate.Add(time.Hour * 24 * 30) // Token is valid for 30 days
-	token.EndingDate = &endDate
+// HashRefreshToken returns the hash a refresh token is stored as
+func HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
 
+// create a Token starting a new session and return the refresh token
+func CreateToken(db *gorm.DB, user User, ttl time.Duration) (Token, string, error) {
+	token, refreshToken, err := newRefreshToken(user.ID, uuid.New().String(), ttl)
+	if err != nil {
+		return token, "", err
+	}
 	if err := db.Create(&token).Error; err != nil {
-		return token, err
+		return token, "", err
+	}
+	return token, refreshToken, nil
+}
+
+// newRefreshToken returns an unsaved Token of a session with a random refresh token
+func newRefreshToken(userID int, sessionID string, ttl time.Duration) (Token, string, error) {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return Token{}, "", err
+	}
+	refreshToken := hex.EncodeToString(random)
+
+	startingDate := time.Now()
+	endingDate := startingDate.Add(ttl)
+	token := Token{
+		UserID:       userID,
+		TokenHash:    HashRefreshToken(refreshToken),
+		SessionID:    sessionID,
+		StartingDate: &startingDate,
+		EndingDate:   &endingDate,
+	}
+	return token, refreshToken, nil
+}
+
+// exchange a refresh token for a new Token of the same session
+//
+// Every refresh token can be used once. Presenting a token that was already
+// rotated means it was copied, so the whole session is revoked and
+// ErrRefreshTokenReused is returned.
+func RotateToken(db *gorm.DB, Token *Token, refreshToken string, ttl time.Duration) (string, error) {
+	if refreshToken == "" {
+		return "", ErrRefreshTokenInvalid
+	}
+	var newToken string
+	reused := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		current, err := lockToken(tx, HashRefreshToken(refreshToken))
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrRefreshTokenInvalid
+		}
+		if err != nil {
+			return err
+		}
+		if current.RevokedAt != nil {
+			return ErrRefreshTokenInvalid
+		}
+		if current.RotatedAt != nil {
+			// Commit the revocation, the error is returned after the transaction
+			reused = true
+			return RevokeSession(tx, current.SessionID)
+		}
+		if current.EndingDate == nil || time.Now().After(*current.EndingDate) {
+			return ErrRefreshTokenExpired
+		}
+
+		err = tx.Model(&current).Where("id = ?", current.ID).Update("rotated_at", time.Now()).Error
+		if err != nil {
+			return err
+		}
+		next, plain, err := newRefreshToken(current.UserID, current.SessionID, ttl)
+		if err != nil {
+			return err
+		}
+		if err := tx.Create(&next).Error; err != nil {
+			return err
+		}
+		*Token = next
+		newToken = plain
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if reused {
+		return "", ErrRefreshTokenReused
 	}
-	return token, nil
+	return newToken, nil
+}
+
+// lockToken loads the Token with the given hash for update
+func lockToken(tx *gorm.DB, tokenHash string) (Token, error) {
+	var token Token
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("token_hash = ?", tokenHash).First(&token).Error
+	return token, err
 }
 
 // get Token by id
@@ -40,3 +140,30 @@ func GetToken(db *gorm.DB, Token *Token, id string) (err error) {
 	}
 	return nil
 }
+
+// revoke every Token of a session
+func RevokeSession(db *gorm.DB, sessionID string) (err error) {
+	err = db.Model(&Token{}).Where("session_id = ? AND revoked_at IS NULL", sessionID).Update("revoked_at", time.Now()).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// revoke every active Token of a user
+func RevokeUserTokens(db *gorm.DB, userID int) (revoked int64, err error) {
+	result := db.Model(&Token{}).Where("user_id = ? AND revoked_at IS NULL", userID).Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
+
+// get the Tokens revoked since a time, with their session
+func GetRevokedTokens(db *gorm.DB, Token *[]Token, since time.Time) (err error) {
+	err = db.Select("session_id", "revoked_at").Where("revoked_at >= ?", since).Find(Token).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -1,27 +1,44 @@
 package models
 
 import (
+	"errors"
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type User struct {
 	gorm.Model
-	ID             int    `json:"id" gorm:"primary_key"`
-	Username       string `json:"username" gorm:"unique"`
-	Email          string `json:"email" gorm:"unique"`
-	Password       string `json:"password"`
+	ID       int    `json:"id" gorm:"primary_key"`
+	Username string `json:"username" gorm:"unique"`
+	Email    string `json:"email" gorm:"unique"`
+	Password string `json:"password"`
+	Role     string `json:"role" gorm:"default:customer"`
+	// Locale is the language of the emails sent to the user, e.g. "tr" or "en"
+	Locale         string `json:"locale" gorm:"size:5"`
 	PlainPassword  string `gorm:"-"`
 	ActivationCode string
-	Active         bool
-	LastLogin      *time.Time
-	IPAddress      string
-	CreatedAt      *time.Time
+	// ActivationExpiresAt is when ActivationCode stops being accepted
+	ActivationExpiresAt *time.Time
+	Active              bool
+	LastLogin           *time.Time
+	IPAddress           string
+	CreatedAt           *time.Time
 }
 
+// user roles, from least to most privileged
+const (
+	RoleCustomer = "customer"
+	RoleAgent    = "agent"
+	RoleAdmin    = "admin"
+)
+
+var ErrActivationCodeInvalid = errors.New("activation code is invalid")
+var ErrActivationCodeExpired = errors.New("activation code has expired")
+
 func CreateUser(db *gorm.DB, user *User) (err error) {
-	err = db.Create(user).Error
+	err = createUser(db, user)
 	if err != nil {
 		return err
 	}
@@ -29,13 +46,30 @@ func CreateUser(db *gorm.DB, user *User) (err error) {
 }
 
 func Register(db *gorm.DB, user *User) (err error) {
-	err = db.Create(user).Error
+	err = createUser(db, user)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// createUser stores a new User, or returns ErrUsernameTaken or ErrEmailTaken
+func createUser(db *gorm.DB, user *User) error {
+	if taken, err := userFieldTaken(db, "username", user.Username, 0); err != nil || taken {
+		if err == nil {
+			err = ErrUsernameTaken
+		}
+		return err
+	}
+	if taken, err := userFieldTaken(db, "email", user.Email, 0); err != nil || taken {
+		if err == nil {
+			err = ErrEmailTaken
+		}
+		return err
+	}
+	return db.Create(user).Error
+}
+
 func Login(db *gorm.DB, user *User, email string) (err error) {
 	err = db.Where("email = ?", email).First(user).Error
 	if err != nil {
@@ -44,6 +78,49 @@ func Login(db *gorm.DB, user *User, email string) (err error) {
 	return nil
 }
 
+// activate a User by its activation code
+//
+// The code is cleared in the same statement that flips Active, so a code can
+// only ever be used once.
+func Activate(db *gorm.DB, user *User, code string) (err error) {
+	if code == "" {
+		return ErrActivationCodeInvalid
+	}
+	err = db.Where("activation_code = ?", code).First(user).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrActivationCodeInvalid
+		}
+		return err
+	}
+	if user.ActivationExpiresAt == nil || time.Now().After(*user.ActivationExpiresAt) {
+		return ErrActivationCodeExpired
+	}
+
+	result := db.Model(&User{}).Where("id = ? AND activation_code = ?", user.ID, code).Updates(map[string]interface{}{"active": true, "activation_code": "", "activation_expires_at": nil})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrActivationCodeInvalid
+	}
+	user.Active = true
+	user.ActivationCode = ""
+	user.ActivationExpiresAt = nil
+	return nil
+}
+
+// store a new activation code for a User
+func SetActivationCode(db *gorm.DB, user *User, code string, expiresAt time.Time) (err error) {
+	err = db.Model(user).Where("id = ?", user.ID).Updates(map[string]interface{}{"activation_code": code, "activation_expires_at": expiresAt}).Error
+	if err != nil {
+		return err
+	}
+	user.ActivationCode = code
+	user.ActivationExpiresAt = &expiresAt
+	return nil
+}
+
 // get Users
 func GetUsers(db *gorm.DB, users *[]User) (err error) {
 	err = db.Find(users).Error
@@ -62,20 +139,125 @@ func GetUser(db *gorm.DB, user *User, id string) (err error) {
 	return nil
 }
 
-// update a User
-func UpdateUser(db *gorm.DB, user *User, id string) (err error) {
-	err = db.Model(user).Where("id = ?", id).Updates(map[string]interface{}{"username": user.Username, "email": user.Email, "password": user.Password, "activation_code": user.ActivationCode, "active": user.Active, "last_login": user.LastLogin, "ip_address": user.IPAddress}).Error
+// UserProfile holds the fields of a User that its owner may change. Nil
+// fields are left as they are.
+type UserProfile struct {
+	Username *string `json:"username"`
+	Email    *string `json:"email"`
+	Locale   *string `json:"locale"`
+}
+
+var ErrUsernameTaken = errors.New("username is already taken")
+var ErrEmailTaken = errors.New("email is already registered")
+
+// update the profile of a User and load the updated User
+//
+// Only profile fields are written: passwords go through ChangePassword or a
+// password reset, and activation through Activate.
+func UpdateUser(db *gorm.DB, user *User, id string, profile UserProfile) (err error) {
+	updates := map[string]interface{}{}
+	if profile.Username != nil {
+		updates["username"] = *profile.Username
+	}
+	if profile.Email != nil {
+		updates["email"] = *profile.Email
+	}
+	if profile.Locale != nil {
+		updates["locale"] = *profile.Locale
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).First(user).Error
+		if err != nil {
+			return err
+		}
+		if profile.Username != nil && *profile.Username != user.Username {
+			if taken, err := userFieldTaken(tx, "username", *profile.Username, user.ID); err != nil || taken {
+				if err == nil {
+					err = ErrUsernameTaken
+				}
+				return err
+			}
+		}
+		if profile.Email != nil && *profile.Email != user.Email {
+			if taken, err := userFieldTaken(tx, "email", *profile.Email, user.ID); err != nil || taken {
+				if err == nil {
+					err = ErrEmailTaken
+				}
+				return err
+			}
+		}
+		if len(updates) == 0 {
+			return nil
+		}
+		return tx.Model(user).Where("id = ?", id).Updates(updates).Error
+	})
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-// delete User
-func DeleteUser(db *gorm.DB, user *User, id string) (err error) {
-	err = db.Where("id = ?", id).Delete(user).Error
+// userFieldTaken reports whether another user already has value in column
+func userFieldTaken(tx *gorm.DB, column string, value string, userID int) (bool, error) {
+	var count int64
+	err := tx.Model(&User{}).Where(column+" = ? AND id <> ?", value, userID).Count(&count).Error
+	return count > 0, err
+}
+
+// set a new, already hashed, password for a User and revoke its sessions
+// except the session keepSessionID
+func ChangePassword(db *gorm.DB, user *User, id string, hashedPassword string, keepSessionID string) (err error) {
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(user).Where("id = ?", id).Update("password", hashedPassword).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&Token{}).
+			Where("user_id = ? AND session_id <> ? AND revoked_at IS NULL", id, keepSessionID).
+			Update("revoked_at", time.Now()).Error
+	})
+}
+
+// get the users holding a booked ticket, not cancelled, on a Ticket
+func GetTicketUsers(db *gorm.DB, user *[]User, ticketID int) (err error) {
+	err = db.Where("id IN (?)", db.Model(&BTicket{}).Select("user_id").Where("ticket_id = ? AND cancelled_at IS NULL", ticketID)).Find(user).Error
 	if err != nil {
 		return err
 	}
 	return nil
 }
+
+// set the role of a User
+func SetUserRole(db *gorm.DB, user *User, id string, role string) (err error) {
+	err = db.Model(user).Where("id = ?", id).Update("role", role).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// set the role of the User with the given email
+func SetUserRoleByEmail(db *gorm.DB, email string, role string) (err error) {
+	err = db.Model(&User{}).Where("email = ?", email).Update("role", role).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// check that a role is one of the known roles
+func IsValidRole(role string) bool {
+	return role == RoleCustomer || role == RoleAgent || role == RoleAdmin
+}
+
+// delete User and revoke its sessions
+func DeleteUser(db *gorm.DB, user *User, id string) (err error) {
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("id = ?", id).Delete(user).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&Token{}).Where("user_id = ? AND revoked_at IS NULL", id).Update("revoked_at", time.Now()).Error
+	})
+}
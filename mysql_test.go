@@ -0,0 +1,123 @@
+//go:build mysql
+
+// The tests of this file need a MySQL database, configured like the server
+// by the PROJECT_* settings and JWT_SECRET, and run with
+//
+//	go test -tags mysql -run MySQL .
+//
+// They book on tickets of their own and leave the rows behind.
+package main
+
+import (
+	"net/http"
+	"project/config"
+	"project/database"
+	"project/migrations"
+	"project/models"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newMySQLTestAPI is the router over the configured MySQL database, migrated
+// to the latest version, with connections for concurrent requests
+func newMySQLTestAPI(t *testing.T) *testAPI {
+	t.Helper()
+	cfg, err := config.Load(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Database.MaxOpenConns = 32
+	cfg.Database.MaxIdleConns = 32
+	db, err := database.Open(cfg.Database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loc, _ := time.LoadLocation(cfg.LegacyTicketTimezone) // checked by config.Load
+	if _, err := migrations.Up(db, migrations.Settings{LegacyTicketTimezone: loc, DefaultCurrency: cfg.DefaultCurrency}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return newTestAPIOver(t, db, cfg)
+}
+
+// Unlike SQLite, MySQL runs the bookings in parallel transactions, so this
+// checks that the ticket rows are locked before their seats are counted.
+func TestMySQLConcurrentBookingsNeverOversell(t *testing.T) {
+	api := newMySQLTestAPI(t)
+	user := api.createUser("concurrency"+strconv.FormatInt(time.Now().UnixNano(), 36), models.RoleCustomer)
+	session := api.login(user)
+	const seats, customers = 50, 300
+	ticket := api.createTicket(seats, 150000)
+
+	// available_seats is sampled while the bookings run
+	var lowest atomic.Int64
+	lowest.Store(seats)
+	done := make(chan struct{})
+	sampled := make(chan struct{})
+	go func() {
+		defer close(sampled)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			var stored models.Ticket
+			if err := api.db.Select("available_seats").First(&stored, ticket.ID).Error; err == nil && int64(stored.AvailableSeats) < lowest.Load() {
+				lowest.Store(int64(stored.AvailableSeats))
+			}
+		}
+	}()
+
+	var booked, soldOut atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < customers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			recorder := api.request(http.MethodPost, "/bookings", session.AccessToken, map[string]interface{}{
+				"ticket_ids": []int{ticket.ID},
+				"passengers": []interface{}{adult},
+			})
+			switch recorder.Code {
+			case http.StatusOK:
+				booked.Add(1)
+			case http.StatusConflict:
+				soldOut.Add(1)
+			default:
+				t.Errorf("status %d: %s", recorder.Code, recorder.Body)
+			}
+		}()
+	}
+	wg.Wait()
+	close(done)
+	<-sampled
+
+	if lowest.Load() < 0 {
+		t.Errorf("available seats went down to %d", lowest.Load())
+	}
+	if booked.Load() != seats || soldOut.Load() != customers-seats {
+		t.Errorf("%d bookings and %d sold out answers, want %d and %d", booked.Load(), soldOut.Load(), seats, customers-seats)
+	}
+	var stored models.Ticket
+	if err := api.db.First(&stored, ticket.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.AvailableSeats != 0 {
+		t.Errorf("available seats = %d, want 0", stored.AvailableSeats)
+	}
+	var bTickets int64
+	if err := api.db.Model(&models.BTicket{}).Where("ticket_id = ? AND cancelled_at IS NULL", ticket.ID).Count(&bTickets).Error; err != nil {
+		t.Fatal(err)
+	}
+	if bTickets != seats {
+		t.Errorf("%d booked tickets, want %d", bTickets, seats)
+	}
+}
@@ -0,0 +1,91 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// payment statuses reported by a Gateway
+const (
+	StatusRequiresAction = "requires_action" // waiting for a 3-D Secure challenge
+	StatusAuthorized     = "authorized"
+	StatusCaptured       = "captured"
+	StatusVoided         = "voided"
+	StatusRefunded       = "refunded" // fully refunded
+	StatusPartlyRefunded = "partly_refunded"
+)
+
+var ErrDeclined = errors.New("payment was declined")
+var ErrTimeout = errors.New("payment provider timed out")
+var ErrInvalidCard = errors.New("card details are invalid")
+var ErrChallengeFailed = errors.New("3-D Secure challenge failed")
+var ErrUnknownPayment = errors.New("payment is unknown to the provider")
+var ErrInvalidState = errors.New("payment can't do that in its current status")
+
+// Card is what a customer pays with. It is only passed on to the gateway,
+// never stored.
+type Card struct {
+	Number   string `json:"number"`
+	Holder   string `json:"holder"`
+	ExpMonth int    `json:"exp_month"`
+	ExpYear  int    `json:"exp_year"`
+	CVC      string `json:"cvc"`
+}
+
+// Last4 returns the last four digits of the card number
+func (card Card) Last4() string {
+	number := card.digits()
+	if len(number) < 4 {
+		return number
+	}
+	return number[len(number)-4:]
+}
+
+func (card Card) digits() string {
+	return strings.NewReplacer(" ", "", "-", "").Replace(card.Number)
+}
+
+// AuthorizeRequest asks the gateway to reserve Amount on a card.
+type AuthorizeRequest struct {
+	Amount   int64 // in minor units
+	Currency string
+	Card     Card
+	// OrderID is our own reference of what is paid for, e.g. a booking locator
+	OrderID string
+}
+
+// Result is the state of a payment at the gateway after an operation.
+type Result struct {
+	// Reference identifies the payment at the gateway
+	Reference string
+	Status    string
+	// ChallengeURL is where the customer completes 3-D Secure when
+	// Status is StatusRequiresAction
+	ChallengeURL string
+}
+
+// Gateway is a payment provider. Amounts are authorized first, then captured
+// to take the money, or voided to give the reservation up. Captured amounts
+// can be refunded, in full or in parts.
+type Gateway interface {
+	// Name identifies the provider in stored payments
+	Name() string
+	Authorize(ctx context.Context, request AuthorizeRequest) (Result, error)
+	// CompleteChallenge finishes the 3-D Secure challenge of an authorization
+	CompleteChallenge(ctx context.Context, reference string, response string) (Result, error)
+	Capture(ctx context.Context, reference string, amount int64) (Result, error)
+	Refund(ctx context.Context, reference string, amount int64) (Result, error)
+	Void(ctx context.Context, reference string) (Result, error)
+}
+
+// New returns the gateway of the given provider name
+func New(provider string) (Gateway, error) {
+	switch provider {
+	case "", "mock":
+		return NewMockGateway(), nil
+	default:
+		return nil, fmt.Errorf("unknown payment provider %q", provider)
+	}
+}
@@ -0,0 +1,172 @@
+package payments
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// magic card numbers of the mock gateway, any other valid card number is approved
+const (
+	CardDeclined          = "4000000000000002"
+	CardInsufficientFunds = "4000000000009995"
+	CardChallenge         = "4000000000003220" // asks for 3-D Secure, answered by MockChallengeCode
+	CardTimeout           = "4000000000000119"
+)
+
+// MockChallengeCode passes the 3-D Secure challenge of the mock gateway
+const MockChallengeCode = "123456"
+
+// MockGateway is an in-process Gateway for development and testing. Its
+// answers only depend on the card number, see the Card* constants, and
+// payments only live in memory.
+type MockGateway struct {
+	mu       sync.Mutex
+	next     int
+	payments map[string]*mockPayment
+}
+
+type mockPayment struct {
+	status   string
+	amount   int64
+	captured int64
+	refunded int64
+}
+
+func NewMockGateway() *MockGateway {
+	return &MockGateway{payments: map[string]*mockPayment{}}
+}
+
+func (gateway *MockGateway) Name() string {
+	return "mock"
+}
+
+func (gateway *MockGateway) Authorize(ctx context.Context, request AuthorizeRequest) (Result, error) {
+	if err := ctx.Err(); err != nil {
+		return Result{}, err
+	}
+	number := request.Card.digits()
+	if !luhnValid(number) || request.Card.ExpMonth < 1 || request.Card.ExpMonth > 12 {
+		return Result{}, ErrInvalidCard
+	}
+	expires := time.Date(request.Card.ExpYear, time.Month(request.Card.ExpMonth)+1, 1, 0, 0, 0, 0, time.UTC)
+	if !time.Now().Before(expires) {
+		return Result{}, ErrInvalidCard
+	}
+	if request.Amount <= 0 {
+		return Result{}, ErrInvalidState
+	}
+
+	switch number {
+	case CardTimeout:
+		return Result{}, ErrTimeout
+	case CardDeclined:
+		return Result{}, ErrDeclined
+	case CardInsufficientFunds:
+		return Result{}, fmt.Errorf("%w: insufficient funds", ErrDeclined)
+	}
+
+	gateway.mu.Lock()
+	defer gateway.mu.Unlock()
+	gateway.next++
+	reference := fmt.Sprintf("mock_%06d", gateway.next)
+	payment := &mockPayment{status: StatusAuthorized, amount: request.Amount}
+	result := Result{Reference: reference, Status: StatusAuthorized}
+	if number == CardChallenge {
+		payment.status = StatusRequiresAction
+		result.Status = StatusRequiresAction
+		result.ChallengeURL = "https://mock-gateway.invalid/3ds/" + reference
+	}
+	gateway.payments[reference] = payment
+	return result, nil
+}
+
+func (gateway *MockGateway) CompleteChallenge(ctx context.Context, reference string, response string) (Result, error) {
+	return gateway.update(ctx, reference, func(payment *mockPayment) error {
+		if payment.status != StatusRequiresAction {
+			return ErrInvalidState
+		}
+		if response != MockChallengeCode {
+			payment.status = StatusVoided
+			return ErrChallengeFailed
+		}
+		payment.status = StatusAuthorized
+		return nil
+	})
+}
+
+func (gateway *MockGateway) Capture(ctx context.Context, reference string, amount int64) (Result, error) {
+	return gateway.update(ctx, reference, func(payment *mockPayment) error {
+		if payment.status != StatusAuthorized || amount <= 0 || amount > payment.amount {
+			return ErrInvalidState
+		}
+		payment.status = StatusCaptured
+		payment.captured = amount
+		return nil
+	})
+}
+
+func (gateway *MockGateway) Refund(ctx context.Context, reference string, amount int64) (Result, error) {
+	return gateway.update(ctx, reference, func(payment *mockPayment) error {
+		if payment.status != StatusCaptured && payment.status != StatusPartlyRefunded {
+			return ErrInvalidState
+		}
+		if amount <= 0 || payment.refunded+amount > payment.captured {
+			return ErrInvalidState
+		}
+		payment.refunded += amount
+		payment.status = StatusPartlyRefunded
+		if payment.refunded == payment.captured {
+			payment.status = StatusRefunded
+		}
+		return nil
+	})
+}
+
+func (gateway *MockGateway) Void(ctx context.Context, reference string) (Result, error) {
+	return gateway.update(ctx, reference, func(payment *mockPayment) error {
+		if payment.status != StatusAuthorized && payment.status != StatusRequiresAction {
+			return ErrInvalidState
+		}
+		payment.status = StatusVoided
+		return nil
+	})
+}
+
+// update applies change to a known payment and returns its new state
+func (gateway *MockGateway) update(ctx context.Context, reference string, change func(*mockPayment) error) (Result, error) {
+	if err := ctx.Err(); err != nil {
+		return Result{}, err
+	}
+	gateway.mu.Lock()
+	defer gateway.mu.Unlock()
+	payment, ok := gateway.payments[reference]
+	if !ok {
+		return Result{}, ErrUnknownPayment
+	}
+	err := change(payment)
+	return Result{Reference: reference, Status: payment.status}, err
+}
+
+// luhnValid checks the card number checksum
+func luhnValid(number string) bool {
+	if len(number) < 12 || len(number) > 19 {
+		return false
+	}
+	sum := 0
+	for i := 0; i < len(number); i++ {
+		digit := int(number[len(number)-1-i] - '0')
+		if digit < 0 || digit > 9 {
+			return false
+		}
+		if i%2 == 1 {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+	}
+	return sum%10 == 0
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"project/models"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// hiddenKeys are fields of the models that no response may carry
+var hiddenKeys = map[string]bool{
+	"password":        true,
+	"password_hash":   true,
+	"plain_password":  true,
+	"activation_code": true,
+	"token_hash":      true,
+	"deleted_at":      true,
+}
+
+// responseKey is how the response types name their fields. A key such as
+// "Password" or "User" means a model was serialized as it is.
+var responseKey = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+func TestResponsesHideSecrets(t *testing.T) {
+	api := newTestAPI(t)
+	admin := api.login(api.createUser("admin", models.RoleAdmin))
+	// the response bodies by request
+	bodies := map[string]string{}
+	call := func(method string, path string, accessToken string, body interface{}, status int) {
+		t.Helper()
+		recorder := api.request(method, path, accessToken, body)
+		api.expect(recorder, status, nil)
+		bodies[method+" "+path] = recorder.Body.String()
+	}
+
+	// accounts
+	call(http.MethodPost, "/register", "", map[string]string{"username": "mehmet", "email": "mehmet@example.com", "password": testPassword}, http.StatusOK)
+	call(http.MethodPost, "/login", "", map[string]string{"email": "mehmet@example.com", "password": testPassword}, http.StatusUnauthorized)
+	call(http.MethodPost, "/activate", "", map[string]string{"code": "wrong"}, http.StatusBadRequest)
+	call(http.MethodPost, "/users", admin.AccessToken, map[string]string{"username": "ayse", "email": "ayse@example.com", "password": testPassword}, http.StatusOK)
+	call(http.MethodGet, "/users", admin.AccessToken, nil, http.StatusOK)
+	var user models.User
+	if err := api.db.Where("username = ?", "ayse").First(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	api.db.Model(&user).Update("active", true)
+	customer := api.login(user)
+	path := "/users/" + strconv.Itoa(user.ID)
+	call(http.MethodGet, path, customer.AccessToken, nil, http.StatusOK)
+	call(http.MethodPatch, path, customer.AccessToken, map[string]string{"locale": "tr"}, http.StatusOK)
+	call(http.MethodPost, "/token/refresh", "", map[string]string{"refresh_token": customer.RefreshToken}, http.StatusOK)
+	call(http.MethodPost, "/password/forgot", "", map[string]string{"email": user.Email}, http.StatusOK)
+
+	// inventory and bookings
+	ticket := api.createTicket(10, 150000)
+	ticketPath := "/tickets/" + strconv.Itoa(ticket.ID)
+	call(http.MethodGet, "/tickets", "", nil, http.StatusOK)
+	call(http.MethodGet, ticketPath, "", nil, http.StatusOK)
+	call(http.MethodGet, "/planes", "", nil, http.StatusOK)
+	booking := api.book(customer.AccessToken, ticket)
+	call(http.MethodPost, "/bookings/"+booking.Locator+"/pay", customer.AccessToken, card, http.StatusOK)
+	call(http.MethodGet, "/bookings", customer.AccessToken, nil, http.StatusOK)
+	call(http.MethodGet, "/bookings/"+booking.Locator+"/payments", customer.AccessToken, nil, http.StatusOK)
+	lookup := "/bookings/" + booking.Locator + "?last_name=" + adult["last_name"]
+	call(http.MethodGet, lookup, "", nil, http.StatusOK)
+	call(http.MethodGet, "/btickets", customer.AccessToken, nil, http.StatusOK)
+	call(http.MethodGet, "/btickets/"+strconv.Itoa(booking.BTickets[0].ID), customer.AccessToken, nil, http.StatusOK)
+	call(http.MethodPost, ticketPath+"/hold", customer.AccessToken, map[string]int{"quantity": 1}, http.StatusOK)
+	call(http.MethodPost, "/bookings/"+booking.Locator+"/cancel", customer.AccessToken, nil, http.StatusOK)
+	call(http.MethodGet, "/refunds", admin.AccessToken, nil, http.StatusOK)
+
+	// the secrets stored along the way
+	secrets := []string{testPassword}
+	var users []models.User
+	api.db.Find(&users)
+	for _, u := range users {
+		secrets = append(secrets, u.Password)
+		if u.ActivationCode != "" {
+			secrets = append(secrets, u.ActivationCode)
+		}
+	}
+	var hashes []string
+	api.db.Model(&models.Token{}).Pluck("token_hash", &hashes)
+	secrets = append(secrets, hashes...)
+	api.db.Model(&models.PasswordReset{}).Pluck("token_hash", &hashes)
+	secrets = append(secrets, hashes...)
+	if len(secrets) < 8 {
+		t.Fatalf("only %d secrets were stored, the flow above did not run", len(secrets))
+	}
+
+	// anyone with the locator and a last name finds the booking, so it
+	// carries no passenger documents
+	lookupBody := bodies[http.MethodGet+" "+lookup]
+	for _, key := range []string{"document_number", "date_of_birth"} {
+		if strings.Contains(lookupBody, adult[key]) {
+			t.Errorf("GET %s: response contains the %s %q", lookup, key, adult[key])
+		}
+	}
+	if !strings.Contains(lookupBody, `"*****5678"`) {
+		t.Errorf("GET %s: response has no masked document number: %s", lookup, lookupBody)
+	}
+
+	for request, body := range bodies {
+		for _, secret := range secrets {
+			if strings.Contains(body, secret) {
+				t.Errorf("%s: response contains the secret %q", request, secret)
+			}
+		}
+		var value interface{}
+		if err := json.Unmarshal([]byte(body), &value); err != nil {
+			t.Errorf("%s: %s", request, err)
+		}
+		for _, key := range responseKeys(value) {
+			if hiddenKeys[key] || !responseKey.MatchString(key) {
+				t.Errorf("%s: response has the field %q", request, key)
+			}
+		}
+	}
+}
+
+// responseKeys returns the keys of every object in a decoded JSON value
+func responseKeys(value interface{}) []string {
+	var keys []string
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for key, child := range value {
+			keys = append(keys, key)
+			keys = append(keys, responseKeys(child)...)
+		}
+	case []interface{}:
+		for _, child := range value {
+			keys = append(keys, responseKeys(child)...)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// Dates are days at the departure airport, whatever the timezone of the server
+func TestDepartureDateIsTheDayAtTheAirport(t *testing.T) {
+	api := newTestAPI(t)
+	ticket := api.createTicket(10, 150000)
+	istanbul, err := time.LoadLocation("Europe/Istanbul")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 22:30 UTC the day before
+	departureAt := time.Date(2030, 6, 1, 1, 30, 0, 0, istanbul)
+	if err := api.db.Model(&ticket).Updates(map[string]interface{}{"departure_at": departureAt, "arrival_at": departureAt.Add(90 * time.Minute)}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	for date, want := range map[string]int{"2030-06-01": 1, "2030-05-31": 0} {
+		var tickets []struct {
+			ID int `json:"id"`
+		}
+		api.expect(api.request(http.MethodGet, "/filtertickets?from=IST&departure_date="+date, "", nil), http.StatusOK, &tickets)
+		if len(tickets) != want {
+			t.Errorf("departing on %s: %d tickets, want %d", date, len(tickets), want)
+		}
+	}
+}
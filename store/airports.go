@@ -0,0 +1,57 @@
+package store
+
+import (
+	"project/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Airports stores the airports registry.
+type Airports interface {
+	Create(airport *models.Airport) error
+	List(airports *[]models.Airport, query ListQuery) (total int64, err error)
+	// Search finds airports by code prefix, city or name for autocomplete
+	Search(airports *[]models.Airport, text string, limit int) error
+	// Location is the timezone of the airports matching a code or city
+	Location(text string) (*time.Location, error)
+	Get(airport *models.Airport, id string) error
+	Update(airport *models.Airport, id string) error
+	Delete(airport *models.Airport, id string) error
+}
+
+type airportStore struct {
+	db *gorm.DB
+}
+
+func (store *airportStore) Create(airport *models.Airport) error {
+	return models.CreateAirport(store.db, airport)
+}
+
+func (store *airportStore) List(airports *[]models.Airport, query ListQuery) (int64, error) {
+	db, total, err := query.page(store.db.Model(&models.Airport{}))
+	if err != nil {
+		return 0, err
+	}
+	return total, models.GetAirports(db, airports)
+}
+
+func (store *airportStore) Search(airports *[]models.Airport, text string, limit int) error {
+	return models.SearchAirports(store.db, airports, text, limit)
+}
+
+func (store *airportStore) Location(text string) (*time.Location, error) {
+	return models.GetAirportLocation(store.db, text)
+}
+
+func (store *airportStore) Get(airport *models.Airport, id string) error {
+	return models.GetAirport(store.db, airport, id)
+}
+
+func (store *airportStore) Update(airport *models.Airport, id string) error {
+	return models.UpdateAirport(store.db, airport, id)
+}
+
+func (store *airportStore) Delete(airport *models.Airport, id string) error {
+	return models.DeleteAirport(store.db, airport, id)
+}
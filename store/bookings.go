@@ -0,0 +1,175 @@
+package store
+
+import (
+	"context"
+	"project/models"
+	"project/payments"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Bookings stores bookings with their booked tickets, the seat holds before
+// them and the payments and refunds after them.
+type Bookings interface {
+	Create(booking *models.Booking, ticketIDs []int, seats [][]string) error
+	List(bookings *[]models.Booking, query ListQuery) (total int64, err error)
+	Get(booking *models.Booking, locator string) error
+	// Find looks a booking up by locator and the last name of a passenger
+	Find(booking *models.Booking, locator string, lastName string) error
+	Cancel(booking *models.Booking, locator string, cancelledBy int, reason string, policy models.RefundPolicy, refunds *[]models.Refund) error
+
+	CreateBTicket(bTicket *models.BTicket) error
+	ListBTickets(bTickets *[]models.BTicket, query ListQuery) (total int64, err error)
+	GetBTicket(bTicket *models.BTicket, id string) error
+	UpdateBTicket(bTicket *models.BTicket, id string) error
+	CancelBTicket(bTicket *models.BTicket, id string, cancelledBy int, reason string, policy models.RefundPolicy, refund *models.Refund) error
+
+	CreateHold(hold *models.SeatHold, ticketID string, ttl time.Duration) error
+	GetHold(hold *models.SeatHold, id string) error
+	// ConfirmHold turns a hold into a booking waiting for payment
+	ConfirmHold(hold *models.SeatHold, id string, booking *models.Booking, seats []string) error
+	ReleaseHold(hold *models.SeatHold, id string) error
+	// ExpireHolds releases the holds that ran out and returns how many
+	ExpireHolds() (expired int, err error)
+	// ExpireUnpaid closes the bookings not paid in time and returns how many
+	ExpireUnpaid() (expired int, err error)
+
+	Pay(ctx context.Context, gateway payments.Gateway, payment *models.Payment, locator string, card payments.Card) error
+	CompletePaymentChallenge(ctx context.Context, gateway payments.Gateway, payment *models.Payment, id string, response string) error
+	RefundPayment(ctx context.Context, gateway payments.Gateway, payment *models.Payment, bookingID int, amount int64) error
+	GetPayment(payment *models.Payment, id string) error
+	ListPayments(list *[]models.Payment, bookingID int) error
+
+	ListRefunds(refunds *[]models.Refund, query ListQuery) (total int64, err error)
+	// SumRefunds totals the refunds matching the conditions of query by currency
+	SumRefunds(totals *[]models.RefundTotal, query ListQuery) error
+	// SetRefundsStatus records an attempt to send refunds to the payment provider
+	SetRefundsStatus(ids []int, status string, failure string) error
+	// ListRetryableRefunds lists the failed refunds with attempts left and the
+	// pending ones not updated since staleBefore
+	ListRetryableRefunds(refunds *[]models.Refund, staleBefore time.Time) error
+	// ClaimRefunds takes retryable refunds for sending them again, claimed is
+	// false when one of them was taken by someone else
+	ClaimRefunds(ids []int, staleBefore time.Time) (claimed bool, err error)
+}
+
+type bookingStore struct {
+	db *gorm.DB
+}
+
+func (store *bookingStore) Create(booking *models.Booking, ticketIDs []int, seats [][]string) error {
+	return models.CreateBooking(store.db, booking, ticketIDs, seats)
+}
+
+func (store *bookingStore) List(bookings *[]models.Booking, query ListQuery) (int64, error) {
+	db, total, err := query.page(store.db.Model(&models.Booking{}))
+	if err != nil {
+		return 0, err
+	}
+	return total, models.GetBookings(db, bookings)
+}
+
+func (store *bookingStore) Get(booking *models.Booking, locator string) error {
+	return models.GetBooking(store.db, booking, locator)
+}
+
+func (store *bookingStore) Find(booking *models.Booking, locator string, lastName string) error {
+	return models.FindBooking(store.db, booking, locator, lastName)
+}
+
+func (store *bookingStore) Cancel(booking *models.Booking, locator string, cancelledBy int, reason string, policy models.RefundPolicy, refunds *[]models.Refund) error {
+	return models.CancelBooking(store.db, booking, locator, cancelledBy, reason, policy, refunds)
+}
+
+func (store *bookingStore) CreateBTicket(bTicket *models.BTicket) error {
+	return models.CreateBTicket(store.db, bTicket)
+}
+
+func (store *bookingStore) ListBTickets(bTickets *[]models.BTicket, query ListQuery) (int64, error) {
+	db, total, err := query.page(store.db.Model(&models.BTicket{}))
+	if err != nil {
+		return 0, err
+	}
+	return total, models.GetBTickets(db, bTickets)
+}
+
+func (store *bookingStore) GetBTicket(bTicket *models.BTicket, id string) error {
+	return models.GetBTicket(store.db, bTicket, id)
+}
+
+func (store *bookingStore) UpdateBTicket(bTicket *models.BTicket, id string) error {
+	return models.UpdateBTicket(store.db, bTicket, id)
+}
+
+func (store *bookingStore) CancelBTicket(bTicket *models.BTicket, id string, cancelledBy int, reason string, policy models.RefundPolicy, refund *models.Refund) error {
+	return models.CancelBTicket(store.db, bTicket, id, cancelledBy, reason, policy, refund)
+}
+
+func (store *bookingStore) CreateHold(hold *models.SeatHold, ticketID string, ttl time.Duration) error {
+	return models.CreateSeatHold(store.db, hold, ticketID, ttl)
+}
+
+func (store *bookingStore) GetHold(hold *models.SeatHold, id string) error {
+	return models.GetSeatHold(store.db, hold, id)
+}
+
+func (store *bookingStore) ConfirmHold(hold *models.SeatHold, id string, booking *models.Booking, seats []string) error {
+	return models.ConfirmSeatHold(store.db, hold, id, booking, seats)
+}
+
+func (store *bookingStore) ReleaseHold(hold *models.SeatHold, id string) error {
+	return models.ReleaseSeatHold(store.db, hold, id)
+}
+
+func (store *bookingStore) ExpireHolds() (int, error) {
+	return models.ExpireSeatHolds(store.db)
+}
+
+func (store *bookingStore) ExpireUnpaid() (int, error) {
+	return models.ExpireUnpaidBookings(store.db)
+}
+
+func (store *bookingStore) Pay(ctx context.Context, gateway payments.Gateway, payment *models.Payment, locator string, card payments.Card) error {
+	return models.PayBooking(ctx, store.db, gateway, payment, locator, card)
+}
+
+func (store *bookingStore) CompletePaymentChallenge(ctx context.Context, gateway payments.Gateway, payment *models.Payment, id string, response string) error {
+	return models.CompletePaymentChallenge(ctx, store.db, gateway, payment, id, response)
+}
+
+func (store *bookingStore) RefundPayment(ctx context.Context, gateway payments.Gateway, payment *models.Payment, bookingID int, amount int64) error {
+	return models.RefundPayment(ctx, store.db, gateway, payment, bookingID, amount)
+}
+
+func (store *bookingStore) GetPayment(payment *models.Payment, id string) error {
+	return models.GetPayment(store.db, payment, id)
+}
+
+func (store *bookingStore) ListPayments(list *[]models.Payment, bookingID int) error {
+	return models.GetPayments(store.db, list, bookingID)
+}
+
+func (store *bookingStore) ListRefunds(refunds *[]models.Refund, query ListQuery) (int64, error) {
+	db, total, err := query.page(store.db.Model(&models.Refund{}))
+	if err != nil {
+		return 0, err
+	}
+	return total, models.GetRefunds(db, refunds)
+}
+
+func (store *bookingStore) SumRefunds(totals *[]models.RefundTotal, query ListQuery) error {
+	return models.SumRefunds(query.filter(store.db.Model(&models.Refund{})), totals)
+}
+
+func (store *bookingStore) SetRefundsStatus(ids []int, status string, failure string) error {
+	return models.SetRefundsStatus(store.db, ids, status, failure)
+}
+
+func (store *bookingStore) ListRetryableRefunds(refunds *[]models.Refund, staleBefore time.Time) error {
+	return models.GetRetryableRefunds(store.db, refunds, staleBefore)
+}
+
+func (store *bookingStore) ClaimRefunds(ids []int, staleBefore time.Time) (bool, error) {
+	return models.ClaimRefunds(store.db, ids, staleBefore)
+}
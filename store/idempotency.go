@@ -0,0 +1,41 @@
+package store
+
+import (
+	"project/models"
+
+	"gorm.io/gorm"
+)
+
+// IdempotencyKeys stores the responses kept for retried requests.
+type IdempotencyKeys interface {
+	// Create stores a new key, created is false when the user already used it
+	Create(record *models.IdempotencyKey) (created bool, err error)
+	Get(record *models.IdempotencyKey, userID int, key string) error
+	Complete(record *models.IdempotencyKey) error
+	Delete(id int) error
+	DeleteExpired() (deleted int64, err error)
+}
+
+type idempotencyKeyStore struct {
+	db *gorm.DB
+}
+
+func (store *idempotencyKeyStore) Create(record *models.IdempotencyKey) (bool, error) {
+	return models.CreateIdempotencyKey(store.db, record)
+}
+
+func (store *idempotencyKeyStore) Get(record *models.IdempotencyKey, userID int, key string) error {
+	return models.GetIdempotencyKey(store.db, record, userID, key)
+}
+
+func (store *idempotencyKeyStore) Complete(record *models.IdempotencyKey) error {
+	return models.CompleteIdempotencyKey(store.db, record)
+}
+
+func (store *idempotencyKeyStore) Delete(id int) error {
+	return models.DeleteIdempotencyKey(store.db, &models.IdempotencyKey{}, id)
+}
+
+func (store *idempotencyKeyStore) DeleteExpired() (int64, error) {
+	return models.DeleteExpiredIdempotencyKeys(store.db)
+}
@@ -0,0 +1,43 @@
+package store
+
+import (
+	"project/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Outbox stores emails until the outbox worker sends them.
+type Outbox interface {
+	Queue(email *models.OutboxEmail) error
+	// ListDue returns up to limit emails that are waiting to be sent
+	ListDue(emails *[]models.OutboxEmail, limit int) error
+	// Claim reserves an email for one sender until lockedUntil
+	Claim(email *models.OutboxEmail, lockedUntil time.Time) (claimed bool, err error)
+	MarkSent(email *models.OutboxEmail) error
+	MarkFailed(email *models.OutboxEmail, sendErr error, nextAttemptAt *time.Time) error
+}
+
+type outboxStore struct {
+	db *gorm.DB
+}
+
+func (store *outboxStore) Queue(email *models.OutboxEmail) error {
+	return models.QueueEmail(store.db, email)
+}
+
+func (store *outboxStore) ListDue(emails *[]models.OutboxEmail, limit int) error {
+	return models.GetDueEmails(store.db, emails, limit)
+}
+
+func (store *outboxStore) Claim(email *models.OutboxEmail, lockedUntil time.Time) (bool, error) {
+	return models.ClaimEmail(store.db, email, lockedUntil)
+}
+
+func (store *outboxStore) MarkSent(email *models.OutboxEmail) error {
+	return models.MarkEmailSent(store.db, email)
+}
+
+func (store *outboxStore) MarkFailed(email *models.OutboxEmail, sendErr error, nextAttemptAt *time.Time) error {
+	return models.MarkEmailFailed(store.db, email, sendErr, nextAttemptAt)
+}
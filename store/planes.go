@@ -0,0 +1,54 @@
+package store
+
+import (
+	"project/models"
+
+	"gorm.io/gorm"
+)
+
+// Planes stores planes and their seat maps.
+type Planes interface {
+	Create(plane *models.Plane) error
+	List(planes *[]models.Plane, query ListQuery) (total int64, err error)
+	Get(plane *models.Plane, id string) error
+	Update(plane *models.Plane, id string) error
+	Delete(plane *models.Plane, id string) error
+	GetSeats(seats *[]models.Seat, planeID string) error
+	ReplaceSeats(seats *[]models.Seat, planeID string) error
+}
+
+type planeStore struct {
+	db *gorm.DB
+}
+
+func (store *planeStore) Create(plane *models.Plane) error {
+	return models.CreatePlane(store.db, plane)
+}
+
+func (store *planeStore) List(planes *[]models.Plane, query ListQuery) (int64, error) {
+	db, total, err := query.page(store.db.Model(&models.Plane{}))
+	if err != nil {
+		return 0, err
+	}
+	return total, models.GetPlanes(db, planes)
+}
+
+func (store *planeStore) Get(plane *models.Plane, id string) error {
+	return models.GetPlane(store.db, plane, id)
+}
+
+func (store *planeStore) Update(plane *models.Plane, id string) error {
+	return models.UpdatePlane(store.db, plane, id)
+}
+
+func (store *planeStore) Delete(plane *models.Plane, id string) error {
+	return models.DeletePlane(store.db, plane, id)
+}
+
+func (store *planeStore) GetSeats(seats *[]models.Seat, planeID string) error {
+	return models.GetSeats(store.db, seats, planeID)
+}
+
+func (store *planeStore) ReplaceSeats(seats *[]models.Seat, planeID string) error {
+	return models.ReplaceSeats(store.db, seats, planeID)
+}
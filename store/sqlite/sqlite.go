@@ -0,0 +1,41 @@
+// Package sqlite opens an in-memory SQLite database so the API and the
+// repositories of package store can run without MySQL, for example under
+// go test:
+//
+//	db, err := sqlite.Open()
+//	router := setupRouter(db, cfg, services)
+//
+// The schema is built by the same versioned migrations as in production,
+// from their SQLite dialect. Each call to Open returns a new database with
+// the bundled airports and no other rows.
+package sqlite
+
+import (
+	"project/migrations"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// Open creates an in-memory database. It keeps a single connection, since
+// every connection to ":memory:" would see a database of its own.
+func Open() (*gorm.DB, error) {
+	db, err := gorm.Open(sqlite.Open("file::memory:?_pragma=foreign_keys(1)"), &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(1)
+	sqlDB.SetConnMaxLifetime(0)
+	sqlDB.SetConnMaxIdleTime(0)
+
+	_, err = migrations.Up(db, migrations.Settings{LegacyTicketTimezone: time.UTC, DefaultCurrency: "TRY"})
+	if err != nil {
+		return nil, err
+	}
+	return db, nil
+}
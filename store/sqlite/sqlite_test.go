@@ -0,0 +1,63 @@
+package sqlite
+
+import (
+	"project/models"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// The migrations must create a column for every field of the models
+func TestSchemaMatchesModels(t *testing.T) {
+	db, err := Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	all := []interface{}{
+		&models.User{},
+		&models.OutboxEmail{},
+		&models.PasswordReset{},
+		&models.Token{},
+		&models.IdempotencyKey{},
+		&models.Airport{},
+		&models.Plane{},
+		&models.Seat{},
+		&models.Ticket{},
+		&models.Booking{},
+		&models.Passenger{},
+		&models.BookingSegment{},
+		&models.BTicket{},
+		&models.SeatAssignment{},
+		&models.SeatHold{},
+		&models.Refund{},
+		&models.Payment{},
+		&models.PaymentEvent{},
+	}
+	for _, model := range all {
+		statement := db.Session(&gorm.Session{}).Statement
+		if err := statement.Parse(model); err != nil {
+			t.Fatal(err)
+		}
+		table := statement.Schema.Table
+		if !db.Migrator().HasTable(table) {
+			t.Errorf("table %s is missing", table)
+			continue
+		}
+		for _, field := range statement.Schema.Fields {
+			if field.DBName == "" {
+				continue
+			}
+			if !db.Migrator().HasColumn(model, field.DBName) {
+				t.Errorf("column %s.%s is missing", table, field.DBName)
+			}
+		}
+	}
+
+	var airports int64
+	if err := db.Model(&models.Airport{}).Count(&airports).Error; err != nil {
+		t.Fatal(err)
+	}
+	if airports == 0 {
+		t.Error("airports are not seeded")
+	}
+}
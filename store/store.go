@@ -0,0 +1,123 @@
+// Package store defines the storage the controllers work with, one
+// interface per resource, and implements it on gorm.
+//
+// The gorm implementation returned by New runs on the MySQL database of the
+// server and on the in-memory SQLite database of store/sqlite alike.
+package store
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrNotFound is returned when the requested record does not exist
+var ErrNotFound = gorm.ErrRecordNotFound
+
+// Repositories groups the storage of every resource.
+type Repositories struct {
+	Users           Users
+	Tokens          Tokens
+	Planes          Planes
+	Airports        Airports
+	Tickets         Tickets
+	Bookings        Bookings
+	Outbox          Outbox
+	IdempotencyKeys IdempotencyKeys
+}
+
+// New returns the repositories backed by db
+func New(db *gorm.DB) Repositories {
+	return Repositories{
+		Users:           &userStore{db: db},
+		Tokens:          &tokenStore{db: db},
+		Planes:          &planeStore{db: db},
+		Airports:        &airportStore{db: db},
+		Tickets:         &ticketStore{db: db},
+		Bookings:        &bookingStore{db: db},
+		Outbox:          &outboxStore{db: db},
+		IdempotencyKeys: &idempotencyKeyStore{db: db},
+	}
+}
+
+// Operator compares a column to the value of a Filter.
+type Operator string
+
+const (
+	Equal          Operator = "="
+	Greater        Operator = ">"
+	GreaterOrEqual Operator = ">="
+	Less           Operator = "<"
+	LessOrEqual    Operator = "<="
+)
+
+// Filter keeps the rows whose Column compares to Value by Operator, such as
+// price_amount >= 1000.
+type Filter struct {
+	Column   string
+	Operator Operator
+	Value    interface{}
+}
+
+// Sort orders a list by a column.
+type Sort struct {
+	Column     string
+	Descending bool
+}
+
+// ListQuery selects a page of a list. A zero Limit returns every row.
+type ListQuery struct {
+	Filters []Filter
+	Sorts   []Sort
+	Offset  int
+	Limit   int
+}
+
+// Where returns a copy of query with one more filter
+func (query ListQuery) Where(column string, operator Operator, value interface{}) ListQuery {
+	query.Filters = append(append([]Filter{}, query.Filters...), Filter{Column: column, Operator: operator, Value: value})
+	return query
+}
+
+// expression is the condition of filter, with the column quoted by gorm
+func (filter Filter) expression() clause.Expression {
+	column := clause.Column{Name: filter.Column}
+	switch filter.Operator {
+	case Greater:
+		return clause.Gt{Column: column, Value: filter.Value}
+	case GreaterOrEqual:
+		return clause.Gte{Column: column, Value: filter.Value}
+	case Less:
+		return clause.Lt{Column: column, Value: filter.Value}
+	case LessOrEqual:
+		return clause.Lte{Column: column, Value: filter.Value}
+	}
+	return clause.Eq{Column: column, Value: filter.Value}
+}
+
+// filter applies the filters of query to db
+func (query ListQuery) filter(db *gorm.DB) *gorm.DB {
+	for _, filter := range query.Filters {
+		db = db.Where(filter.expression())
+	}
+	return db
+}
+
+// page counts the rows of db matching query and returns db limited to the
+// requested page
+func (query ListQuery) page(db *gorm.DB) (*gorm.DB, int64, error) {
+	db = query.filter(db)
+
+	var total int64
+	if err := db.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	db = db.Session(&gorm.Session{})
+	for _, sort := range query.Sorts {
+		db = db.Order(clause.OrderByColumn{Column: clause.Column{Name: sort.Column}, Desc: sort.Descending})
+	}
+	if query.Limit > 0 {
+		db = db.Offset(query.Offset).Limit(query.Limit)
+	}
+	return db, total, nil
+}
@@ -0,0 +1,73 @@
+package store
+
+import (
+	"project/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Tickets stores the flights on sale.
+type Tickets interface {
+	Create(ticket *models.Ticket) error
+	List(tickets *[]models.Ticket, query ListQuery) (total int64, err error)
+	// Filter lists the tickets between two airports, each given by IATA or
+	// ICAO code or by city. An empty from or to matches every airport.
+	Filter(tickets *[]models.Ticket, from string, to string, query ListQuery) (total int64, err error)
+	Get(ticket *models.Ticket, id string) error
+	GetSeats(seats *[]models.SeatStatus, ticket models.Ticket) error
+	Update(ticket *models.Ticket, id string) error
+	Delete(ticket *models.Ticket, id string) error
+	SearchConnections(itineraries *[]models.Itinerary, from string, to string, dayStart time.Time, dayEnd time.Time, opts models.ConnectionOptions) error
+}
+
+type ticketStore struct {
+	db *gorm.DB
+}
+
+func (store *ticketStore) Create(ticket *models.Ticket) error {
+	return models.CreateTicket(store.db, ticket)
+}
+
+func (store *ticketStore) List(tickets *[]models.Ticket, query ListQuery) (int64, error) {
+	db, total, err := query.page(store.db.Model(&models.Ticket{}))
+	if err != nil {
+		return 0, err
+	}
+	return total, models.GetTickets(db, tickets)
+}
+
+func (store *ticketStore) Filter(tickets *[]models.Ticket, from string, to string, query ListQuery) (int64, error) {
+	db := store.db.Model(&models.Ticket{})
+	if from != "" {
+		db = db.Where("from_airport_id IN (?)", models.AirportIDs(store.db, from))
+	}
+	if to != "" {
+		db = db.Where("to_airport_id IN (?)", models.AirportIDs(store.db, to))
+	}
+	db, total, err := query.page(db)
+	if err != nil {
+		return 0, err
+	}
+	return total, models.FilterTickets(db, tickets)
+}
+
+func (store *ticketStore) Get(ticket *models.Ticket, id string) error {
+	return models.GetTicket(store.db, ticket, id)
+}
+
+func (store *ticketStore) GetSeats(seats *[]models.SeatStatus, ticket models.Ticket) error {
+	return models.GetTicketSeats(store.db, seats, ticket)
+}
+
+func (store *ticketStore) Update(ticket *models.Ticket, id string) error {
+	return models.UpdateTicket(store.db, ticket, id)
+}
+
+func (store *ticketStore) Delete(ticket *models.Ticket, id string) error {
+	return models.DeleteTicket(store.db, ticket, id)
+}
+
+func (store *ticketStore) SearchConnections(itineraries *[]models.Itinerary, from string, to string, dayStart time.Time, dayEnd time.Time, opts models.ConnectionOptions) error {
+	return models.SearchConnections(store.db, itineraries, from, to, dayStart, dayEnd, opts)
+}
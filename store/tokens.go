@@ -0,0 +1,49 @@
+package store
+
+import (
+	"project/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Tokens stores the refresh tokens of login sessions.
+type Tokens interface {
+	// Create starts a session for user and returns its refresh token
+	Create(user models.User, ttl time.Duration) (models.Token, string, error)
+	// Rotate exchanges a refresh token for the next one of its session
+	Rotate(token *models.Token, refreshToken string, ttl time.Duration) (string, error)
+	Get(token *models.Token, id string) error
+	RevokeSession(sessionID string) error
+	RevokeUser(userID int) (revoked int64, err error)
+	// ListRevoked returns the tokens revoked since a time with their session
+	ListRevoked(tokens *[]models.Token, since time.Time) error
+}
+
+type tokenStore struct {
+	db *gorm.DB
+}
+
+func (store *tokenStore) Create(user models.User, ttl time.Duration) (models.Token, string, error) {
+	return models.CreateToken(store.db, user, ttl)
+}
+
+func (store *tokenStore) Rotate(token *models.Token, refreshToken string, ttl time.Duration) (string, error) {
+	return models.RotateToken(store.db, token, refreshToken, ttl)
+}
+
+func (store *tokenStore) Get(token *models.Token, id string) error {
+	return models.GetToken(store.db, token, id)
+}
+
+func (store *tokenStore) RevokeSession(sessionID string) error {
+	return models.RevokeSession(store.db, sessionID)
+}
+
+func (store *tokenStore) RevokeUser(userID int) (int64, error) {
+	return models.RevokeUserTokens(store.db, userID)
+}
+
+func (store *tokenStore) ListRevoked(tokens *[]models.Token, since time.Time) error {
+	return models.GetRevokedTokens(store.db, tokens, since)
+}
@@ -0,0 +1,102 @@
+package store
+
+import (
+	"project/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Users stores accounts, their activation codes and password resets.
+type Users interface {
+	Create(user *models.User) error
+	Register(user *models.User) error
+	Activate(user *models.User, code string) error
+	SetActivationCode(user *models.User, code string, expiresAt time.Time) error
+	List(users *[]models.User, query ListQuery) (total int64, err error)
+	Get(user *models.User, id string) error
+	GetByEmail(user *models.User, email string) error
+	// ListByTicket returns the users holding a booked ticket on a flight
+	ListByTicket(users *[]models.User, ticketID int) error
+	Update(user *models.User, id string, profile models.UserProfile) error
+	SetRole(user *models.User, id string, role string) error
+	SetRoleByEmail(email string, role string) error
+	ChangePassword(user *models.User, id string, hashedPassword string, keepSessionID string) error
+	Delete(user *models.User, id string) error
+
+	CreatePasswordReset(reset *models.PasswordReset, token string) error
+	GetPasswordResetUser(user *models.User, token string) error
+	ResetPassword(user *models.User, token string, hashedPassword string) error
+}
+
+type userStore struct {
+	db *gorm.DB
+}
+
+func (store *userStore) Create(user *models.User) error {
+	return models.CreateUser(store.db, user)
+}
+
+func (store *userStore) Register(user *models.User) error {
+	return models.Register(store.db, user)
+}
+
+func (store *userStore) Activate(user *models.User, code string) error {
+	return models.Activate(store.db, user, code)
+}
+
+func (store *userStore) SetActivationCode(user *models.User, code string, expiresAt time.Time) error {
+	return models.SetActivationCode(store.db, user, code, expiresAt)
+}
+
+func (store *userStore) List(users *[]models.User, query ListQuery) (int64, error) {
+	db, total, err := query.page(store.db.Model(&models.User{}))
+	if err != nil {
+		return 0, err
+	}
+	return total, models.GetUsers(db, users)
+}
+
+func (store *userStore) Get(user *models.User, id string) error {
+	return models.GetUser(store.db, user, id)
+}
+
+func (store *userStore) GetByEmail(user *models.User, email string) error {
+	return models.Login(store.db, user, email)
+}
+
+func (store *userStore) ListByTicket(users *[]models.User, ticketID int) error {
+	return models.GetTicketUsers(store.db, users, ticketID)
+}
+
+func (store *userStore) Update(user *models.User, id string, profile models.UserProfile) error {
+	return models.UpdateUser(store.db, user, id, profile)
+}
+
+func (store *userStore) SetRole(user *models.User, id string, role string) error {
+	return models.SetUserRole(store.db, user, id, role)
+}
+
+func (store *userStore) SetRoleByEmail(email string, role string) error {
+	return models.SetUserRoleByEmail(store.db, email, role)
+}
+
+func (store *userStore) ChangePassword(user *models.User, id string, hashedPassword string, keepSessionID string) error {
+	return models.ChangePassword(store.db, user, id, hashedPassword, keepSessionID)
+}
+
+func (store *userStore) Delete(user *models.User, id string) error {
+	return models.DeleteUser(store.db, user, id)
+}
+
+func (store *userStore) CreatePasswordReset(reset *models.PasswordReset, token string) error {
+	return models.CreatePasswordReset(store.db, reset, token)
+}
+
+func (store *userStore) GetPasswordResetUser(user *models.User, token string) error {
+	return models.GetPasswordResetUser(store.db, user, token)
+}
+
+func (store *userStore) ResetPassword(user *models.User, token string, hashedPassword string) error {
+	return models.ResetPassword(store.db, user, token, hashedPassword)
+}